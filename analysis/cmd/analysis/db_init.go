@@ -0,0 +1,91 @@
+package main
+
+func GetCommands() []string {
+	return []string{
+		`CREATE TABLE IF NOT EXISTS backtest_runs (
+			id SERIAL PRIMARY KEY,
+			portfolio VARCHAR(255) NOT NULL,
+			strategy VARCHAR(255) NOT NULL,
+			params JSONB NOT NULL DEFAULT '{}',
+			market VARCHAR(255) NOT NULL,
+			symbols VARCHAR(255) NOT NULL,
+			data_start TIMESTAMPTZ,
+			data_end TIMESTAMPTZ,
+			code_version VARCHAR(255) NOT NULL,
+			starting_balance DOUBLE PRECISION NOT NULL,
+			ending_equity DOUBLE PRECISION,
+			started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			finished_at TIMESTAMPTZ
+		)`,
+		`CREATE TABLE IF NOT EXISTS signals (
+			id SERIAL PRIMARY KEY,
+			run_id INT NOT NULL REFERENCES backtest_runs(id) ON DELETE CASCADE,
+			symbol VARCHAR(255) NOT NULL,
+			action VARCHAR(16) NOT NULL,
+			order_type VARCHAR(16) NOT NULL,
+			price DOUBLE PRECISION NOT NULL,
+			stop_loss DOUBLE PRECISION NOT NULL,
+			take_profit DOUBLE PRECISION NOT NULL,
+			timestamp TIMESTAMPTZ NOT NULL,
+			cancel_time TIMESTAMPTZ,
+			accepted BOOLEAN NOT NULL,
+			reject_reason TEXT
+		)`,
+		`ALTER TABLE signals ADD COLUMN IF NOT EXISTS setup VARCHAR(64)`,
+		`ALTER TABLE signals ADD COLUMN IF NOT EXISTS context JSONB`,
+		`CREATE INDEX IF NOT EXISTS idx_signals_setup ON signals(setup)`,
+		`CREATE INDEX IF NOT EXISTS idx_signals_run ON signals(run_id, timestamp)`,
+		`CREATE TABLE IF NOT EXISTS orders (
+			id SERIAL PRIMARY KEY,
+			run_id INT NOT NULL REFERENCES backtest_runs(id) ON DELETE CASCADE,
+			signal_id INT REFERENCES signals(id) ON DELETE CASCADE,
+			symbol VARCHAR(255) NOT NULL,
+			contract VARCHAR(255) NOT NULL,
+			quantity INT NOT NULL,
+			action VARCHAR(16) NOT NULL,
+			order_type VARCHAR(16) NOT NULL,
+			price DOUBLE PRECISION NOT NULL,
+			submitted_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_orders_run ON orders(run_id, submitted_at)`,
+		`CREATE TABLE IF NOT EXISTS positions (
+			id SERIAL PRIMARY KEY,
+			run_id INT NOT NULL REFERENCES backtest_runs(id) ON DELETE CASCADE,
+			order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+			symbol VARCHAR(255) NOT NULL,
+			contract VARCHAR(255) NOT NULL,
+			quantity INT NOT NULL,
+			action VARCHAR(16) NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			exit_reason VARCHAR(32),
+			enter_price DOUBLE PRECISION,
+			exit_price DOUBLE PRECISION,
+			stop_loss DOUBLE PRECISION NOT NULL,
+			take_profit DOUBLE PRECISION NOT NULL,
+			enter_time TIMESTAMPTZ,
+			exit_time TIMESTAMPTZ,
+			entry_slippage DOUBLE PRECISION NOT NULL DEFAULT 0,
+			exit_slippage DOUBLE PRECISION NOT NULL DEFAULT 0,
+			commission DOUBLE PRECISION NOT NULL DEFAULT 0,
+			fees DOUBLE PRECISION NOT NULL DEFAULT 0,
+			mae DOUBLE PRECISION NOT NULL DEFAULT 0,
+			mfe DOUBLE PRECISION NOT NULL DEFAULT 0,
+			net_pnl DOUBLE PRECISION,
+			CONSTRAINT uq_positions_order UNIQUE(order_id)
+		)`,
+		`ALTER TABLE positions ADD COLUMN IF NOT EXISTS setup VARCHAR(64)`,
+		`CREATE INDEX IF NOT EXISTS idx_positions_run ON positions(run_id, enter_time)`,
+		`CREATE TABLE IF NOT EXISTS equity_points (
+			run_id INT NOT NULL REFERENCES backtest_runs(id) ON DELETE CASCADE,
+			timestamp TIMESTAMPTZ NOT NULL,
+			cash DOUBLE PRECISION NOT NULL,
+			realized DOUBLE PRECISION NOT NULL,
+			unrealized DOUBLE PRECISION NOT NULL,
+			equity DOUBLE PRECISION NOT NULL,
+			margin_used DOUBLE PRECISION NOT NULL,
+			drawdown DOUBLE PRECISION NOT NULL,
+			drawdown_pct DOUBLE PRECISION NOT NULL,
+			PRIMARY KEY (run_id, timestamp)
+		)`,
+	}
+}
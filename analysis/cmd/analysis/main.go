@@ -8,13 +8,21 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 
+	"github.com/mgordon34/gostonks/analysis/internal/backtest"
+	"github.com/mgordon34/gostonks/analysis/internal/candlecache"
+	"github.com/mgordon34/gostonks/analysis/internal/chart"
+	"github.com/mgordon34/gostonks/analysis/internal/execution"
+	"github.com/mgordon34/gostonks/analysis/internal/metrics"
 	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
-	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/analysis/internal/runs"
 	"github.com/mgordon34/gostonks/internal/config"
 	"github.com/mgordon34/gostonks/internal/storage"
 	"github.com/mgordon34/gostonks/market/cmd/candle"
@@ -31,24 +39,127 @@ func main() {
 	client := redis.NewClient(&redis.Options{Addr: addr})
 	defer client.Close()
 
-	db := storage.GetDB(config.Get("DB_URL", ""))
-	candleRepository := candle.NewRepository(db)
+	cacheSize, err := strconv.Atoi(config.Get("CANDLE_CACHE_SIZE", "16"))
+	if err != nil {
+		log.Fatalf("Invalid CANDLE_CACHE_SIZE: %v", err)
+	}
+	candleRepository := candlecache.New(candle.OpenRepository(), cacheSize)
 
-	var strategies []strategy.Strategy
-	strategies = append(strategies, strategy.NewBarStrategy(ctx, candleRepository, "iFVG Strat", "futures", []string{"NQ"}, 2880))
-	portfolio := portfolio.Portfolio{
-		Name: "Backtest Portfolio",
-		Strategies: strategies,
-		Balance: 100000,
+	configPath := config.Get("STRATEGY_CONFIG", "analysis/config.json")
+	strategyConfig, err := portfolio.LoadConfig(configPath)
+	if err != nil {
+		log.Fatalf("Invalid STRATEGY_CONFIG: %v", err)
 	}
 
+	// The service trades with the same options a backtest reads, so the
+	// two stay in step.
+	opts, err := backtest.OptionsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid trading options: %v", err)
+	}
+	executionConfig := opts.Execution
+	executionConfig.Intrabar = candleRepository
+	reportDir := config.Get("REPORT_DIR", "reports")
+	reportCharts, err := strconv.ParseBool(config.Get("REPORT_CHARTS", "true"))
+	if err != nil {
+		log.Fatalf("Invalid REPORT_CHARTS: %v", err)
+	}
+
+	recordRuns, err := strconv.ParseBool(config.Get("RECORD_RUNS", "false"))
+	if err != nil {
+		log.Fatalf("Invalid RECORD_RUNS: %v", err)
+	}
+	var runRepository *runs.Repository
+	if recordRuns {
+		dbURL := config.Get("DB_URL", "")
+		storage.InitTables(dbURL, GetCommands())
+		runRepository = runs.NewRepository(storage.GetDB(dbURL))
+	}
+
+	var portfolios []*portfolio.Portfolio
+	var recorders []*runs.Recorder
+	for _, portfolioConfig := range strategyConfig.Portfolios {
+		strategies, err := portfolioConfig.NewStrategies(ctx, candleRepository)
+		if err != nil {
+			log.Fatalf("Invalid strategies for portfolio %s in %s:\n%v", portfolioConfig.Name, configPath, err)
+		}
+		p := &portfolio.Portfolio{
+			Name: portfolioConfig.Name,
+			Strategies: strategies,
+			Balance: portfolioConfig.Balance,
+			Execution: execution.NewEngine(ctx, executionConfig),
+			Sizer: opts.Sizer,
+			AllowMicro: opts.AllowMicro,
+			Risk: opts.Risk,
+		}
+
+		if runRepository != nil {
+			var names []string
+			for _, def := range portfolioConfig.Strategies {
+				names = append(names, def.Name)
+			}
+			markets, symbols := portfolioConfig.Markets()
+			recorder := runs.NewRecorder(ctx, runRepository, runs.Run{
+				Portfolio: p.Name,
+				Strategy:  strings.Join(names, ","),
+				Params: map[string]any{
+					"strategies":         portfolioConfig.Strategies,
+					"market_fill":        opts.Execution.MarketFill,
+					"intrabar_fallback":  opts.Execution.Fallback,
+					"intrabar_timeframe": opts.Execution.IntrabarTimeframe,
+					"slippage":           fmt.Sprintf("%#v", opts.Execution.Costs.Slippage),
+					"commission":         opts.Execution.Costs.Commission,
+					"sizing":             fmt.Sprintf("%#v", opts.Sizer),
+					"allow_micro":        opts.AllowMicro,
+					"risk":               opts.Risk,
+				},
+				Market:          strings.Join(markets, ","),
+				Symbols:         symbols,
+				StartingBalance: p.Balance,
+			})
+			p.Recorder = recorder
+			recorders = append(recorders, recorder)
+			log.Printf("Recording backtest run %d for %s", recorder.RunID, p.Name)
+		}
+
+		portfolios = append(portfolios, p)
+	}
+
+	pubsub := client.Subscribe(ctx, "control")
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Fatalf("Failed to subscribe to control channel: %v", err)
+	}
+	go handleControlMessages(pubsub.Channel(), portfolios)
+
 	log.Printf("Analysis service listening for candles on redis list 'market' at %s", addr)
 
+	var lastCandle candle.Candle
 	for {
 		values, err := client.BLPop(ctx, 0*time.Second, "market").Result()
 		if err != nil {
 			if errors.Is(err, context.Canceled) || ctx.Err() != nil {
 				log.Printf("Strategy service shutting down: %v", ctx.Err())
+				log.Printf("Candle cache stats: %+v", candleRepository.Stats())
+				for _, recorder := range recorders {
+					recorder.Close()
+				}
+				for _, p := range portfolios {
+					log.Printf("Ambiguous exit resolutions for %s: %v", p.Name, p.Execution.Resolutions())
+					dir := reportDir
+					if len(portfolios) > 1 {
+						dir = filepath.Join(reportDir, p.Name)
+					}
+					report := metrics.Compute(p.Name, p.Balance, p.Positions, p.EquityCurve)
+					if reportCharts && !lastCandle.Timeframe.IsZero() {
+						report.TradeCharts = chart.TradeSVGs(context.Background(), candleRepository, lastCandle.Market, lastCandle.Timeframe, p.Positions, 30)
+					}
+					if err := report.Write(dir); err != nil {
+						log.Printf("Failed to write backtest report for %s: %v", p.Name, err)
+					} else {
+						log.Printf("Backtest report for %s written to %s: net $%.2f over %d trades", p.Name, dir, report.NetPnL, report.Trades)
+					}
+				}
 				return
 			}
 			log.Printf("BLPOP error: %v", err)
@@ -64,9 +175,51 @@ func main() {
 			}
 			// log.Printf("Received candle payload for %s on %s", c.Symbol, c.Timestamp.Format("2006-01-02 15:04:05"))
 
-			portfolio.ProcessCandle(c)
+			for _, p := range portfolios {
+				p.ProcessCandle(c)
+			}
+			lastCandle = c
 			continue
 		}
 		log.Printf("Unexpected BLPOP response: %v", values)
 	}
 }
+
+type ControlMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// KillSwitch flattens and halts the named portfolio, or every portfolio
+// when Portfolio is empty.
+type KillSwitch struct {
+	Portfolio string `json:"portfolio"`
+	Reason    string `json:"reason"`
+}
+
+func handleControlMessages(ch <-chan *redis.Message, portfolios []*portfolio.Portfolio) {
+	for msg := range ch {
+		var controlMessage ControlMessage
+		if err := json.Unmarshal([]byte(msg.Payload), &controlMessage); err != nil {
+			log.Printf("Json unmarshalling failed: %v", err)
+			continue
+		}
+
+		switch controlMessage.Type {
+		case "kill_switch":
+			var kill KillSwitch
+			if err := json.Unmarshal(controlMessage.Data, &kill); err != nil {
+				log.Printf("Json unmarshalling failed: %v", err)
+				continue
+			}
+			for _, p := range portfolios {
+				if kill.Portfolio == "" || kill.Portfolio == p.Name {
+					log.Printf("Kill switch received for %s: %s", p.Name, kill.Reason)
+					p.Kill(kill.Reason)
+				}
+			}
+		default:
+			// Requests for the market service share the control channel.
+		}
+	}
+}
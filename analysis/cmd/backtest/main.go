@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/mgordon34/gostonks/analysis/internal/backtest"
+	"github.com/mgordon34/gostonks/analysis/internal/candlecache"
+	"github.com/mgordon34/gostonks/analysis/internal/chart"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/internal/config"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+func main() {
+	var configPath, portfolioName, symbols, start, end, out string
+	var charts, verbose bool
+	flag.StringVar(&configPath, "config", config.Get("STRATEGY_CONFIG", "analysis/config.json"), "strategy config file")
+	flag.StringVar(&portfolioName, "portfolio", "", "portfolio in the config to run, every portfolio when empty")
+	flag.StringVar(&symbols, "symbols", "", "comma separated symbols to trade instead of the configured ones, e.g. NQZ4")
+	flag.StringVar(&start, "start", "", "start of the range (RFC 3339 or YYYY-MM-DD)")
+	flag.StringVar(&end, "end", "", "end of the range (RFC 3339, or YYYY-MM-DD inclusive)")
+	flag.StringVar(&out, "out", config.Get("REPORT_DIR", "reports"), "directory to write the report to")
+	flag.BoolVar(&charts, "charts", true, "include a chart of every trade in the HTML report")
+	flag.BoolVar(&verbose, "verbose", false, "keep strategy logging while the backtest runs")
+	flag.Parse()
+
+	startTime, endTime, err := backtest.ParseRange(start, end)
+	if err != nil {
+		log.Fatalf("Invalid range: %v", err)
+	}
+	opts, err := backtest.OptionsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid backtest options: %v", err)
+	}
+	strategyConfig, err := portfolio.LoadConfig(configPath)
+	if err != nil {
+		log.Fatalf("Invalid -config: %v", err)
+	}
+	portfolios := strategyConfig.Portfolios
+	if portfolioName != "" {
+		p, err := strategyConfig.Portfolio(portfolioName)
+		if err != nil {
+			log.Fatalf("Invalid -portfolio: %v", err)
+		}
+		portfolios = []portfolio.PortfolioConfig{p}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cacheSize, err := strconv.Atoi(config.Get("CANDLE_CACHE_SIZE", "16"))
+	if err != nil {
+		log.Fatalf("Invalid CANDLE_CACHE_SIZE: %v", err)
+	}
+	repo := candlecache.New(candle.OpenRepository(), cacheSize)
+
+	for _, portfolioConfig := range portfolios {
+		if symbols != "" {
+			portfolioConfig = portfolioConfig.WithSymbols(strings.Split(symbols, ","))
+		}
+		feed, err := backtest.LoadFeed(ctx, repo, portfolioConfig.Strategies, startTime, endTime)
+		if err != nil {
+			log.Fatalf("Failed to load candles for %s: %v", portfolioConfig.Name, err)
+		}
+		log.Printf("Backtesting %s over %d candles from %s to %s", portfolioConfig.Name, len(feed), startTime, endTime)
+
+		logOutput := log.Writer()
+		if !verbose {
+			log.SetOutput(io.Discard)
+		}
+		result, err := backtest.Run(ctx, repo, feed, portfolioConfig, opts)
+		log.SetOutput(logOutput)
+		if err != nil {
+			log.Fatalf("Backtest of %s failed: %v", portfolioConfig.Name, err)
+		}
+		log.Printf("Ambiguous exit resolutions for %s: %v", portfolioConfig.Name, result.Portfolio.Execution.Resolutions())
+
+		report := result.Report
+		if charts {
+			// Chart each trade on the series the feed replayed.
+			last := feed[len(feed)-1]
+			report.TradeCharts = chart.TradeSVGs(ctx, repo, last.Market, last.Timeframe, result.Portfolio.Positions, 30)
+		}
+		dir := out
+		if len(portfolios) > 1 {
+			dir = filepath.Join(out, portfolioConfig.Name)
+		}
+		if err := report.Write(dir); err != nil {
+			log.Fatalf("Failed to write backtest report for %s: %v", portfolioConfig.Name, err)
+		}
+		log.Printf("Backtest report for %s written to %s: net $%.2f over %d trades", portfolioConfig.Name, dir, report.NetPnL, report.Trades)
+	}
+	log.Printf("Candle cache stats: %+v", repo.Stats())
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/backtest"
+	"github.com/mgordon34/gostonks/analysis/internal/chart"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/internal/config"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+func main() {
+	var configPath, portfolioName, market, symbol, timeframe, start, end, format, out string
+	var trades bool
+	var padding int
+	flag.StringVar(&configPath, "config", config.Get("STRATEGY_CONFIG", "analysis/config.json"), "strategy config file")
+	flag.StringVar(&portfolioName, "portfolio", "", "portfolio in the config to replay, required when there is more than one")
+	flag.StringVar(&market, "market", "futures", "market of the candles to chart")
+	flag.StringVar(&symbol, "symbol", "", "symbol of the candles to chart")
+	flag.StringVar(&timeframe, "timeframe", "1m", "timeframe of the candles to chart")
+	flag.StringVar(&start, "start", "", "first timestamp to chart (RFC 3339 or YYYY-MM-DD)")
+	flag.StringVar(&end, "end", "", "last timestamp to chart (RFC 3339 or YYYY-MM-DD, inclusive)")
+	flag.StringVar(&format, "format", "svg", "output format: svg or png")
+	flag.StringVar(&out, "out", "charts", "output file, or directory with -trades")
+	flag.BoolVar(&trades, "trades", false, "chart every trade the strategy takes in the range instead of the whole window")
+	flag.IntVar(&padding, "padding", 30, "bars to show either side of each trade with -trades")
+	flag.Parse()
+
+	tf, err := candle.ParseTimeframe(timeframe)
+	if err != nil {
+		log.Fatalf("Invalid -timeframe: %v", err)
+	}
+	startTime, err := parseTime(start, false)
+	if err != nil {
+		log.Fatalf("Invalid -start: %v", err)
+	}
+	endTime, err := parseTime(end, true)
+	if err != nil {
+		log.Fatalf("Invalid -end: %v", err)
+	}
+	if format != "svg" && format != "png" {
+		log.Fatalf("Invalid -format %q: want svg or png", format)
+	}
+	opts, err := backtest.OptionsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid backtest options: %v", err)
+	}
+	strategyConfig, err := portfolio.LoadConfig(configPath)
+	if err != nil {
+		log.Fatalf("Invalid -config: %v", err)
+	}
+	portfolioConfig, err := strategyConfig.Portfolio(portfolioName)
+	if err != nil {
+		log.Fatalf("Invalid -portfolio: %v", err)
+	}
+	portfolioConfig = portfolioConfig.WithSymbols([]string{symbol})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repo := candle.OpenRepository()
+	candles := repo.GetCandles(ctx, market, symbol, tf, startTime, endTime)
+	if len(candles) == 0 {
+		log.Fatalf("No %s %s candles between %s and %s", symbol, tf, startTime, endTime)
+	}
+
+	// Replay the configured portfolio over the window so its pools, gaps
+	// and trades can be drawn.
+	logOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	result, err := backtest.Run(ctx, repo, candles, portfolioConfig, opts)
+	log.SetOutput(logOutput)
+	if err != nil {
+		log.Fatalf("Replay of %s failed: %v", portfolioConfig.Name, err)
+	}
+	p := result.Portfolio
+
+	if !trades {
+		var gaps []strategy.FairValueGap
+		var pools []strategy.LiquidityPool
+		for _, s := range p.Strategies {
+			if bars, ok := s.(*strategy.BarStrategy); ok {
+				gaps = append(gaps, bars.Gaps.Gaps()...)
+				pools = append(pools, bars.Pools.GetPools(true)...)
+				pools = append(pools, bars.Pools.GetPools(false)...)
+				if generated, ok := bars.Generated[symbol]; ok {
+					pools = append(pools, generated.GetPools(true)...)
+					pools = append(pools, generated.GetPools(false)...)
+				}
+			}
+		}
+		window := &chart.Chart{
+			Title:     fmt.Sprintf("%s %s %s to %s", symbol, tf, startTime.Format(time.DateTime), endTime.Format(time.DateTime)),
+			Candles:   candles,
+			Gaps:      gaps,
+			Pools:     pools,
+			Sessions:  chart.Sessions(startTime, endTime),
+			Positions: p.Positions,
+		}
+		if err := write(window, format, out); err != nil {
+			log.Fatalf("Failed to write chart: %v", err)
+		}
+		log.Printf("Charted %d candles to %s", len(candles), out)
+		return
+	}
+
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		log.Fatalf("Failed to create %s: %v", out, err)
+	}
+	var written int
+	for i, pos := range p.Positions {
+		if pos.Status != position.PositionClosed {
+			continue
+		}
+		trade := chart.ForPosition(pos, chart.TradeCandles(ctx, repo, market, tf, pos, padding))
+		name := fmt.Sprintf("%03d_%s.%s", i+1, pos.EnterTime.Format("20060102_1504"), format)
+		if err := write(trade, format, filepath.Join(out, name)); err != nil {
+			log.Fatalf("Failed to write chart: %v", err)
+		}
+		written++
+	}
+	log.Printf("Charted %d trades to %s", written, out)
+}
+
+func write(c *chart.Chart, format string, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if format == "png" {
+		return c.WritePNG(f)
+	}
+	return c.WriteSVG(f)
+}
+
+// parseTime accepts RFC 3339 timestamps or bare dates. A bare end date
+// covers the whole day.
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/mgordon34/gostonks/analysis/internal/metrics"
+	"github.com/mgordon34/gostonks/analysis/internal/montecarlo"
+)
+
+func main() {
+	var reportPath, method, out string
+	var simulations int
+	var seed uint64
+	var skip, slippageTicks, trailingDrawdown float64
+	flag.StringVar(&reportPath, "report", "reports/report.json", "report.json of the run whose trades to resample")
+	flag.StringVar(&method, "method", string(montecarlo.Bootstrap), "resampling method: bootstrap or shuffle")
+	flag.IntVar(&simulations, "simulations", 10000, "number of trade sequences to simulate")
+	flag.Uint64Var(&seed, "seed", 1, "random seed")
+	flag.Float64Var(&skip, "skip", 0, "probability of skipping each trade")
+	flag.Float64Var(&slippageTicks, "slippage-ticks", 0, "up to this many extra ticks of slippage per side of each trade")
+	flag.Float64Var(&trailingDrawdown, "trailing-drawdown", 0, "trailing drawdown limit in dollars to test against, e.g. 2500")
+	flag.StringVar(&out, "out", "", "file to write the results to, montecarlo.json next to the report by default")
+	flag.Parse()
+
+	resampling, err := montecarlo.ParseMethod(method)
+	if err != nil {
+		log.Fatalf("Invalid -method: %v", err)
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		log.Fatalf("Failed to read report: %v", err)
+	}
+	var report metrics.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		log.Fatalf("Failed to parse report %s: %v", reportPath, err)
+	}
+
+	result, err := montecarlo.Run(report.TradeLog, montecarlo.Config{
+		Method:           resampling,
+		Simulations:      simulations,
+		Seed:             seed,
+		StartingEquity:   report.StartingEquity,
+		SkipProbability:  skip,
+		SlippageTicks:    slippageTicks,
+		TrailingDrawdown: trailingDrawdown,
+	})
+	if err != nil {
+		log.Fatalf("Monte Carlo failed: %v", err)
+	}
+
+	if out == "" {
+		out = filepath.Join(filepath.Dir(reportPath), "montecarlo.json")
+	}
+	data, err = json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to marshal results: %v", err)
+	}
+	if err := os.WriteFile(out, data, 0o644); err != nil {
+		log.Fatalf("Failed to write results: %v", err)
+	}
+
+	log.Printf("%d %s simulations of %d trades", result.Simulations, result.Method, result.Trades)
+	log.Printf("Final equity: p5 $%.2f, median $%.2f, p95 $%.2f", result.FinalEquity.P5, result.FinalEquity.P50, result.FinalEquity.P95)
+	log.Printf("Max drawdown: median $%.2f, p95 $%.2f", result.MaxDrawdown.P50, result.MaxDrawdown.P95)
+	log.Printf("Probability of loss %.1f%%, of breaching the trailing drawdown %.1f%%", result.ProbabilityOfLoss*100, result.ProbabilityOfBreach*100)
+	log.Printf("Results written to %s", out)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/internal/backtest"
+	"github.com/mgordon34/gostonks/analysis/internal/candlecache"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/internal/config"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// params collects repeated -param flags.
+type params []backtest.Param
+
+func (p *params) String() string {
+	return strconv.Itoa(len(*p)) + " params"
+}
+
+func (p *params) Set(value string) error {
+	param, err := backtest.ParseParam(value)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, param)
+	return nil
+}
+
+func main() {
+	var configPath, portfolioName, strategyName, symbols, start, end, objective, out string
+	var search params
+	var random, workers, minTrades, inSampleDays, outOfSampleDays int
+	var anchored bool
+	var seed uint64
+	var verbose bool
+	flag.StringVar(&configPath, "config", config.Get("STRATEGY_CONFIG", "analysis/config.json"), "strategy config file")
+	flag.StringVar(&portfolioName, "portfolio", "", "portfolio in the config to optimize, required when there are several")
+	flag.StringVar(&strategyName, "strategy", "", "strategy in the portfolio to optimize, required when there are several")
+	flag.StringVar(&symbols, "symbols", "", "comma separated symbols to trade instead of the configured ones, e.g. NQZ4")
+	flag.StringVar(&start, "start", "", "start of the range (RFC 3339 or YYYY-MM-DD)")
+	flag.StringVar(&end, "end", "", "end of the range (RFC 3339, or YYYY-MM-DD inclusive)")
+	flag.Var(&search, "param", "param to search, name=v1,v2,... or name=min:max:step; repeatable")
+	flag.IntVar(&random, "random", 0, "sample this many random points of the grid instead of running all of it")
+	flag.Uint64Var(&seed, "seed", 1, "seed for -random")
+	flag.StringVar(&objective, "objective", string(backtest.Expectancy), "metric to rank by: expectancy, profit_factor, sharpe or net_pnl")
+	flag.IntVar(&workers, "workers", 0, "backtests to run at once, GOMAXPROCS when zero")
+	flag.IntVar(&minTrades, "min-trades", 10, "rank results with fewer trades last")
+	flag.StringVar(&out, "out", "optimize", "directory to write results.csv and results.json to")
+	flag.IntVar(&inSampleDays, "in-sample-days", 0, "walk forward: days to optimize on before each out-of-sample window")
+	flag.IntVar(&outOfSampleDays, "out-of-sample-days", 0, "walk forward: days to test the winning params on")
+	flag.BoolVar(&anchored, "anchored", false, "walk forward: grow in-sample windows from the start of the range instead of rolling them")
+	flag.BoolVar(&verbose, "verbose", false, "keep strategy logging while the backtests run")
+	flag.Parse()
+
+	startTime, endTime, err := backtest.ParseRange(start, end)
+	if err != nil {
+		log.Fatalf("Invalid range: %v", err)
+	}
+	rank, err := backtest.ParseObjective(objective)
+	if err != nil {
+		log.Fatalf("Invalid -objective: %v", err)
+	}
+	if len(search) == 0 {
+		log.Fatalf("Nothing to optimize: pass at least one -param")
+	}
+	opts, err := backtest.OptionsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid backtest options: %v", err)
+	}
+	strategyConfig, err := portfolio.LoadConfig(configPath)
+	if err != nil {
+		log.Fatalf("Invalid -config: %v", err)
+	}
+	portfolioConfig, err := strategyConfig.Portfolio(portfolioName)
+	if err != nil {
+		log.Fatalf("Invalid -portfolio: %v", err)
+	}
+	if symbols != "" {
+		portfolioConfig = portfolioConfig.WithSymbols(strings.Split(symbols, ","))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repo := candlecache.New(candle.OpenRepository(), 64)
+	feed, err := backtest.LoadFeed(ctx, repo, portfolioConfig.Strategies, startTime, endTime)
+	if err != nil {
+		log.Fatalf("Failed to load candles: %v", err)
+	}
+	log.Printf("Optimizing %s over %d candles from %s to %s", portfolioConfig.Name, len(feed), startTime, endTime)
+
+	logOutput := log.Writer()
+	if !verbose {
+		log.SetOutput(io.Discard)
+	}
+	searchConfig := backtest.Search{
+		Strategy:  strategyName,
+		Params:    search,
+		Objective: rank,
+		Random:    random,
+		Seed:      seed,
+		Workers:   workers,
+		MinTrades: minTrades,
+	}
+
+	if inSampleDays > 0 || outOfSampleDays > 0 {
+		walk := backtest.WalkForward{
+			InSample:    time.Duration(inSampleDays) * 24 * time.Hour,
+			OutOfSample: time.Duration(outOfSampleDays) * 24 * time.Hour,
+			Anchored:    anchored,
+		}
+		result, err := backtest.RunWalkForward(ctx, repo, feed, portfolioConfig, searchConfig, walk, startTime, endTime, opts)
+		log.SetOutput(logOutput)
+		if err != nil {
+			log.Fatalf("Walk-forward failed: %v", err)
+		}
+
+		if err := backtest.WriteWalkForward(out, result); err != nil {
+			log.Fatalf("Failed to write walk-forward results: %v", err)
+		}
+		for i, window := range result.Windows {
+			log.Printf("Window %d %s to %s: in-sample $%.2f, out-of-sample $%.2f over %d trades with %v", i+1, window.OutStart.Format(time.DateOnly), window.OutEnd.Format(time.DateOnly), window.InSample.NetPnL, window.OutOfSample.NetPnL, window.OutOfSample.Trades, window.Params)
+		}
+		log.Printf("Walk-forward efficiency %.2f, %d of %d windows profitable, out-of-sample net $%.2f; wrote %s", result.Efficiency, result.ProfitableWindows, len(result.Windows), result.Report.NetPnL, out)
+		return
+	}
+
+	trials, err := backtest.Optimize(ctx, repo, feed, portfolioConfig, searchConfig, opts)
+	log.SetOutput(logOutput)
+	if err != nil {
+		log.Fatalf("Optimization failed: %v", err)
+	}
+
+	if err := backtest.WriteResults(out, trials); err != nil {
+		log.Fatalf("Failed to write results: %v", err)
+	}
+	for i, trial := range trials[:min(5, len(trials))] {
+		log.Printf("#%d %s %.2f over %d trades: %v", i+1, rank, trial.Score, trial.Report.Trades, trial.Params)
+	}
+	log.Printf("Wrote %d results to %s", len(trials), out)
+}
@@ -1,6 +1,7 @@
 package position
 
 import (
+	"math"
 	"time"
 
 	"github.com/mgordon34/gostonks/analysis/internal/strategy"
@@ -9,24 +10,111 @@ import (
 type PositionStatus string
 
 const (
-	PositionPending PositionStatus = "pending"
-	PositionOpen PositionStatus = "open"
-	PositionClosed PositionStatus = "closed"
+	PositionPending   PositionStatus = "pending"
+	PositionOpen      PositionStatus = "open"
+	PositionClosed    PositionStatus = "closed"
 	PositionCancelled PositionStatus = "cancelled"
 )
 
+type ExitReason string
+
+const (
+	ExitStopLoss   ExitReason = "stop_loss"
+	ExitTakeProfit ExitReason = "take_profit"
+	ExitExpired    ExitReason = "expired"
+	ExitFlattened  ExitReason = "flattened"
+)
+
 type Position struct {
-	Action	 	strategy.Action
-	Type 		strategy.OrderType
-	EnterPrice	float64
-	StopLoss	float64
-	TakeProfit	float64
-	ExitPrice	float64
-	Status 		PositionStatus
-	Timestamp	time.Time
-	CancelTime	time.Time
+	Symbol     string
+	Contract   string
+	Quantity   int
+	Action     strategy.Action
+	Type       strategy.OrderType
+	EnterPrice float64
+	StopLoss   float64
+	TakeProfit float64
+	ExitPrice  float64
+	Status     PositionStatus
+	ExitReason ExitReason
+	Timestamp  time.Time
+	CancelTime time.Time
+	EnterTime  time.Time
+	ExitTime   time.Time
+
+	// Trading costs: slippage in points on each fill, commission and
+	// exchange/NFA fees in dollars across both sides.
+	EntrySlippage float64
+	ExitSlippage  float64
+	Commission    float64
+	Fees          float64
+
+	// Context is why the signal behind the position fired, when the
+	// strategy recorded it.
+	Context *strategy.SignalContext
+
+	// MAE and MFE are the largest adverse and favorable moves in points
+	// from the entry while the position was open.
+	MAE float64
+	MFE float64
 }
 
 func (p *Position) IsOpen() bool {
 	return p.Status == PositionPending || p.Status == PositionOpen
 }
+
+func (p *Position) IsLong() bool {
+	return p.Action == strategy.BuyAction
+}
+
+// TradedSymbol is the contract actually traded, which differs from Symbol
+// when a position on one feed is sized in another contract, such as micros.
+func (p *Position) TradedSymbol() string {
+	if p.Contract != "" {
+		return p.Contract
+	}
+	return p.Symbol
+}
+
+// Direction is 1 for longs and -1 for shorts.
+func (p *Position) Direction() float64 {
+	if p.IsLong() {
+		return 1
+	}
+	return -1
+}
+
+// Points returns the price move captured by the position if it were closed
+// at price.
+func (p *Position) Points(price float64) float64 {
+	return (price - p.EnterPrice) * p.Direction()
+}
+
+// Excursion widens MAE and MFE to cover a bar that traded between high and
+// low while the position was open.
+func (p *Position) Excursion(high, low float64) {
+	best, worst := p.Points(high), p.Points(low)
+	if !p.IsLong() {
+		best, worst = worst, best
+	}
+	p.MFE = max(p.MFE, best)
+	p.MAE = max(p.MAE, -worst)
+}
+
+// Setup names the kind of setup the position was taken on, if known.
+func (p *Position) Setup() string {
+	if p.Context == nil {
+		return ""
+	}
+	return p.Context.Setup
+}
+
+// RMultiple is the closed position's result in units of its initial risk,
+// the distance from entry to stop. It is zero when there was no stop.
+func (p *Position) RMultiple() float64 {
+	risk := math.Abs(p.EnterPrice - p.StopLoss)
+	if p.StopLoss == 0 || risk == 0 {
+		return 0
+	}
+	return p.Points(p.ExitPrice) / risk
+}
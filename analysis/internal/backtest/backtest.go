@@ -0,0 +1,125 @@
+// Package backtest replays historical candles through portfolios in
+// process, for single runs and for parameter searches over many runs.
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/internal/execution"
+	"github.com/mgordon34/gostonks/analysis/internal/metrics"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// Options are the settings shared by every run of a backtest, besides the
+// portfolio config under test.
+type Options struct {
+	// Execution configures each run's engine. Intrabar defaults to the
+	// repository the run reads from.
+	Execution  execution.Config
+	Sizer      portfolio.Sizer
+	AllowMicro bool
+	Risk       portfolio.RiskLimits
+	// Recorder, if set, sees every signal, order, position and equity point
+	// of a run. Searches share their options across runs, so leave it nil
+	// for them.
+	Recorder portfolio.Recorder
+}
+
+// Feed is the candles a backtest replays, in time order.
+type Feed []candle.Candle
+
+// LoadFeed reads every series the strategies trade from start up to, but not
+// including, end and merges them in time order.
+func LoadFeed(ctx context.Context, repo candle.Repository, defs []strategy.Definition, start time.Time, end time.Time) (Feed, error) {
+	type series struct {
+		market    string
+		symbol    string
+		timeframe candle.Timeframe
+	}
+
+	seen := make(map[series]bool)
+	var feed Feed
+	for _, def := range defs {
+		if def.Timeframe.IsZero() {
+			return nil, fmt.Errorf("strategy %s: a timeframe is required to backtest", def.Name)
+		}
+		for _, symbol := range def.Symbols {
+			s := series{def.Market, symbol, def.Timeframe}
+			if seen[s] {
+				continue
+			}
+			seen[s] = true
+
+			candles := repo.GetCandles(ctx, s.market, s.symbol, s.timeframe, start, end)
+			if len(candles) == 0 {
+				return nil, fmt.Errorf("no %s %s candles for %s between %s and %s", s.timeframe, s.market, s.symbol, start.Format(time.DateOnly), end.Format(time.DateOnly))
+			}
+			feed = append(feed, candles...)
+		}
+	}
+
+	sort.SliceStable(feed, func(i, j int) bool {
+		return feed[i].Timestamp.Before(feed[j].Timestamp)
+	})
+	return feed.Slice(start, end), nil
+}
+
+// Slice returns the candles from start up to, but not including, end.
+func (f Feed) Slice(start time.Time, end time.Time) Feed {
+	lo := sort.Search(len(f), func(i int) bool {
+		return !f[i].Timestamp.Before(start)
+	})
+	hi := sort.Search(len(f), func(i int) bool {
+		return !f[i].Timestamp.Before(end)
+	})
+	if lo >= hi {
+		return nil
+	}
+	return f[lo:hi]
+}
+
+type Result struct {
+	Portfolio *portfolio.Portfolio
+	Report    metrics.Report
+}
+
+// Run builds the portfolio described by config and replays feed through it.
+// Strategies pull their lookback history from repo as they would live.
+func Run(ctx context.Context, repo candle.Repository, feed Feed, config portfolio.PortfolioConfig, opts Options) (Result, error) {
+	strategies, err := config.NewStrategies(ctx, repo)
+	if err != nil {
+		return Result{}, err
+	}
+
+	executionConfig := opts.Execution
+	if executionConfig.Intrabar == nil {
+		executionConfig.Intrabar = repo
+	}
+	p := &portfolio.Portfolio{
+		Name:       config.Name,
+		Strategies: strategies,
+		Balance:    config.Balance,
+		Execution:  execution.NewEngine(ctx, executionConfig),
+		Sizer:      opts.Sizer,
+		AllowMicro: opts.AllowMicro,
+		Risk:       opts.Risk,
+		Recorder:   opts.Recorder,
+	}
+
+	for _, c := range feed {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		p.ProcessCandle(c)
+	}
+
+	return Result{
+		Portfolio: p,
+		Report:    metrics.Compute(config.Name, config.Balance, p.Positions, p.EquityCurve),
+	}, nil
+}
@@ -0,0 +1,105 @@
+package backtest
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/internal/execution"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/internal/config"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// OptionsFromEnv reads execution, sizing and risk settings from the same
+// environment variables as the analysis service, so a backtest trades like
+// the service would.
+func OptionsFromEnv() (Options, error) {
+	var opts Options
+	var err error
+
+	if opts.Execution.MarketFill, err = execution.ParseMarketFill(config.Get("MARKET_FILL", string(execution.NextBarOpen))); err != nil {
+		return opts, fmt.Errorf("invalid MARKET_FILL: %w", err)
+	}
+	if opts.Execution.Fallback, err = execution.ParseFallback(config.Get("INTRABAR_FALLBACK", string(execution.ResolvedPessimistic))); err != nil {
+		return opts, fmt.Errorf("invalid INTRABAR_FALLBACK: %w", err)
+	}
+	if opts.Execution.IntrabarTimeframe, err = candle.ParseTimeframe(config.Get("INTRABAR_TIMEFRAME", "1s")); err != nil {
+		return opts, fmt.Errorf("invalid INTRABAR_TIMEFRAME: %w", err)
+	}
+	if opts.Execution.Costs.Slippage, err = execution.ParseSlippage(config.Get("SLIPPAGE", "fixed:1")); err != nil {
+		return opts, fmt.Errorf("invalid SLIPPAGE: %w", err)
+	}
+	if opts.Execution.Costs.Commission, err = strconv.ParseFloat(config.Get("COMMISSION", "0.5"), 64); err != nil {
+		return opts, fmt.Errorf("invalid COMMISSION: %w", err)
+	}
+
+	if opts.Sizer, err = portfolio.ParseSizer(config.Get("SIZING", "fixed:1")); err != nil {
+		return opts, fmt.Errorf("invalid SIZING: %w", err)
+	}
+	if kelly := config.Get("KELLY_CAP", ""); kelly != "" {
+		fraction, err := strconv.ParseFloat(kelly, 64)
+		if err != nil {
+			return opts, fmt.Errorf("invalid KELLY_CAP: %w", err)
+		}
+		opts.Sizer = portfolio.KellyCap{Sizer: opts.Sizer, Fraction: fraction, MinTrades: 20}
+	}
+	if opts.AllowMicro, err = strconv.ParseBool(config.Get("ALLOW_MICRO", "false")); err != nil {
+		return opts, fmt.Errorf("invalid ALLOW_MICRO: %w", err)
+	}
+
+	ints := map[string]*int{
+		"MAX_POSITIONS_PER_SYMBOL": &opts.Risk.MaxPositionsPerSymbol,
+		"MAX_POSITIONS":            &opts.Risk.MaxPositions,
+		"MAX_TRADES_PER_SESSION":   &opts.Risk.MaxTradesPerSession,
+	}
+	for key, value := range ints {
+		if *value, err = strconv.Atoi(config.Get(key, "0")); err != nil {
+			return opts, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	floats := map[string]*float64{
+		"DAILY_LOSS_LIMIT":  &opts.Risk.DailyLossLimit,
+		"TRAILING_DRAWDOWN": &opts.Risk.TrailingDrawdown,
+	}
+	for key, value := range floats {
+		if *value, err = strconv.ParseFloat(config.Get(key, "0"), 64); err != nil {
+			return opts, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	if cooldown := config.Get("LOSS_COOLDOWN", ""); cooldown != "" {
+		if opts.Risk.LossCooldown, err = time.ParseDuration(cooldown); err != nil {
+			return opts, fmt.Errorf("invalid LOSS_COOLDOWN: %w", err)
+		}
+	}
+
+	return opts, nil
+}
+
+// ParseRange reads a backtest's date range from RFC 3339 timestamps or bare
+// dates. The range ends before end, and a bare end date covers that whole
+// day.
+func ParseRange(start string, end string) (time.Time, time.Time, error) {
+	startTime, err := parseTime(start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start: %w", err)
+	}
+	endTime, err := parseTime(end)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end: %w", err)
+	}
+	if _, err := time.Parse(time.DateOnly, end); err == nil {
+		endTime = endTime.AddDate(0, 0, 1)
+	}
+	if !endTime.After(startTime) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end %s is not after start %s", end, start)
+	}
+	return startTime, endTime, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,278 @@
+package backtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/mgordon34/gostonks/analysis/internal/metrics"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// Objective is the report figure a search ranks its trials by.
+type Objective string
+
+const (
+	Expectancy   Objective = "expectancy"
+	ProfitFactor Objective = "profit_factor"
+	Sharpe       Objective = "sharpe"
+	NetPnL       Objective = "net_pnl"
+)
+
+func ParseObjective(value string) (Objective, error) {
+	switch objective := Objective(value); objective {
+	case Expectancy, ProfitFactor, Sharpe, NetPnL:
+		return objective, nil
+	}
+	return "", fmt.Errorf("unknown objective %q, one of %s, %s, %s, %s", value, Expectancy, ProfitFactor, Sharpe, NetPnL)
+}
+
+func (o Objective) Score(report metrics.Report) float64 {
+	switch o {
+	case ProfitFactor:
+		return report.ProfitFactor
+	case Sharpe:
+		return report.Sharpe
+	case NetPnL:
+		return report.NetPnL
+	default:
+		return report.Expectancy
+	}
+}
+
+// Param is one dimension of a search: a strategy param and the values to
+// try for it.
+type Param struct {
+	Name   string `json:"name"`
+	Values []any  `json:"values"`
+}
+
+// ParseParam reads a param from name=v1,v2,... or name=min:max:step, where
+// the bounds are numbers or durations such as 60m:180m:30m.
+func ParseParam(value string) (Param, error) {
+	name, spec, ok := strings.Cut(value, "=")
+	if !ok || name == "" || spec == "" {
+		return Param{}, fmt.Errorf("invalid param %q, want name=v1,v2 or name=min:max:step", value)
+	}
+	param := Param{Name: name}
+
+	if bounds := strings.Split(spec, ":"); len(bounds) == 3 {
+		values, err := parseRange(bounds[0], bounds[1], bounds[2])
+		if err != nil {
+			return Param{}, fmt.Errorf("invalid range for %s: %w", name, err)
+		}
+		param.Values = values
+		return param, nil
+	}
+
+	for _, v := range strings.Split(spec, ",") {
+		if number, err := strconv.ParseFloat(v, 64); err == nil {
+			param.Values = append(param.Values, number)
+		} else {
+			param.Values = append(param.Values, v)
+		}
+	}
+	return param, nil
+}
+
+func parseRange(minValue string, maxValue string, stepValue string) ([]any, error) {
+	var values []any
+	if lo, err := strconv.ParseFloat(minValue, 64); err == nil {
+		hi, err := strconv.ParseFloat(maxValue, 64)
+		if err != nil {
+			return nil, err
+		}
+		step, err := strconv.ParseFloat(stepValue, 64)
+		if err != nil {
+			return nil, err
+		}
+		if step <= 0 || hi < lo {
+			return nil, fmt.Errorf("empty range %s:%s:%s", minValue, maxValue, stepValue)
+		}
+		// Count steps rather than accumulate so 0.1 steps do not drift.
+		for i := 0; lo+float64(i)*step <= hi+step/1e9; i++ {
+			values = append(values, lo+float64(i)*step)
+		}
+		return values, nil
+	}
+
+	lo, err := time.ParseDuration(minValue)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := time.ParseDuration(maxValue)
+	if err != nil {
+		return nil, err
+	}
+	step, err := time.ParseDuration(stepValue)
+	if err != nil {
+		return nil, err
+	}
+	if step <= 0 || hi < lo {
+		return nil, fmt.Errorf("empty range %s:%s:%s", minValue, maxValue, stepValue)
+	}
+	for d := lo; d <= hi; d += step {
+		values = append(values, d.String())
+	}
+	return values, nil
+}
+
+// Search describes a parameter search over one strategy of a portfolio.
+type Search struct {
+	// Strategy names the strategy whose params vary, and may be empty when
+	// the portfolio has only one.
+	Strategy  string
+	Params    []Param
+	Objective Objective
+	// Random samples that many distinct points instead of the full grid.
+	Random int
+	Seed   uint64
+	// Workers caps the runs in flight, GOMAXPROCS when zero.
+	Workers int
+	// MinTrades ranks trials with fewer closed trades below every other.
+	MinTrades int
+}
+
+// Trial is one point of a search and how the portfolio did with it. Its
+// report has no trade log or equity curve, to keep large searches small.
+type Trial struct {
+	Params map[string]any `json:"params"`
+	Score  float64        `json:"score"`
+	Report metrics.Report `json:"report"`
+}
+
+// Optimize runs the portfolio over feed at every point of search, in
+// parallel, and returns the trials best first.
+func Optimize(ctx context.Context, repo candle.Repository, feed Feed, config portfolio.PortfolioConfig, search Search, opts Options) ([]Trial, error) {
+	target, err := search.target(config)
+	if err != nil {
+		return nil, err
+	}
+	points := search.points()
+
+	workers := search.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	trials := make([]Trial, len(points))
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(workers)
+	for i, point := range points {
+		group.Go(func() error {
+			trialConfig, err := withParams(config, target, point)
+			if err != nil {
+				return err
+			}
+			result, err := Run(ctx, repo, feed, trialConfig, opts)
+			if err != nil {
+				return fmt.Errorf("params %v: %w", point, err)
+			}
+
+			report := result.Report
+			report.TradeLog = nil
+			report.EquityCurve = nil
+			trials[i] = Trial{Params: point, Score: search.Objective.Score(report), Report: report}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(trials, func(i, j int) bool {
+		iEligible := trials[i].Report.Trades >= search.MinTrades
+		jEligible := trials[j].Report.Trades >= search.MinTrades
+		if iEligible != jEligible {
+			return iEligible
+		}
+		return trials[i].Score > trials[j].Score
+	})
+	return trials, nil
+}
+
+// target returns the index of the strategy the search varies.
+func (s Search) target(config portfolio.PortfolioConfig) (int, error) {
+	if s.Strategy == "" {
+		if len(config.Strategies) != 1 {
+			return 0, fmt.Errorf("portfolio %s has %d strategies, name the one to optimize", config.Name, len(config.Strategies))
+		}
+		return 0, nil
+	}
+	for i, def := range config.Strategies {
+		if def.Name == s.Strategy {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("portfolio %s has no strategy named %s", config.Name, s.Strategy)
+}
+
+// points returns the full grid in order, or Random distinct points drawn
+// from it.
+func (s Search) points() []map[string]any {
+	size := 1
+	for _, param := range s.Params {
+		size *= len(param.Values)
+	}
+	if s.Random <= 0 || s.Random >= size {
+		points := make([]map[string]any, size)
+		for i := range points {
+			points[i] = s.point(i)
+		}
+		return points
+	}
+
+	rng := rand.New(rand.NewPCG(s.Seed, s.Seed))
+	indexes := rng.Perm(size)[:s.Random]
+	sort.Ints(indexes)
+	points := make([]map[string]any, len(indexes))
+	for i, index := range indexes {
+		points[i] = s.point(index)
+	}
+	return points
+}
+
+// point decodes a grid index, with the last param varying fastest.
+func (s Search) point(index int) map[string]any {
+	point := make(map[string]any, len(s.Params))
+	for i := len(s.Params) - 1; i >= 0; i-- {
+		values := s.Params[i].Values
+		point[s.Params[i].Name] = values[index%len(values)]
+		index /= len(values)
+	}
+	return point
+}
+
+// withParams copies config with point overlaid on the params of strategy
+// target.
+func withParams(config portfolio.PortfolioConfig, target int, point map[string]any) (portfolio.PortfolioConfig, error) {
+	def := config.Strategies[target]
+	params := make(map[string]any)
+	if len(def.Params) > 0 {
+		if err := json.Unmarshal(def.Params, &params); err != nil {
+			return config, fmt.Errorf("strategy %s params: %w", def.Name, err)
+		}
+	}
+	for name, value := range point {
+		params[name] = value
+	}
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return config, err
+	}
+	def.Params = raw
+
+	config.Strategies = append(config.Strategies[:0:0], config.Strategies...)
+	config.Strategies[target] = def
+	return config, nil
+}
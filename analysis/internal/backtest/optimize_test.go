@@ -0,0 +1,113 @@
+package backtest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseParam(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Param
+		wantErr bool
+	}{
+		{spec: "r_multiple=1,1.5,2", want: Param{Name: "r_multiple", Values: []any{1.0, 1.5, 2.0}}},
+		{spec: "raid_pools=session,previous_day", want: Param{Name: "raid_pools", Values: []any{"session", "previous_day"}}},
+		{spec: "r_multiple=1:2:0.5", want: Param{Name: "r_multiple", Values: []any{1.0, 1.5, 2.0}}},
+		// Steps are counted, so a tenth does not drift past the maximum.
+		{spec: "risk=0.1:0.3:0.1", want: Param{Name: "risk", Values: []any{0.1, 0.2, 0.3}}},
+		{spec: "max_raid_age=5:5:1", want: Param{Name: "max_raid_age", Values: []any{5.0}}},
+		{spec: "cancel_after=30m:1h:15m", want: Param{Name: "cancel_after", Values: []any{"30m0s", "45m0s", "1h0m0s"}}},
+		{spec: "r_multiple", wantErr: true},
+		{spec: "=1,2", wantErr: true},
+		{spec: "r_multiple=", wantErr: true},
+		{spec: "r_multiple=1:x:1", wantErr: true},
+		{spec: "r_multiple=1:2:x", wantErr: true},
+		{spec: "cancel_after=30m:1h:x", wantErr: true},
+		{spec: "r_multiple=1:3:0", wantErr: true},
+		{spec: "r_multiple=1:3:-1", wantErr: true},
+		{spec: "cancel_after=30m:1h:0s", wantErr: true},
+		{spec: "r_multiple=3:1:1", wantErr: true},
+		{spec: "cancel_after=1h:30m:15m", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseParam(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseParam(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !sameParam(got, tt.want) {
+			t.Errorf("ParseParam(%q) = %#v, want %#v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestSearchPoints(t *testing.T) {
+	r := Param{Name: "r_multiple", Values: []any{1.0, 2.0, 3.0}}
+	age := Param{Name: "max_raid_age", Values: []any{5.0, 10.0}}
+	grid := []map[string]any{
+		{"r_multiple": 1.0, "max_raid_age": 5.0},
+		{"r_multiple": 1.0, "max_raid_age": 10.0},
+		{"r_multiple": 2.0, "max_raid_age": 5.0},
+		{"r_multiple": 2.0, "max_raid_age": 10.0},
+		{"r_multiple": 3.0, "max_raid_age": 5.0},
+		{"r_multiple": 3.0, "max_raid_age": 10.0},
+	}
+
+	tests := []struct {
+		name   string
+		search Search
+		want   []map[string]any
+	}{
+		{"the last param varies fastest", Search{Params: []Param{r, age}}, grid},
+		{"no params is one run with the defaults", Search{}, []map[string]any{{}}},
+		{"a sample as big as the grid is the grid", Search{Params: []Param{r, age}, Random: 6}, grid},
+		{"a sample bigger than the grid is the grid", Search{Params: []Param{r, age}, Random: 10}, grid},
+	}
+	for _, tt := range tests {
+		if got := tt.search.points(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: points = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// A random sample is distinct grid points in grid order, the same for
+	// the same seed.
+	sample := Search{Params: []Param{r, age}, Random: 4, Seed: 7}
+	got := sample.points()
+	if len(got) != 4 {
+		t.Fatalf("sampled %d points, want 4", len(got))
+	}
+	next := 0
+	for _, point := range got {
+		for next < len(grid) && !reflect.DeepEqual(grid[next], point) {
+			next++
+		}
+		if next == len(grid) {
+			t.Fatalf("sample %v is not distinct grid points in order", got)
+		}
+		next++
+	}
+	if again := sample.points(); !reflect.DeepEqual(again, got) {
+		t.Errorf("seed %d sampled %v, then %v", sample.Seed, got, again)
+	}
+}
+
+// sameParam compares params, allowing float values to differ by rounding.
+func sameParam(got, want Param) bool {
+	if got.Name != want.Name || len(got.Values) != len(want.Values) {
+		return false
+	}
+	for i := range got.Values {
+		g, gok := got.Values[i].(float64)
+		w, wok := want.Values[i].(float64)
+		if gok && wok {
+			if math.Abs(g-w) > 1e-9 {
+				return false
+			}
+		} else if got.Values[i] != want.Values[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,363 @@
+package backtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/execution"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// fixture is two sessions of NQZ4 1m candles, plus the day before for
+// lookback, extracted from the Databento files in data/.
+const fixture = "testdata/nqz4-1m-20241007.csv"
+
+// replay is everything a run did, in the order it happened.
+type replay struct {
+	Signals []recordedSignal `json:"signals"`
+	// Positions are left out of higher timeframe cases, whose signals and
+	// summary already show what they traded.
+	Positions []*position.Position `json:"positions,omitempty"`
+	Summary   summary              `json:"summary"`
+	Higher    []higherTimeframe    `json:"higher,omitempty"`
+	// Pools are the generated pools left on the last day, active and raided.
+	Pools []strategy.LiquidityPool `json:"pools,omitempty"`
+	// Breaks is the base timeframe's structure, for cases that ask for it.
+	Breaks []structureBreak `json:"breaks,omitempty"`
+	// Zones are the base timeframe's blocks and the last day's balanced
+	// price ranges, for cases that ask for structure.
+	Zones []zone `json:"zones,omitempty"`
+}
+
+type zone struct {
+	Kind      string              `json:"kind"`
+	Direction strategy.Direction  `json:"direction"`
+	Low       float64             `json:"low"`
+	High      float64             `json:"high"`
+	Candle    time.Time           `json:"candle"`
+	Formed    time.Time           `json:"formed"`
+	State     strategy.ZoneStatus `json:"state"`
+}
+
+func newZone(kind string, z strategy.PriceZone) zone {
+	return zone{
+		Kind:      kind,
+		Direction: z.Direction,
+		Low:       z.Low,
+		High:      z.High,
+		Candle:    z.Candle.Timestamp,
+		Formed:    z.FormCandle.Timestamp,
+		State:     z.State,
+	}
+}
+
+type structureBreak struct {
+	Kind      strategy.BreakKind `json:"kind"`
+	Direction strategy.Direction `json:"direction"`
+	Swing     float64            `json:"swing"`
+	SwingTime time.Time          `json:"swing_time"`
+	Time      time.Time          `json:"time"`
+	Shift     bool               `json:"shift"`
+}
+
+// higherTimeframe is the pools a higher timeframe had raided during the
+// run, one line each, so a change to them reads as a short diff.
+type higherTimeframe struct {
+	Timeframe   candle.Timeframe `json:"timeframe"`
+	RaidedPools []string         `json:"raided_pools"`
+}
+
+func raidedPool(pool strategy.LiquidityPool) string {
+	return fmt.Sprintf("%s %s %v from %s raided %s", pool.Name, pool.Direction, pool.Price,
+		pool.Candle.Timestamp.Format(time.RFC3339), pool.RaidCandle.Timestamp.Format(time.RFC3339))
+}
+
+type recordedSignal struct {
+	Signal    strategy.Signal `json:"signal"`
+	Rejection string          `json:"rejection,omitempty"`
+}
+
+type summary struct {
+	Trades       int     `json:"trades"`
+	NetPnL       float64 `json:"net_pnl"`
+	MaxDrawdown  float64 `json:"max_drawdown"`
+	EndingEquity float64 `json:"ending_equity"`
+}
+
+// recorder keeps every signal a run produces, accepted or not.
+type recorder struct {
+	signals []recordedSignal
+}
+
+func (r *recorder) RecordSignal(signal strategy.Signal, rejection error) {
+	recorded := recordedSignal{Signal: signal}
+	if rejection != nil {
+		recorded.Rejection = rejection.Error()
+	}
+	r.signals = append(r.signals, recorded)
+}
+
+func (r *recorder) RecordOrder(pos *position.Position)       {}
+func (r *recorder) RecordPosition(pos *position.Position)    {}
+func (r *recorder) RecordEquity(point portfolio.EquityPoint) {}
+
+func TestReplayGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		higher []candle.Timeframe
+		pools  []strategy.PoolDefinition
+		// structure, when set, configures and records the base structure.
+		structure string
+		risk      portfolio.RiskLimits
+	}{
+		{name: "ifvg_default"},
+		{name: "ifvg_2r", params: `{"r_multiple": 2, "max_raid_age": 15}`},
+		{name: "ifvg_one_trade_per_session", risk: portfolio.RiskLimits{MaxTradesPerSession: 1}},
+		{name: "ifvg_higher_timeframes", higher: []candle.Timeframe{candle.MustParseTimeframe("15m"), candle.MustParseTimeframe("1h"), candle.MustParseTimeframe("1d")}},
+		{
+			name:   "ifvg_higher_timeframe_raids",
+			params: `{"raid_pools": ["higher_timeframe"]}`,
+			higher: []candle.Timeframe{candle.MustParseTimeframe("15m"), candle.MustParseTimeframe("1h")},
+		},
+		{
+			name:   "ifvg_pool_catalogue",
+			params: `{"raid_pools": ["previous_day", "midnight_open", "ny_open", "opening_range", "equal_highs", "equal_lows"]}`,
+			pools: []strategy.PoolDefinition{
+				{Type: "previous_day"},
+				{Type: "previous_week"},
+				{Type: "midnight_open"},
+				{Type: "ny_open"},
+				{Type: "opening_range", Params: json.RawMessage(`{"duration": "30m"}`)},
+				{Type: "equal_levels", Params: json.RawMessage(`{"tolerance_ticks": 1}`)},
+			},
+		},
+		{name: "ifvg_structure", structure: `{"left_bars": 3, "right_bars": 3}`},
+	}
+
+	repo := loadFixture(t)
+	start := time.Date(2024, 10, 8, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := portfolio.PortfolioConfig{
+				Name:    "Golden",
+				Balance: 100000,
+				Strategies: []strategy.Definition{{
+					Type:             "ifvg",
+					Name:             "iFVG Strat",
+					Market:           "futures",
+					Symbols:          []string{"NQZ4"},
+					Timeframe:        candle.MustParseTimeframe("1m"),
+					HigherTimeframes: tt.higher,
+					Pools:            tt.pools,
+					Structure:        json.RawMessage(tt.structure),
+					Lookback:         1200,
+					Params:           json.RawMessage(tt.params),
+				}},
+			}
+			rec := &recorder{}
+			opts := Options{
+				Execution: execution.Config{
+					Costs: execution.Costs{Slippage: execution.FixedSlippage{Ticks: 1}, Commission: 0.5},
+				},
+				Risk:     tt.risk,
+				Recorder: rec,
+			}
+
+			ctx := context.Background()
+			feed, err := LoadFeed(ctx, repo, config.Strategies, start, end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := quietly(t, func() (Result, error) {
+				return Run(ctx, repo, feed, config, opts)
+			})
+
+			out := replay{
+				Signals: rec.signals,
+				Summary: summary{
+					Trades:       result.Report.Trades,
+					NetPnL:       result.Report.NetPnL,
+					MaxDrawdown:  result.Report.MaxDrawdown,
+					EndingEquity: result.Report.EndingEquity,
+				},
+			}
+			if len(tt.higher) == 0 {
+				out.Positions = result.Portfolio.Positions
+			}
+			bar := result.Portfolio.Strategies[0].(*strategy.BarStrategy)
+			if generated, ok := bar.Generated["NQZ4"]; ok {
+				out.Pools = slices.Concat(generated.GetPools(true), generated.GetPools(false))
+			}
+			if tt.structure != "" {
+				for _, b := range bar.Structure["NQZ4"].Breaks() {
+					out.Breaks = append(out.Breaks, structureBreak{
+						Kind:      b.Kind,
+						Direction: b.Direction,
+						Swing:     b.Swing.Price,
+						SwingTime: b.Swing.Candle.Timestamp,
+						Time:      b.Candle.Timestamp,
+						Shift:     b.IsShift(),
+					})
+				}
+				for _, b := range bar.Blocks["NQZ4"].Blocks() {
+					out.Zones = append(out.Zones, newZone(string(b.Kind), b.PriceZone))
+				}
+				for _, r := range bar.Gaps.BalancedRanges() {
+					out.Zones = append(out.Zones, newZone("balanced_price_range", r.PriceZone))
+				}
+			}
+			for _, higher := range bar.Higher {
+				recorded := higherTimeframe{Timeframe: higher.Timeframe}
+				for _, pool := range higher.Levels("NQZ4").Pools.GetPools(false) {
+					if !pool.RaidCandle.Timestamp.Before(start) {
+						recorded.RaidedPools = append(recorded.RaidedPools, raidedPool(pool))
+					}
+				}
+				out.Higher = append(out.Higher, recorded)
+			}
+			got, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			compareGolden(t, filepath.Join("testdata", "golden", tt.name+".json"), got)
+		})
+	}
+}
+
+// TestReplayDeterministic guards the golden files against output that
+// changes from run to run rather than with the code.
+func TestReplayDeterministic(t *testing.T) {
+	repo := loadFixture(t)
+	config := portfolio.PortfolioConfig{
+		Name:    "Golden",
+		Balance: 100000,
+		Strategies: []strategy.Definition{{
+			Type:      "ifvg",
+			Name:      "iFVG Strat",
+			Market:    "futures",
+			Symbols:   []string{"NQZ4"},
+			Timeframe: candle.MustParseTimeframe("1m"),
+			Lookback:  1200,
+		}},
+	}
+	ctx := context.Background()
+	feed, err := LoadFeed(ctx, repo, config.Strategies, time.Date(2024, 10, 8, 0, 0, 0, 0, time.UTC), time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var outputs [][]byte
+	for range 2 {
+		result := quietly(t, func() (Result, error) {
+			return Run(ctx, repo, feed, config, Options{})
+		})
+		out, err := json.Marshal(result.Portfolio.Positions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, out)
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Fatal("two replays of the same feed produced different positions")
+	}
+}
+
+func loadFixture(t *testing.T) candle.Repository {
+	t.Helper()
+
+	f, err := os.Open(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	candles, err := candle.ReadCSV(f)
+	if err != nil {
+		t.Fatalf("reading %s: %v", fixture, err)
+	}
+	repo := candle.NewMemoryRepository()
+	repo.Load(candles)
+	return repo
+}
+
+// quietly runs fn with the strategy's logging silenced.
+func quietly(t *testing.T, fn func() (Result, error)) Result {
+	t.Helper()
+
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	result, err := fn()
+	log.SetOutput(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// compareGolden diffs got against the golden file at path, rewriting it
+// instead with -update.
+func compareGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run go test ./analysis/internal/backtest -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s; if the change is intended, rerun with -update.\n%s", path, diff(want, got))
+	}
+}
+
+// diff reports the first line where got departs from want, with a little
+// context either side.
+func diff(want []byte, got []byte) string {
+	wantLines := bytes.Split(want, []byte("\n"))
+	gotLines := bytes.Split(got, []byte("\n"))
+
+	line := 0
+	for line < len(wantLines) && line < len(gotLines) && bytes.Equal(wantLines[line], gotLines[line]) {
+		line++
+	}
+
+	var b bytes.Buffer
+	from := max(line-3, 0)
+	for i := from; i < line+4; i++ {
+		if i < len(wantLines) && (i >= len(gotLines) || !bytes.Equal(wantLines[i], gotLines[i])) {
+			b.WriteString("- " + string(wantLines[i]) + "\n")
+		}
+		if i < len(gotLines) && (i >= len(wantLines) || !bytes.Equal(wantLines[i], gotLines[i])) {
+			b.WriteString("+ " + string(gotLines[i]) + "\n")
+		}
+		if i < len(wantLines) && i < len(gotLines) && bytes.Equal(wantLines[i], gotLines[i]) {
+			b.WriteString("  " + string(wantLines[i]) + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// WriteResults saves the full table of trials, best first, to results.csv
+// and results.json in dir.
+func WriteResults(dir string, trials []Trial) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	csvFile, err := os.Create(filepath.Join(dir, "results.csv"))
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+	if err := WriteCSV(csvFile, trials); err != nil {
+		return err
+	}
+
+	jsonFile, err := os.Create(filepath.Join(dir, "results.json"))
+	if err != nil {
+		return err
+	}
+	defer jsonFile.Close()
+	encoder := json.NewEncoder(jsonFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(trials); err != nil {
+		return err
+	}
+
+	if err := csvFile.Close(); err != nil {
+		return err
+	}
+	return jsonFile.Close()
+}
+
+// WriteCSV writes one row per trial with its params and headline metrics.
+func WriteCSV(w io.Writer, trials []Trial) error {
+	var names []string
+	if len(trials) > 0 {
+		for name := range trials[0].Params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	out := csv.NewWriter(w)
+	header := append([]string{"rank"}, names...)
+	header = append(header, "score", "trades", "net_pnl", "win_rate", "expectancy", "profit_factor", "sharpe", "max_drawdown", "max_drawdown_pct")
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	for i, trial := range trials {
+		row := []string{strconv.Itoa(i + 1)}
+		for _, name := range names {
+			row = append(row, fmt.Sprint(trial.Params[name]))
+		}
+		r := trial.Report
+		row = append(row,
+			formatFloat(trial.Score),
+			strconv.Itoa(r.Trades),
+			formatFloat(r.NetPnL),
+			formatFloat(r.WinRate),
+			formatFloat(r.Expectancy),
+			formatFloat(r.ProfitFactor),
+			formatFloat(r.Sharpe),
+			formatFloat(r.MaxDrawdown),
+			formatFloat(r.MaxDrawdownPct),
+		)
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// WriteWalkForward saves a walk-forward summary to walkforward.json and
+// windows.csv in dir, alongside the report of the stitched out-of-sample
+// runs.
+func WriteWalkForward(dir string, result WalkForwardResult) error {
+	if err := result.Report.Write(dir); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "walkforward.json"), data, 0o644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, "windows.csv"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	out := csv.NewWriter(f)
+	out.Write([]string{"in_start", "in_end", "out_start", "out_end", "params", "in_trades", "in_net_pnl", "out_trades", "out_net_pnl", "out_max_drawdown", "efficiency"})
+	for _, window := range result.Windows {
+		params, err := json.Marshal(window.Params)
+		if err != nil {
+			return err
+		}
+		out.Write([]string{
+			window.InStart.Format(time.RFC3339),
+			window.InEnd.Format(time.RFC3339),
+			window.OutStart.Format(time.RFC3339),
+			window.OutEnd.Format(time.RFC3339),
+			string(params),
+			strconv.Itoa(window.InSample.Trades),
+			formatFloat(window.InSample.NetPnL),
+			strconv.Itoa(window.OutOfSample.Trades),
+			formatFloat(window.OutOfSample.NetPnL),
+			formatFloat(window.OutOfSample.MaxDrawdown),
+			formatFloat(window.Efficiency),
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 4, 64)
+}
@@ -0,0 +1,186 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/metrics"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// WalkForward splits a range into in-sample windows to optimize on, each
+// followed by an out-of-sample window the winning params are tested on.
+type WalkForward struct {
+	InSample    time.Duration
+	OutOfSample time.Duration
+	// Anchored grows every in-sample window from the start of the range
+	// instead of rolling it forward.
+	Anchored bool
+}
+
+// Window is one in-sample/out-of-sample split. Each part runs from its start
+// up to, but not including, its end.
+type Window struct {
+	InStart  time.Time `json:"in_start"`
+	InEnd    time.Time `json:"in_end"`
+	OutStart time.Time `json:"out_start"`
+	OutEnd   time.Time `json:"out_end"`
+}
+
+// Windows splits [start, end) into consecutive out-of-sample windows, each
+// preceded by its in-sample window. The last out-of-sample window is cut
+// short at end.
+func (w WalkForward) Windows(start time.Time, end time.Time) ([]Window, error) {
+	if w.InSample <= 0 || w.OutOfSample <= 0 {
+		return nil, errors.New("in-sample and out-of-sample lengths must be positive")
+	}
+
+	var windows []Window
+	for outStart := start.Add(w.InSample); outStart.Before(end); outStart = outStart.Add(w.OutOfSample) {
+		window := Window{
+			InStart:  outStart.Add(-w.InSample),
+			InEnd:    outStart,
+			OutStart: outStart,
+			OutEnd:   outStart.Add(w.OutOfSample),
+		}
+		if w.Anchored {
+			window.InStart = start
+		}
+		if window.OutEnd.After(end) {
+			window.OutEnd = end
+		}
+		windows = append(windows, window)
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("range %s to %s is shorter than the %s in-sample window", start.Format(time.DateOnly), end.Format(time.DateOnly), w.InSample)
+	}
+	return windows, nil
+}
+
+type WindowResult struct {
+	Window
+	Params      map[string]any `json:"params"`
+	InSample    metrics.Report `json:"in_sample"`
+	OutOfSample metrics.Report `json:"out_of_sample"`
+	// Efficiency is the out-of-sample P&L per day over the in-sample P&L
+	// per day of the winning params.
+	Efficiency float64 `json:"efficiency"`
+}
+
+type WalkForwardResult struct {
+	Windows []WindowResult `json:"windows"`
+	// Report covers every out-of-sample window, stitched into one equity
+	// curve.
+	Report            metrics.Report `json:"-"`
+	Efficiency        float64        `json:"efficiency"`
+	ProfitableWindows int            `json:"profitable_windows"`
+}
+
+// RunWalkForward optimizes search on each in-sample window of feed, runs the
+// best params on the out-of-sample window that follows, flattening what is
+// still open at its end, and stitches the out-of-sample results together.
+func RunWalkForward(ctx context.Context, repo candle.Repository, feed Feed, config portfolio.PortfolioConfig, search Search, walk WalkForward, start time.Time, end time.Time, opts Options) (WalkForwardResult, error) {
+	windows, err := walk.Windows(start, end)
+	if err != nil {
+		return WalkForwardResult{}, err
+	}
+	target, err := search.target(config)
+	if err != nil {
+		return WalkForwardResult{}, err
+	}
+
+	var result WalkForwardResult
+	var positions []*position.Position
+	var curve []portfolio.EquityPoint
+	var inPnLPerDay, outPnLPerDay float64
+	for i, window := range windows {
+		trials, err := Optimize(ctx, repo, feed.Slice(window.InStart, window.InEnd), config, search, opts)
+		if err != nil {
+			return WalkForwardResult{}, fmt.Errorf("window %d in-sample: %w", i+1, err)
+		}
+		best := trials[0]
+
+		outConfig, err := withParams(config, target, best.Params)
+		if err != nil {
+			return WalkForwardResult{}, err
+		}
+		out, err := Run(ctx, repo, feed.Slice(window.OutStart, window.OutEnd), outConfig, opts)
+		if err != nil {
+			return WalkForwardResult{}, fmt.Errorf("window %d out-of-sample: %w", i+1, err)
+		}
+		// The next window starts from a new portfolio, so anything still
+		// open is closed at the window's last prices to keep its P&L.
+		out.Portfolio.Flatten("end of out-of-sample window")
+		out.Report = metrics.Compute(outConfig.Name, config.Balance, out.Portfolio.Positions, out.Portfolio.EquityCurve)
+
+		inPerDay := best.Report.NetPnL / days(window.InStart, window.InEnd)
+		outPerDay := out.Report.NetPnL / days(window.OutStart, window.OutEnd)
+		inPnLPerDay += inPerDay
+		outPnLPerDay += outPerDay
+		if out.Report.NetPnL > 0 {
+			result.ProfitableWindows++
+		}
+
+		positions = append(positions, out.Portfolio.Positions...)
+		curve = stitch(curve, out.Portfolio.EquityCurve, config.Balance)
+
+		outReport := out.Report
+		outReport.TradeLog = nil
+		outReport.EquityCurve = nil
+		result.Windows = append(result.Windows, WindowResult{
+			Window:      window,
+			Params:      best.Params,
+			InSample:    best.Report,
+			OutOfSample: outReport,
+			Efficiency:  ratio(outPerDay, inPerDay),
+		})
+	}
+
+	result.Efficiency = ratio(outPnLPerDay, inPnLPerDay)
+	result.Report = metrics.Compute(config.Name+" walk-forward", config.Balance, positions, curve)
+	return result, nil
+}
+
+// stitch appends next to curve, shifting next so it starts from where curve
+// ended rather than from the starting balance, and recomputes drawdown from
+// the combined peak.
+func stitch(curve []portfolio.EquityPoint, next []portfolio.EquityPoint, balance float64) []portfolio.EquityPoint {
+	var offset, realized float64
+	peak := balance
+	if len(curve) > 0 {
+		last := curve[len(curve)-1]
+		offset = last.Equity - balance
+		realized = last.Realized
+		peak = last.Peak
+	}
+
+	for _, point := range next {
+		point.Cash += offset
+		point.Realized += realized
+		point.Equity += offset
+		peak = max(peak, point.Equity)
+		point.Peak = peak
+		point.Drawdown = peak - point.Equity
+		point.DrawdownPct = 0
+		if peak > 0 {
+			point.DrawdownPct = point.Drawdown / peak
+		}
+		curve = append(curve, point)
+	}
+	return curve
+}
+
+func days(start time.Time, end time.Time) float64 {
+	return end.Sub(start).Hours() / 24
+}
+
+func ratio(numerator float64, denominator float64) float64 {
+	if denominator == 0 {
+		return 0
+	}
+	return numerator / denominator
+}
@@ -0,0 +1,122 @@
+package backtest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+)
+
+func TestWalkForwardWindows(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 10, d, 0, 0, 0, 0, time.UTC) }
+	const days = 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		walk    WalkForward
+		end     time.Time
+		want    []Window
+		wantErr bool
+	}{
+		{
+			name: "rolling",
+			walk: WalkForward{InSample: 3 * days, OutOfSample: 2 * days},
+			end:  day(8),
+			want: []Window{
+				{InStart: day(1), InEnd: day(4), OutStart: day(4), OutEnd: day(6)},
+				{InStart: day(3), InEnd: day(6), OutStart: day(6), OutEnd: day(8)},
+			},
+		},
+		{
+			name: "anchored",
+			walk: WalkForward{InSample: 3 * days, OutOfSample: 2 * days, Anchored: true},
+			end:  day(8),
+			want: []Window{
+				{InStart: day(1), InEnd: day(4), OutStart: day(4), OutEnd: day(6)},
+				{InStart: day(1), InEnd: day(6), OutStart: day(6), OutEnd: day(8)},
+			},
+		},
+		{
+			name: "last window cut short at the end",
+			walk: WalkForward{InSample: 3 * days, OutOfSample: 2 * days},
+			end:  day(7),
+			want: []Window{
+				{InStart: day(1), InEnd: day(4), OutStart: day(4), OutEnd: day(6)},
+				{InStart: day(3), InEnd: day(6), OutStart: day(6), OutEnd: day(7)},
+			},
+		},
+		{
+			name:    "range no longer than the in-sample window",
+			walk:    WalkForward{InSample: 3 * days, OutOfSample: 2 * days},
+			end:     day(4),
+			wantErr: true,
+		},
+		{name: "zero in-sample", walk: WalkForward{OutOfSample: days}, end: day(8), wantErr: true},
+		{name: "negative out-of-sample", walk: WalkForward{InSample: days, OutOfSample: -days}, end: day(8), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.walk.Windows(day(1), tt.end)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: windows = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStitch(t *testing.T) {
+	ts := time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+	point := func(minute int, cash, realized, unrealized float64) portfolio.EquityPoint {
+		return portfolio.EquityPoint{
+			Timestamp:  ts.Add(time.Duration(minute) * time.Minute),
+			Cash:       cash,
+			Realized:   realized,
+			Unrealized: unrealized,
+			Equity:     cash + unrealized,
+		}
+	}
+
+	// The first window ends up $500, the second starts again from $100,000.
+	curve := stitch(nil, []portfolio.EquityPoint{
+		point(0, 100000, 0, 200),
+		point(1, 100500, 500, 0),
+	}, 100000)
+	curve = stitch(curve, []portfolio.EquityPoint{
+		point(2, 99700, -300, 0),
+		point(3, 99700, -300, 1000),
+	}, 100000)
+
+	want := []struct {
+		cash, realized, equity, peak, drawdown float64
+	}{
+		{100000, 0, 100200, 100200, 0},
+		{100500, 500, 100500, 100500, 0},
+		{100200, 200, 100200, 100500, 300},
+		{100200, 200, 101200, 101200, 0},
+	}
+	if len(curve) != len(want) {
+		t.Fatalf("stitched %d points, want %d", len(curve), len(want))
+	}
+	for i, w := range want {
+		got := curve[i]
+		for _, field := range []struct {
+			name      string
+			got, want float64
+		}{
+			{"cash", got.Cash, w.cash},
+			{"realized", got.Realized, w.realized},
+			{"equity", got.Equity, w.equity},
+			{"peak", got.Peak, w.peak},
+			{"drawdown", got.Drawdown, w.drawdown},
+			{"drawdown pct", got.DrawdownPct, w.drawdown / w.peak},
+		} {
+			if math.Abs(field.got-field.want) > 1e-9 {
+				t.Errorf("point %d: %s = %v, want %v", i, field.name, field.got, field.want)
+			}
+		}
+	}
+}
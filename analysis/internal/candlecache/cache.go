@@ -0,0 +1,233 @@
+package candlecache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+type seriesKey struct {
+	market    string
+	symbol    string
+	timeframe candle.Timeframe
+}
+
+// window is the most recent GetPastCandles result for a series, stored oldest
+// first. Every stored candle of the series between the first candle and asOf
+// is in the window; if complete, there are none before it either.
+type window struct {
+	key      seriesKey
+	asOf     time.Time
+	complete bool
+	candles  []candle.Candle
+}
+
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Coalesced int64
+	Windows   int
+}
+
+// Repository is a read-through candle.Repository decorator that keeps the
+// hot lookback window of the most recently used series in memory. Concurrent
+// identical misses share a single query to the underlying repository.
+type Repository struct {
+	repo     candle.Repository
+	capacity int
+
+	mu      sync.Mutex
+	lru     *list.List
+	windows map[seriesKey]*list.Element
+	group   singleflight.Group
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	coalesced atomic.Int64
+}
+
+// New wraps repo with a cache holding windows for at most capacity series.
+func New(repo candle.Repository, capacity int) *Repository {
+	return &Repository{
+		repo:     repo,
+		capacity: max(capacity, 1),
+		lru:      list.New(),
+		windows:  make(map[seriesKey]*list.Element),
+	}
+}
+
+func (r *Repository) GetPastCandles(ctx context.Context, market string, symbol string, timeframe candle.Timeframe, startTime time.Time, count int) []candle.Candle {
+	key := seriesKey{market, symbol, timeframe}
+	if candles, ok := r.pastFromWindow(key, startTime, count); ok {
+		r.hits.Add(1)
+		return candles
+	}
+	r.misses.Add(1)
+
+	flightKey := fmt.Sprintf("past|%s|%s|%s|%d|%d", market, symbol, timeframe, startTime.UnixNano(), count)
+	result, _, shared := r.group.Do(flightKey, func() (any, error) {
+		candles := r.repo.GetPastCandles(ctx, market, symbol, timeframe, startTime, count)
+		r.store(key, startTime, len(candles) < count, candles)
+		return candles, nil
+	})
+	if shared {
+		r.coalesced.Add(1)
+	}
+
+	return clone(result.([]candle.Candle))
+}
+
+func (r *Repository) GetCandles(ctx context.Context, market string, symbol string, timeframe candle.Timeframe, startTime time.Time, endTime time.Time) []candle.Candle {
+	key := seriesKey{market, symbol, timeframe}
+	if candles, ok := r.rangeFromWindow(key, startTime, endTime); ok {
+		r.hits.Add(1)
+		return candles
+	}
+	r.misses.Add(1)
+
+	flightKey := fmt.Sprintf("range|%s|%s|%s|%d|%d", market, symbol, timeframe, startTime.UnixNano(), endTime.UnixNano())
+	result, _, shared := r.group.Do(flightKey, func() (any, error) {
+		return r.repo.GetCandles(ctx, market, symbol, timeframe, startTime, endTime), nil
+	})
+	if shared {
+		r.coalesced.Add(1)
+	}
+
+	return clone(result.([]candle.Candle))
+}
+
+// AddCandle writes through and drops the cached window when the new candle
+// falls inside it.
+func (r *Repository) AddCandle(ctx context.Context, c candle.Candle) int {
+	id := r.repo.AddCandle(ctx, c)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := seriesKey{c.Market, c.Symbol, c.Timeframe}
+	if elem, ok := r.windows[key]; ok && !c.Timestamp.After(elem.Value.(*window).asOf) {
+		r.lru.Remove(elem)
+		delete(r.windows, key)
+	}
+
+	return id
+}
+
+func (r *Repository) Stats() Stats {
+	r.mu.Lock()
+	windows := len(r.windows)
+	r.mu.Unlock()
+
+	return Stats{
+		Hits:      r.hits.Load(),
+		Misses:    r.misses.Load(),
+		Coalesced: r.coalesced.Load(),
+		Windows:   windows,
+	}
+}
+
+// pastFromWindow answers GetPastCandles from the cached window when it holds
+// at least count candles at or before startTime.
+func (r *Repository) pastFromWindow(key seriesKey, startTime time.Time, count int) ([]candle.Candle, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w := r.lookup(key)
+	if w == nil || startTime.After(w.asOf) {
+		return nil, false
+	}
+
+	end := sort.Search(len(w.candles), func(i int) bool {
+		return w.candles[i].Timestamp.After(startTime)
+	})
+	if end < count && !w.complete {
+		return nil, false
+	}
+
+	start := max(end-count, 0)
+	candles := make([]candle.Candle, 0, end-start)
+	for i := end - 1; i >= start; i-- {
+		candles = append(candles, w.candles[i])
+	}
+	return candles, true
+}
+
+func (r *Repository) rangeFromWindow(key seriesKey, startTime time.Time, endTime time.Time) ([]candle.Candle, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w := r.lookup(key)
+	if w == nil || len(w.candles) == 0 || endTime.After(w.asOf) {
+		return nil, false
+	}
+	if !w.complete && startTime.Before(w.candles[0].Timestamp) {
+		return nil, false
+	}
+
+	lo := sort.Search(len(w.candles), func(i int) bool {
+		return !w.candles[i].Timestamp.Before(startTime)
+	})
+	hi := sort.Search(len(w.candles), func(i int) bool {
+		return w.candles[i].Timestamp.After(endTime)
+	})
+	if lo >= hi {
+		return nil, true
+	}
+	return clone(w.candles[lo:hi]), true
+}
+
+// store replaces the window for key with a newer query result, evicting the
+// least recently used series when over capacity. past is newest first, as
+// returned by GetPastCandles.
+func (r *Repository) store(key seriesKey, asOf time.Time, complete bool, past []candle.Candle) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if elem, ok := r.windows[key]; ok {
+		if asOf.Before(elem.Value.(*window).asOf) {
+			return
+		}
+		r.lru.Remove(elem)
+		delete(r.windows, key)
+	}
+
+	candles := make([]candle.Candle, len(past))
+	for i, c := range past {
+		candles[len(past)-1-i] = c
+	}
+	r.windows[key] = r.lru.PushFront(&window{
+		key:      key,
+		asOf:     asOf,
+		complete: complete,
+		candles:  candles,
+	})
+
+	for r.lru.Len() > r.capacity {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.windows, oldest.Value.(*window).key)
+	}
+}
+
+func (r *Repository) lookup(key seriesKey) *window {
+	elem, ok := r.windows[key]
+	if !ok {
+		return nil
+	}
+	r.lru.MoveToFront(elem)
+	return elem.Value.(*window)
+}
+
+func clone(candles []candle.Candle) []candle.Candle {
+	if len(candles) == 0 {
+		return nil
+	}
+	return append([]candle.Candle(nil), candles...)
+}
@@ -0,0 +1,249 @@
+package candlecache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+var (
+	oneMinute = candle.MustParseTimeframe("1m")
+	start     = time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+)
+
+// countingRepository counts the queries that reach a memory repository and,
+// when gate is set, holds GetPastCandles until it is closed.
+type countingRepository struct {
+	*candle.MemoryRepository
+	past   atomic.Int64
+	ranges atomic.Int64
+	gate   chan struct{}
+}
+
+func newCountingRepository(symbols ...string) *countingRepository {
+	repo := &countingRepository{MemoryRepository: candle.NewMemoryRepository()}
+	for _, symbol := range symbols {
+		candles := make([]candle.Candle, 100)
+		for i := range candles {
+			candles[i] = bar(symbol, i, 20000+float64(i))
+		}
+		repo.Load(candles)
+	}
+	return repo
+}
+
+func (r *countingRepository) GetPastCandles(ctx context.Context, market string, symbol string, timeframe candle.Timeframe, startTime time.Time, count int) []candle.Candle {
+	r.past.Add(1)
+	if r.gate != nil {
+		<-r.gate
+	}
+	return r.MemoryRepository.GetPastCandles(ctx, market, symbol, timeframe, startTime, count)
+}
+
+func (r *countingRepository) GetCandles(ctx context.Context, market string, symbol string, timeframe candle.Timeframe, startTime time.Time, endTime time.Time) []candle.Candle {
+	r.ranges.Add(1)
+	return r.MemoryRepository.GetCandles(ctx, market, symbol, timeframe, startTime, endTime)
+}
+
+// bar is the i-th minute of symbol from start, closing at price.
+func bar(symbol string, i int, price float64) candle.Candle {
+	return candle.Candle{
+		Market:    "futures",
+		Symbol:    symbol,
+		Timeframe: oneMinute,
+		Open:      price,
+		High:      price + 1,
+		Low:       price - 1,
+		Close:     price,
+		Timestamp: minute(i),
+	}
+}
+
+func minute(i int) time.Time {
+	return start.Add(time.Duration(i) * time.Minute)
+}
+
+func TestWindowAnswersQueriesUpToAsOf(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepository("NQZ4")
+	cache := New(repo, 4)
+
+	// The first query caches minutes 41 to 50 as of minute 50.
+	cache.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(50), 10)
+
+	tests := []struct {
+		name   string
+		query  func() []candle.Candle
+		want   []candle.Candle
+		cached bool
+	}{
+		{
+			name:   "the same query",
+			query:  func() []candle.Candle { return cache.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(50), 10) },
+			want:   repo.MemoryRepository.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(50), 10),
+			cached: true,
+		},
+		{
+			name:   "fewer bars from earlier in the window",
+			query:  func() []candle.Candle { return cache.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(45), 5) },
+			want:   repo.MemoryRepository.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(45), 5),
+			cached: true,
+		},
+		{
+			name:  "more bars than the window holds",
+			query: func() []candle.Candle { return cache.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(45), 10) },
+			want:  repo.MemoryRepository.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(45), 10),
+		},
+		{
+			name: "a range inside the window",
+			query: func() []candle.Candle {
+				return cache.GetCandles(ctx, "futures", "NQZ4", oneMinute, minute(42), minute(48))
+			},
+			want:   repo.MemoryRepository.GetCandles(ctx, "futures", "NQZ4", oneMinute, minute(42), minute(48)),
+			cached: true,
+		},
+		{
+			name: "a range past as of",
+			query: func() []candle.Candle {
+				return cache.GetCandles(ctx, "futures", "NQZ4", oneMinute, minute(42), minute(55))
+			},
+			want: repo.MemoryRepository.GetCandles(ctx, "futures", "NQZ4", oneMinute, minute(42), minute(55)),
+		},
+		{
+			name:  "bars past as of",
+			query: func() []candle.Candle { return cache.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(51), 5) },
+			want:  repo.MemoryRepository.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(51), 5),
+		},
+	}
+	for _, tt := range tests {
+		before := repo.past.Load() + repo.ranges.Load()
+		got := tt.query()
+		if cached := repo.past.Load()+repo.ranges.Load() == before; cached != tt.cached {
+			t.Errorf("%s: answered from the window = %v, want %v", tt.name, cached, tt.cached)
+		}
+		if !sameCandles(got, tt.want) {
+			t.Errorf("%s: got %d candles, want %d matching the repository", tt.name, len(got), len(tt.want))
+		}
+	}
+
+	if stats := cache.Stats(); stats.Hits != 3 || stats.Misses != 4 || stats.Coalesced != 0 || stats.Windows != 1 {
+		t.Errorf("stats = %+v, want 3 hits, 4 misses and 1 window", stats)
+	}
+}
+
+func TestLeastRecentlyUsedSeriesIsEvicted(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepository("NQZ4", "ESZ4", "YMZ4")
+	cache := New(repo, 2)
+	past := func(symbol string) {
+		cache.GetPastCandles(ctx, "futures", symbol, oneMinute, minute(50), 10)
+	}
+
+	past("NQZ4")
+	past("ESZ4")
+	// Using NQ leaves ES as the least recently used when YM needs room.
+	past("NQZ4")
+	past("YMZ4")
+
+	before := repo.past.Load()
+	past("NQZ4")
+	past("YMZ4")
+	if calls := repo.past.Load() - before; calls != 0 {
+		t.Errorf("%d queries for cached series, want 0", calls)
+	}
+	past("ESZ4")
+	if calls := repo.past.Load() - before; calls != 1 {
+		t.Errorf("%d queries after ES was evicted, want 1", calls)
+	}
+
+	if stats := cache.Stats(); stats.Hits != 3 || stats.Misses != 4 || stats.Windows != 2 {
+		t.Errorf("stats = %+v, want 3 hits, 4 misses and 2 windows", stats)
+	}
+}
+
+func TestAddCandleInvalidatesTheWindow(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepository("NQZ4")
+	cache := New(repo, 4)
+	past := func() []candle.Candle {
+		return cache.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(50), 10)
+	}
+	past()
+
+	// A candle after the window's as of leaves it alone.
+	cache.AddCandle(ctx, bar("NQZ4", 60, 1))
+	past()
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Windows != 1 {
+		t.Errorf("after a newer candle, stats = %+v, want the window kept", stats)
+	}
+
+	// A correction inside it drops the window, and the next query sees it.
+	cache.AddCandle(ctx, bar("NQZ4", 48, 1))
+	if stats := cache.Stats(); stats.Windows != 0 {
+		t.Errorf("after a correction, %d windows, want 0", stats.Windows)
+	}
+	candles := past()
+	if calls := repo.past.Load(); calls != 2 {
+		t.Errorf("%d queries, want 2", calls)
+	}
+	if len(candles) != 10 || candles[2].Close != 1 {
+		t.Errorf("corrected candle not returned: %+v", candles)
+	}
+}
+
+func TestConcurrentMissesShareAQuery(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepository("NQZ4")
+	repo.gate = make(chan struct{})
+	cache := New(repo, 4)
+
+	const callers = 8
+	results := make([][]candle.Candle, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Go(func() {
+			results[i] = cache.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, minute(50), 10)
+		})
+	}
+	// Hold the first query until every caller has missed and joined it.
+	for cache.Stats().Misses < callers {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(repo.gate)
+	wg.Wait()
+
+	if calls := repo.past.Load(); calls != 1 {
+		t.Errorf("%d queries for %d concurrent misses, want 1", calls, callers)
+	}
+	// Every caller of a shared query, the first included, counts as coalesced.
+	if stats := cache.Stats(); stats.Misses != callers || stats.Coalesced != callers {
+		t.Errorf("stats = %+v, want %d misses, all coalesced", stats, callers)
+	}
+	for i, got := range results {
+		if len(got) != 10 {
+			t.Fatalf("caller %d got %d candles, want 10", i, len(got))
+		}
+	}
+	// Callers get their own copies.
+	results[0][0].Close = 0
+	if results[1][0].Close == 0 {
+		t.Error("callers share a result slice")
+	}
+}
+
+func sameCandles(got, want []candle.Candle) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].Close != want[i].Close {
+			return false
+		}
+	}
+	return true
+}
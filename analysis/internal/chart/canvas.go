@@ -0,0 +1,158 @@
+package chart
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// canvas is the drawing surface a chart renders onto, so the same layout
+// produces both SVG and PNG output.
+type canvas interface {
+	rect(x, y, w, h float64, fill color.RGBA)
+	line(x1, y1, x2, y2 float64, stroke color.RGBA, width float64, dashed bool)
+	polygon(points [][2]float64, fill color.RGBA)
+	text(x, y float64, s string, fill color.RGBA)
+}
+
+type svgCanvas struct {
+	b strings.Builder
+}
+
+func newSVGCanvas(width, height int) *svgCanvas {
+	c := &svgCanvas{}
+	fmt.Fprintf(&c.b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" font-family="monospace" font-size="11">`, width, height, width, height)
+	return c
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, fill color.RGBA) {
+	fmt.Fprintf(&c.b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" %s/>`, x, y, math.Max(w, 0.5), math.Max(h, 0.5), svgPaint("fill", fill))
+}
+
+func (c *svgCanvas) line(x1, y1, x2, y2 float64, stroke color.RGBA, width float64, dashed bool) {
+	dash := ""
+	if dashed {
+		dash = ` stroke-dasharray="4 3"`
+	}
+	fmt.Fprintf(&c.b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" %s stroke-width="%.1f"%s/>`, x1, y1, x2, y2, svgPaint("stroke", stroke), width, dash)
+}
+
+func (c *svgCanvas) polygon(points [][2]float64, fill color.RGBA) {
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = fmt.Sprintf("%.1f,%.1f", p[0], p[1])
+	}
+	fmt.Fprintf(&c.b, `<polygon points="%s" %s/>`, strings.Join(coords, " "), svgPaint("fill", fill))
+}
+
+func (c *svgCanvas) text(x, y float64, s string, fill color.RGBA) {
+	fmt.Fprintf(&c.b, `<text x="%.1f" y="%.1f" %s>%s</text>`, x, y, svgPaint("fill", fill), html.EscapeString(s))
+}
+
+func (c *svgCanvas) bytes() []byte {
+	return []byte(c.b.String() + "</svg>")
+}
+
+func svgPaint(attr string, c color.RGBA) string {
+	paint := fmt.Sprintf(`%s="#%02x%02x%02x"`, attr, c.R, c.G, c.B)
+	if c.A != 255 {
+		paint += fmt.Sprintf(` %s-opacity="%.2f"`, attr, float64(c.A)/255)
+	}
+	return paint
+}
+
+// pngCanvas rasterises onto an RGBA image. Colours are straight alpha and
+// are blended over what is already drawn.
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+func newPNGCanvas(width, height int) *pngCanvas {
+	return &pngCanvas{img: image.NewRGBA(image.Rect(0, 0, width, height))}
+}
+
+func (c *pngCanvas) rect(x, y, w, h float64, fill color.RGBA) {
+	r := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+math.Max(w, 1))), int(math.Round(y+math.Max(h, 1))))
+	draw.Draw(c.img, r, image.NewUniform(premultiply(fill)), image.Point{}, draw.Over)
+}
+
+func (c *pngCanvas) line(x1, y1, x2, y2 float64, stroke color.RGBA, width float64, dashed bool) {
+	src := image.NewUniform(premultiply(stroke))
+	length := math.Hypot(x2-x1, y2-y1)
+	steps := int(math.Max(length, 1))
+	half := math.Max(width/2, 0.5)
+	for i := 0; i <= steps; i++ {
+		if dashed && (i%7) >= 4 {
+			continue
+		}
+		t := float64(i) / float64(steps)
+		x, y := x1+(x2-x1)*t, y1+(y2-y1)*t
+		r := image.Rect(int(math.Round(x-half)), int(math.Round(y-half)), int(math.Round(x+half)), int(math.Round(y+half)))
+		draw.Draw(c.img, r, src, image.Point{}, draw.Over)
+	}
+}
+
+func (c *pngCanvas) polygon(points [][2]float64, fill color.RGBA) {
+	if len(points) < 3 {
+		return
+	}
+	minX, minY, maxX, maxY := points[0][0], points[0][1], points[0][0], points[0][1]
+	for _, p := range points {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+
+	src := image.NewUniform(premultiply(fill))
+	for y := int(minY); y <= int(maxY); y++ {
+		for x := int(minX); x <= int(maxX); x++ {
+			if inside(points, float64(x)+0.5, float64(y)+0.5) {
+				draw.Draw(c.img, image.Rect(x, y, x+1, y+1), src, image.Point{}, draw.Over)
+			}
+		}
+	}
+}
+
+func (c *pngCanvas) text(x, y float64, s string, fill color.RGBA) {
+	d := font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(premultiply(fill)),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(int(x), int(y)),
+	}
+	d.DrawString(s)
+}
+
+func (c *pngCanvas) encode(w io.Writer, encode func(io.Writer, image.Image) error) error {
+	return encode(w, c.img)
+}
+
+// inside reports whether (x, y) is inside the polygon by ray casting.
+func inside(points [][2]float64, x, y float64) bool {
+	in := false
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		a, b := points[i], points[j]
+		if (a[1] > y) != (b[1] > y) && x < (b[0]-a[0])*(y-a[1])/(b[1]-a[1])+a[0] {
+			in = !in
+		}
+	}
+	return in
+}
+
+func premultiply(c color.RGBA) color.RGBA {
+	a := uint32(c.A)
+	return color.RGBA{
+		R: uint8(uint32(c.R) * a / 255),
+		G: uint8(uint32(c.G) * a / 255),
+		B: uint8(uint32(c.B) * a / 255),
+		A: c.A,
+	}
+}
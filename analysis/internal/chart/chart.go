@@ -0,0 +1,443 @@
+// Package chart renders candle windows with strategy overlays to SVG and PNG
+// for reviewing setups and trades.
+package chart
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+const (
+	marginLeft   = 8.0
+	marginRight  = 72.0
+	marginTop    = 24.0
+	marginBottom = 22.0
+)
+
+var (
+	background = color.RGBA{255, 255, 255, 255}
+	ink        = color.RGBA{17, 24, 39, 255}
+	grid       = color.RGBA{229, 231, 235, 255}
+	up         = color.RGBA{22, 163, 74, 255}
+	down       = color.RGBA{220, 38, 38, 255}
+	stopLine   = color.RGBA{220, 38, 38, 200}
+	targetLine = color.RGBA{22, 163, 74, 200}
+	buyside    = color.RGBA{190, 18, 60, 220}
+	sellside   = color.RGBA{13, 148, 136, 220}
+
+	gapColors = map[strategy.GapStatus]color.RGBA{
+		strategy.GapOpen:            {59, 130, 246, 60},
+		strategy.GapPartiallyFilled: {245, 158, 11, 60},
+		strategy.GapFilled:          {156, 163, 175, 50},
+		strategy.GapInversed:        {168, 85, 247, 70},
+	}
+	sessionColors = map[string]color.RGBA{
+		"Asia":       {250, 204, 21, 28},
+		"London":     {59, 130, 246, 22},
+		"Pre Market": {156, 163, 175, 22},
+		"New York":   {34, 197, 94, 22},
+	}
+)
+
+var newYork = loadNewYork()
+
+func loadNewYork() *time.Location {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		log.Fatalf("failed to load America/New_York location: %v", err)
+	}
+	return location
+}
+
+// Session is a shaded time box drawn behind the candles.
+type Session struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// Chart is a window of candles and the overlays to draw on it. Candles must
+// be in ascending time order; overlays outside the window are clipped.
+type Chart struct {
+	Title     string
+	Width     int
+	Height    int
+	Candles   []candle.Candle
+	Gaps      []strategy.FairValueGap
+	Pools     []strategy.LiquidityPool
+	Sessions  []Session
+	Positions []*position.Position
+}
+
+// SVG renders the chart as a standalone SVG document.
+func (c *Chart) SVG() []byte {
+	width, height := c.size()
+	cv := newSVGCanvas(width, height)
+	c.draw(cv)
+	return cv.bytes()
+}
+
+func (c *Chart) WriteSVG(w io.Writer) error {
+	_, err := w.Write(c.SVG())
+	return err
+}
+
+func (c *Chart) WritePNG(w io.Writer) error {
+	width, height := c.size()
+	cv := newPNGCanvas(width, height)
+	c.draw(cv)
+	return cv.encode(w, png.Encode)
+}
+
+// PNG renders the chart as PNG bytes.
+func (c *Chart) PNG() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.WritePNG(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Chart) size() (int, int) {
+	width, height := c.Width, c.Height
+	if width == 0 {
+		width = 1200
+	}
+	if height == 0 {
+		height = 600
+	}
+	return width, height
+}
+
+// layout maps times and prices to canvas coordinates.
+type layout struct {
+	candles     []candle.Candle
+	left, right float64
+	top, bottom float64
+	low, high   float64
+	barWidth    float64
+}
+
+func (l layout) y(price float64) float64 {
+	return l.bottom - (price-l.low)/(l.high-l.low)*(l.bottom-l.top)
+}
+
+// x returns the centre of the first bar at or after t, the right edge when
+// t is after the last bar, and whether t falls inside the window at all.
+func (l layout) x(t time.Time) (float64, bool) {
+	i := sort.Search(len(l.candles), func(i int) bool { return !l.candles[i].Timestamp.Before(t) })
+	if i == len(l.candles) {
+		return l.right, false
+	}
+	return l.left + (float64(i)+0.5)*l.barWidth, i > 0 || l.candles[0].Timestamp.Equal(t)
+}
+
+func (l layout) inRange(price float64) bool {
+	return price >= l.low && price <= l.high
+}
+
+func (c *Chart) layout() layout {
+	width, height := c.size()
+	l := layout{
+		candles: c.Candles,
+		left:    marginLeft,
+		right:   float64(width) - marginRight,
+		top:     marginTop,
+		bottom:  float64(height) - marginBottom,
+		low:     math.Inf(1),
+		high:    math.Inf(-1),
+	}
+	l.barWidth = (l.right - l.left) / float64(max(len(c.Candles), 1))
+
+	for _, bar := range c.Candles {
+		l.low = math.Min(l.low, bar.Low)
+		l.high = math.Max(l.high, bar.High)
+	}
+	first, last := c.Candles[0].Timestamp, c.Candles[len(c.Candles)-1].Timestamp
+	for _, pos := range c.Positions {
+		if pos.EnterTime.IsZero() || pos.EnterTime.After(last) || (!pos.ExitTime.IsZero() && pos.ExitTime.Before(first)) {
+			continue
+		}
+		for _, level := range []float64{pos.EnterPrice, pos.StopLoss, pos.TakeProfit} {
+			if level != 0 {
+				l.low = math.Min(l.low, level)
+				l.high = math.Max(l.high, level)
+			}
+		}
+	}
+
+	pad := math.Max((l.high-l.low)*0.05, 1)
+	l.low -= pad
+	l.high += pad
+	return l
+}
+
+func (c *Chart) draw(cv canvas) {
+	width, height := c.size()
+	cv.rect(0, 0, float64(width), float64(height), background)
+	cv.text(marginLeft, 16, c.Title, ink)
+	if len(c.Candles) == 0 {
+		cv.text(marginLeft, marginTop+16, "no candles", ink)
+		return
+	}
+
+	l := c.layout()
+	c.drawSessions(cv, l)
+	drawAxes(cv, l)
+	c.drawGaps(cv, l)
+	drawCandles(cv, l)
+	c.drawPools(cv, l)
+	c.drawPositions(cv, l)
+}
+
+func (c *Chart) drawSessions(cv canvas, l layout) {
+	for _, session := range c.Sessions {
+		x1, _ := l.x(session.Start)
+		x2, _ := l.x(session.End)
+		if x2 <= x1 {
+			continue
+		}
+		fill, ok := sessionColors[session.Name]
+		if !ok {
+			fill = sessionColors["Pre Market"]
+		}
+		cv.rect(x1, l.top, x2-x1, l.bottom-l.top, fill)
+		cv.text(x1+2, l.top+11, session.Name, color.RGBA{107, 114, 128, 255})
+	}
+}
+
+func drawAxes(cv canvas, l layout) {
+	const ticks = 6
+	for i := 0; i <= ticks; i++ {
+		price := l.low + (l.high-l.low)*float64(i)/ticks
+		y := l.y(price)
+		cv.line(l.left, y, l.right, y, grid, 1, false)
+		cv.text(l.right+4, y+4, fmt.Sprintf("%.2f", price), ink)
+	}
+
+	step := max(len(l.candles)/8, 1)
+	for i := 0; i < len(l.candles); i += step {
+		x := l.left + (float64(i)+0.5)*l.barWidth
+		cv.line(x, l.bottom, x, l.bottom+4, ink, 1, false)
+		cv.text(x-38, l.bottom+16, l.candles[i].Timestamp.In(newYork).Format("01-02 15:04"), ink)
+	}
+}
+
+func drawCandles(cv canvas, l layout) {
+	body := math.Max(l.barWidth*0.7, 1)
+	for i, bar := range l.candles {
+		x := l.left + (float64(i)+0.5)*l.barWidth
+		fill := up
+		if bar.Close < bar.Open {
+			fill = down
+		}
+		cv.line(x, l.y(bar.High), x, l.y(bar.Low), fill, 1, false)
+		top, bottom := l.y(math.Max(bar.Open, bar.Close)), l.y(math.Min(bar.Open, bar.Close))
+		cv.rect(x-body/2, top, body, math.Max(bottom-top, 1), fill)
+	}
+}
+
+func (c *Chart) drawGaps(cv canvas, l layout) {
+	for _, gap := range c.Gaps {
+		if gap.Candle == nil {
+			continue
+		}
+		x1, _ := l.x(gap.Candle.Timestamp)
+		x2 := l.right
+		switch {
+		case gap.State == strategy.GapInversed && gap.InversionCandle != nil:
+			x2, _ = l.x(gap.InversionCandle.Timestamp)
+		case gap.State == strategy.GapFilled && gap.LastAffectedCandle != nil:
+			x2, _ = l.x(gap.LastAffectedCandle.Timestamp)
+		}
+		x1 -= l.barWidth / 2
+		x2 += l.barWidth / 2
+		if x2 <= l.left || x1 >= l.right {
+			continue
+		}
+
+		top := l.y(math.Max(gap.StartPrice, gap.EndPrice))
+		bottom := l.y(math.Min(gap.StartPrice, gap.EndPrice))
+		cv.rect(math.Max(x1, l.left), top, math.Min(x2, l.right)-math.Max(x1, l.left), bottom-top, gapColors[gap.State])
+	}
+}
+
+func (c *Chart) drawPools(cv canvas, l layout) {
+	for _, pool := range c.Pools {
+		if pool.Candle == nil || !l.inRange(pool.Price) {
+			continue
+		}
+		stroke := sellside
+		if pool.Direction == strategy.Buyside {
+			stroke = buyside
+		}
+
+		x1, _ := l.x(pool.Candle.Timestamp)
+		x2 := l.right
+		if pool.RaidCandle != nil {
+			x2, _ = l.x(pool.RaidCandle.Timestamp)
+		}
+		y := l.y(pool.Price)
+		cv.line(x1, y, x2, y, stroke, 1.5, true)
+		cv.text(x1+2, y-3, pool.Name, stroke)
+
+		if pool.RaidCandle != nil {
+			if x, ok := l.x(pool.RaidCandle.Timestamp); ok {
+				cv.line(x-4, y-4, x+4, y+4, stroke, 2, false)
+				cv.line(x-4, y+4, x+4, y-4, stroke, 2, false)
+			}
+		}
+	}
+}
+
+func (c *Chart) drawPositions(cv canvas, l layout) {
+	for _, pos := range c.Positions {
+		if pos.EnterTime.IsZero() {
+			continue
+		}
+		x1, ok := l.x(pos.EnterTime)
+		if !ok && pos.EnterTime.After(l.candles[len(l.candles)-1].Timestamp) {
+			continue
+		}
+		x2 := l.right
+		if !pos.ExitTime.IsZero() {
+			x2, _ = l.x(pos.ExitTime)
+		}
+
+		if pos.StopLoss != 0 {
+			cv.line(x1, l.y(pos.StopLoss), x2, l.y(pos.StopLoss), stopLine, 1.5, false)
+		}
+		if pos.TakeProfit != 0 {
+			cv.line(x1, l.y(pos.TakeProfit), x2, l.y(pos.TakeProfit), targetLine, 1.5, false)
+		}
+
+		y := l.y(pos.EnterPrice)
+		if pos.IsLong() {
+			cv.polygon([][2]float64{{x1, y}, {x1 - 6, y + 10}, {x1 + 6, y + 10}}, up)
+		} else {
+			cv.polygon([][2]float64{{x1, y}, {x1 - 6, y - 10}, {x1 + 6, y - 10}}, down)
+		}
+
+		if pos.Status != position.PositionClosed {
+			continue
+		}
+		exitY := l.y(pos.ExitPrice)
+		cv.line(x1, y, x2, exitY, ink, 1, true)
+		exit := down
+		if pos.Points(pos.ExitPrice) > 0 {
+			exit = up
+		}
+		cv.rect(x2-4, exitY-4, 8, 8, exit)
+		cv.text(x2+6, exitY+4, string(pos.ExitReason), ink)
+	}
+}
+
+// Sessions returns the Asia, London, pre-market and New York sessions, in
+// New York time, that overlap start to end.
+func Sessions(start, end time.Time) []Session {
+	var sessions []Session
+	day := start.In(newYork).AddDate(0, 0, -1)
+	for ; !day.After(end.In(newYork).AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		at := func(hour, minute int) time.Time {
+			return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, newYork)
+		}
+		for _, session := range []Session{
+			{Name: "Asia", Start: at(-4, 0), End: at(3, 0)},
+			{Name: "London", Start: at(3, 0), End: at(7, 0)},
+			{Name: "Pre Market", Start: at(7, 0), End: at(9, 30)},
+			{Name: "New York", Start: at(9, 30), End: at(16, 0)},
+		} {
+			if session.End.After(start) && session.Start.Before(end) {
+				sessions = append(sessions, session)
+			}
+		}
+	}
+	return sessions
+}
+
+// ForPosition charts pos on candles with the liquidity pool and fair value
+// gap from its signal context and the sessions the window spans.
+func ForPosition(pos *position.Position, candles []candle.Candle) *Chart {
+	chart := &Chart{
+		Title:     fmt.Sprintf("%s %s %d %s", pos.EnterTime.In(newYork).Format("2006-01-02 15:04"), pos.Action, pos.Quantity, pos.TradedSymbol()),
+		Candles:   candles,
+		Positions: []*position.Position{pos},
+	}
+	if len(candles) > 0 {
+		chart.Sessions = Sessions(candles[0].Timestamp, candles[len(candles)-1].Timestamp)
+	}
+
+	ctx := pos.Context
+	if ctx == nil {
+		return chart
+	}
+	chart.Title += " " + ctx.Setup
+	if ctx.Pool != nil {
+		source, raid := ctx.Pool.Candle, ctx.Pool.RaidCandle
+		chart.Pools = append(chart.Pools, strategy.LiquidityPool{
+			Name:       ctx.Pool.Name,
+			Price:      ctx.Pool.Price,
+			Direction:  ctx.Pool.Direction,
+			Candle:     &source,
+			RaidCandle: &raid,
+		})
+	}
+	if ctx.Gap != nil {
+		created, inverted := ctx.Gap.Candle, ctx.Gap.InversionCandle
+		chart.Gaps = append(chart.Gaps, strategy.FairValueGap{
+			Direction:       ctx.Gap.Direction,
+			StartPrice:      ctx.Gap.StartPrice,
+			EndPrice:        ctx.Gap.EndPrice,
+			Candle:          &created,
+			State:           strategy.GapInversed,
+			InversionCandle: &inverted,
+		})
+	}
+	return chart
+}
+
+// TradeCandles loads the candles around pos: from padding bars before its
+// setup began, or its entry without a setup, to padding bars after its exit.
+func TradeCandles(ctx context.Context, repo candle.Repository, market string, timeframe candle.Timeframe, pos *position.Position, padding int) []candle.Candle {
+	start := pos.EnterTime
+	if pos.Context != nil && pos.Context.Gap != nil && pos.Context.Gap.Candle.Timestamp.Before(start) {
+		start = pos.Context.Gap.Candle.Timestamp
+	}
+	if pos.Context != nil && pos.Context.Pool != nil && !pos.Context.Pool.RaidCandle.Timestamp.IsZero() && pos.Context.Pool.RaidCandle.Timestamp.Before(start) {
+		start = pos.Context.Pool.RaidCandle.Timestamp
+	}
+	end := pos.ExitTime
+	if end.IsZero() {
+		end = pos.EnterTime
+	}
+
+	pad := time.Duration(padding) * timeframe.Duration()
+	return repo.GetCandles(ctx, market, pos.Symbol, timeframe, start.Add(-pad), end.Add(pad))
+}
+
+// TradeSVGs renders an SVG chart of every closed position in positions, for
+// embedding in a report.
+func TradeSVGs(ctx context.Context, repo candle.Repository, market string, timeframe candle.Timeframe, positions []*position.Position, padding int) []template.HTML {
+	var charts []template.HTML
+	for _, pos := range positions {
+		if pos.Status != position.PositionClosed {
+			continue
+		}
+		candles := TradeCandles(ctx, repo, market, timeframe, pos, padding)
+		charts = append(charts, template.HTML(ForPosition(pos, candles).SVG()))
+	}
+	return charts
+}
@@ -0,0 +1,89 @@
+package execution
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mgordon34/gostonks/analysis/internal/instrument"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// SlippageModel returns the adverse price move, in points, for filling
+// quantity contracts of inst at market on candle c.
+type SlippageModel interface {
+	Slippage(inst instrument.Instrument, c candle.Candle, quantity int) float64
+}
+
+// FixedSlippage slips a constant number of ticks on every market fill.
+type FixedSlippage struct {
+	Ticks float64
+}
+
+func (s FixedSlippage) Slippage(inst instrument.Instrument, c candle.Candle, quantity int) float64 {
+	return s.Ticks * inst.TickSize
+}
+
+// VolatilitySlippage slips a fraction of the fill bar's high-low range.
+type VolatilitySlippage struct {
+	Fraction float64
+}
+
+func (s VolatilitySlippage) Slippage(inst instrument.Instrument, c candle.Candle, quantity int) float64 {
+	return inst.RoundToTick(s.Fraction * (c.High - c.Low))
+}
+
+// VolumeSlippage slips ImpactTicks for every percent of the fill bar's volume
+// the order takes.
+type VolumeSlippage struct {
+	ImpactTicks float64
+}
+
+func (s VolumeSlippage) Slippage(inst instrument.Instrument, c candle.Candle, quantity int) float64 {
+	participation := 100 * float64(quantity) / float64(max(c.Volume, 1))
+	return inst.RoundToTick(s.ImpactTicks * participation * inst.TickSize)
+}
+
+// ParseSlippage builds a SlippageModel from a "model:parameter" spec such as
+// "fixed:1", "volatility:0.05" or "volume:0.5". "none" disables slippage.
+func ParseSlippage(spec string) (SlippageModel, error) {
+	if spec == "" || spec == "none" {
+		return nil, nil
+	}
+
+	model, param, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("slippage spec %q is missing a parameter", spec)
+	}
+	value, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid slippage parameter in %q: %w", spec, err)
+	}
+
+	switch model {
+	case "fixed":
+		return FixedSlippage{Ticks: value}, nil
+	case "volatility":
+		return VolatilitySlippage{Fraction: value}, nil
+	case "volume":
+		return VolumeSlippage{ImpactTicks: value}, nil
+	default:
+		return nil, fmt.Errorf("unknown slippage model %q", model)
+	}
+}
+
+// Costs are the trading costs applied to simulated fills. Market entries and
+// stop exits pay slippage; limit entries and targets fill at their price.
+// Commission and the instrument's exchange and NFA fees are charged per
+// contract on both entry and exit.
+type Costs struct {
+	Slippage   SlippageModel
+	Commission float64
+}
+
+func (c Costs) slippage(inst instrument.Instrument, bar candle.Candle, quantity int) float64 {
+	if c.Slippage == nil {
+		return 0
+	}
+	return c.Slippage.Slippage(inst, bar, quantity)
+}
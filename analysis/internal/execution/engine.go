@@ -0,0 +1,286 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/instrument"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// MarketFill controls the price market orders are filled at.
+type MarketFill string
+
+const (
+	// NextBarOpen fills at the open of the bar after the signal, the first
+	// price that could actually be traded once the signal bar has closed.
+	NextBarOpen MarketFill = "next_open"
+	// SignalClose fills at the signal price on the signal bar itself.
+	SignalClose MarketFill = "signal_close"
+)
+
+func ParseMarketFill(value string) (MarketFill, error) {
+	switch fill := MarketFill(value); fill {
+	case NextBarOpen, SignalClose:
+		return fill, nil
+	default:
+		return "", fmt.Errorf("unknown market fill %q", value)
+	}
+}
+
+type Config struct {
+	MarketFill MarketFill
+	Costs      Costs
+
+	// Intrabar, when set, is queried for IntrabarTimeframe candles to settle
+	// bars that touch both the stop and the target. Fallback settles them
+	// when there is no finer data.
+	Intrabar          candle.Repository
+	IntrabarTimeframe candle.Timeframe
+	Fallback          Resolution
+}
+
+// Engine simulates order execution against a candle stream. Signals become
+// pending positions that fill, exit at their stop or target, or are cancelled
+// at their CancelTime as later candles arrive.
+type Engine struct {
+	ctx         context.Context
+	config      Config
+	active      []*position.Position
+	last        map[string]candle.Candle
+	resolutions map[Resolution]int
+}
+
+func NewEngine(ctx context.Context, config Config) *Engine {
+	if config.MarketFill == "" {
+		config.MarketFill = NextBarOpen
+	}
+	if config.IntrabarTimeframe.IsZero() {
+		config.IntrabarTimeframe = candle.MustParseTimeframe("1s")
+	}
+	if config.Fallback == "" {
+		config.Fallback = ResolvedPessimistic
+	}
+
+	return &Engine{
+		ctx:         ctx,
+		config:      config,
+		last:        make(map[string]candle.Candle),
+		resolutions: make(map[Resolution]int),
+	}
+}
+
+// Submit turns a signal into a pending position for quantity contracts of
+// contract, or of the signal's symbol when contract is empty. With
+// SignalClose, market orders are filled immediately at the signal price.
+func (e *Engine) Submit(signal strategy.Signal, contract string, quantity int) *position.Position {
+	p := &position.Position{
+		Symbol:     signal.Symbol,
+		Contract:   contract,
+		Quantity:   quantity,
+		Action:     signal.Action,
+		Type:       signal.Type,
+		EnterPrice: signal.Price,
+		StopLoss:   signal.StopLoss,
+		TakeProfit: signal.TakeProfit,
+		Status:     position.PositionPending,
+		Timestamp:  signal.Timestamp,
+		CancelTime: signal.CancelTime,
+		Context:    signal.Context,
+	}
+
+	if p.Type == strategy.MarketOrder && e.config.MarketFill == SignalClose {
+		e.open(p, signal.Price, e.last[signal.Symbol], signal.Timestamp)
+	}
+
+	e.active = append(e.active, p)
+	return p
+}
+
+// ProcessCandle advances every active position on c's symbol and returns the
+// positions whose status changed on this candle.
+func (e *Engine) ProcessCandle(c candle.Candle) []*position.Position {
+	e.last[c.Symbol] = c
+
+	var changed []*position.Position
+	active := e.active[:0]
+
+	for _, p := range e.active {
+		if p.Symbol != c.Symbol || !c.Timestamp.After(p.Timestamp) {
+			active = append(active, p)
+			continue
+		}
+
+		status := p.Status
+		if p.Status == position.PositionPending {
+			e.fill(p, c)
+		}
+		if p.Status == position.PositionOpen {
+			e.exit(p, c)
+			excursion(p, c)
+		}
+
+		if p.Status != status {
+			changed = append(changed, p)
+		}
+		if p.IsOpen() {
+			active = append(active, p)
+		}
+	}
+
+	clear(e.active[len(active):])
+	e.active = active
+	return changed
+}
+
+// Active returns the pending and open positions.
+func (e *Engine) Active() []*position.Position {
+	return e.active
+}
+
+// Flatten cancels every pending order and closes every open position at the
+// last price seen for its symbol, paying exit costs as a market order would.
+// It returns the positions it changed.
+func (e *Engine) Flatten(ts time.Time) []*position.Position {
+	changed := e.active
+	for _, p := range e.active {
+		if p.Status == position.PositionPending {
+			p.Status = position.PositionCancelled
+			p.ExitReason = position.ExitFlattened
+			p.ExitTime = ts
+			continue
+		}
+
+		c := e.last[p.Symbol]
+		inst, _ := instrument.Lookup(p.TradedSymbol())
+		p.ExitSlippage = e.config.Costs.slippage(inst, c, p.Quantity)
+		p.Status = position.PositionClosed
+		p.ExitPrice = c.Close - p.ExitSlippage*p.Direction()
+		p.ExitTime = ts
+		p.ExitReason = position.ExitFlattened
+		p.Excursion(p.ExitPrice, p.ExitPrice)
+		e.charge(p, inst)
+	}
+
+	e.active = nil
+	return changed
+}
+
+func (e *Engine) fill(p *position.Position, c candle.Candle) {
+	if !p.CancelTime.IsZero() && !c.Timestamp.Before(p.CancelTime) {
+		p.Status = position.PositionCancelled
+		p.ExitReason = position.ExitExpired
+		p.ExitTime = c.Timestamp
+		return
+	}
+
+	switch p.Type {
+	case strategy.MarketOrder:
+		e.open(p, c.Open, c, c.Timestamp)
+	case strategy.LimitOrder:
+		// A limit order fills once price trades through it, or at the open
+		// when the bar gaps past the limit.
+		if p.IsLong() && c.Low <= p.EnterPrice {
+			e.open(p, math.Min(c.Open, p.EnterPrice), c, c.Timestamp)
+		} else if !p.IsLong() && c.High >= p.EnterPrice {
+			e.open(p, math.Max(c.Open, p.EnterPrice), c, c.Timestamp)
+		}
+	}
+}
+
+// open fills p at price on bar c, charging entry costs.
+func (e *Engine) open(p *position.Position, price float64, c candle.Candle, ts time.Time) {
+	inst, _ := instrument.Lookup(p.TradedSymbol())
+	if p.Type == strategy.MarketOrder {
+		p.EntrySlippage = e.config.Costs.slippage(inst, c, p.Quantity)
+	}
+
+	p.Status = position.PositionOpen
+	p.EnterPrice = price + p.EntrySlippage*p.Direction()
+	p.EnterTime = ts
+	e.charge(p, inst)
+}
+
+// charge adds one side of commission and fees for p's quantity.
+func (e *Engine) charge(p *position.Position, inst instrument.Instrument) {
+	p.Commission += e.config.Costs.Commission * float64(p.Quantity)
+	p.Fees += inst.FeesPerSide() * float64(p.Quantity)
+}
+
+// exit closes p at its stop or target if c reaches either, at the open when
+// the bar gaps through the level. A bar that reaches both is settled by
+// resolve.
+func (e *Engine) exit(p *position.Position, c candle.Candle) {
+	stopHit, targetHit := touches(p, c)
+	exitTime := c.Timestamp
+
+	var reason position.ExitReason
+	switch {
+	case stopHit && targetHit:
+		reason, exitTime = e.resolve(p, c)
+	case stopHit:
+		reason = position.ExitStopLoss
+	case targetHit:
+		reason = position.ExitTakeProfit
+	default:
+		return
+	}
+
+	level := p.StopLoss
+	if reason == position.ExitTakeProfit {
+		level = p.TakeProfit
+	}
+
+	inst, _ := instrument.Lookup(p.TradedSymbol())
+	if reason == position.ExitStopLoss {
+		p.ExitSlippage = e.config.Costs.slippage(inst, c, p.Quantity)
+	}
+
+	p.Status = position.PositionClosed
+	p.ExitPrice = exitPrice(p, level, c.Open, reason) - p.ExitSlippage*p.Direction()
+	p.ExitTime = exitTime
+	p.ExitReason = reason
+	e.charge(p, inst)
+}
+
+// excursion records the range p was exposed to on c. On the exit bar price
+// is taken to have gone no further than the exit in the exit's direction.
+func excursion(p *position.Position, c candle.Candle) {
+	high, low := c.High, c.Low
+	if p.Status == position.PositionClosed {
+		if p.IsLong() == (p.ExitReason == position.ExitTakeProfit) {
+			high = min(high, p.ExitPrice)
+		} else {
+			low = max(low, p.ExitPrice)
+		}
+	}
+	p.Excursion(high, low)
+}
+
+// touches reports whether c traded through p's stop and target.
+func touches(p *position.Position, c candle.Candle) (stopHit bool, targetHit bool) {
+	if p.IsLong() {
+		stopHit = p.StopLoss != 0 && c.Low <= p.StopLoss
+		targetHit = p.TakeProfit != 0 && c.High >= p.TakeProfit
+	} else {
+		stopHit = p.StopLoss != 0 && c.High >= p.StopLoss
+		targetHit = p.TakeProfit != 0 && c.Low <= p.TakeProfit
+	}
+	return stopHit, targetHit
+}
+
+// exitPrice returns the fill for an exit at level, or the open when the bar
+// opened beyond the level.
+func exitPrice(p *position.Position, level float64, open float64, reason position.ExitReason) float64 {
+	// Long stops and short targets rest below the market, the other two
+	// above it.
+	below := p.IsLong() == (reason == position.ExitStopLoss)
+	if below && open < level || !below && open > level {
+		return open
+	}
+	return level
+}
@@ -0,0 +1,171 @@
+package execution
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+func TestEngineFills(t *testing.T) {
+	t0 := time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+	t1, t2 := t0.Add(time.Minute), t0.Add(2*time.Minute)
+
+	// Two NQ contracts pay $2.50 commission and $1.40 exchange and NFA fees
+	// each per side; market entries and stops slip one 0.25 tick.
+	const oneSide, feesOneSide = 5, 2.8
+
+	tests := []struct {
+		name   string
+		fill   MarketFill
+		signal strategy.Signal
+		bars   []candle.Candle
+
+		status     position.PositionStatus
+		reason     position.ExitReason
+		enter      float64
+		enterTime  time.Time
+		exit       float64
+		exitTime   time.Time
+		commission float64
+		fees       float64
+	}{
+		{
+			name:   "market long fills at the next open and exits at its target",
+			signal: strategy.Signal{Action: strategy.BuyAction, Type: strategy.MarketOrder, Price: 101, StopLoss: 95, TakeProfit: 110},
+			bars: []candle.Candle{
+				bar("1m", t1, 100, 103, 99, 102),
+				bar("1m", t2, 102, 111, 101, 110),
+			},
+			status: position.PositionClosed, reason: position.ExitTakeProfit,
+			enter: 100.25, enterTime: t1, exit: 110, exitTime: t2,
+			commission: 2 * oneSide, fees: 2 * feesOneSide,
+		},
+		{
+			name:   "market short stopped out pays slippage both ways",
+			signal: strategy.Signal{Action: strategy.SellAction, Type: strategy.MarketOrder, Price: 99, StopLoss: 105, TakeProfit: 90},
+			bars: []candle.Candle{
+				bar("1m", t1, 100, 101, 98, 99),
+				bar("1m", t2, 101, 106, 100, 104),
+			},
+			status: position.PositionClosed, reason: position.ExitStopLoss,
+			enter: 99.75, enterTime: t1, exit: 105.25, exitTime: t2,
+			commission: 2 * oneSide, fees: 2 * feesOneSide,
+		},
+		{
+			name:   "stop gapped through exits at the open",
+			signal: strategy.Signal{Action: strategy.BuyAction, Type: strategy.MarketOrder, Price: 101, StopLoss: 95, TakeProfit: 110},
+			bars: []candle.Candle{
+				bar("1m", t1, 100, 101, 99, 100),
+				bar("1m", t2, 93, 94, 90, 91),
+			},
+			status: position.PositionClosed, reason: position.ExitStopLoss,
+			enter: 100.25, enterTime: t1, exit: 92.75, exitTime: t2,
+			commission: 2 * oneSide, fees: 2 * feesOneSide,
+		},
+		{
+			name:   "limit long fills at its price without slippage",
+			signal: strategy.Signal{Action: strategy.BuyAction, Type: strategy.LimitOrder, Price: 98, StopLoss: 95, TakeProfit: 110},
+			bars: []candle.Candle{
+				bar("1m", t1, 100, 101, 99, 100),
+				bar("1m", t2, 100, 101, 97.5, 100),
+			},
+			status: position.PositionOpen,
+			enter:  98, enterTime: t2,
+			commission: oneSide, fees: feesOneSide,
+		},
+		{
+			name:   "limit long fills at an open below it",
+			signal: strategy.Signal{Action: strategy.BuyAction, Type: strategy.LimitOrder, Price: 98, StopLoss: 95, TakeProfit: 110},
+			bars: []candle.Candle{
+				bar("1m", t1, 97, 99, 96, 98),
+			},
+			status: position.PositionOpen,
+			enter:  97, enterTime: t1,
+			commission: oneSide, fees: feesOneSide,
+		},
+		{
+			name:   "unfilled limit expires at its cancel time",
+			signal: strategy.Signal{Action: strategy.BuyAction, Type: strategy.LimitOrder, Price: 90, StopLoss: 85, TakeProfit: 110, CancelTime: t2},
+			bars: []candle.Candle{
+				bar("1m", t1, 100, 101, 99, 100),
+				bar("1m", t2, 100, 101, 89, 100),
+			},
+			status: position.PositionCancelled, reason: position.ExitExpired,
+			enter: 90, exitTime: t2,
+		},
+		{
+			name:   "signal close fills on the signal bar",
+			fill:   SignalClose,
+			signal: strategy.Signal{Action: strategy.BuyAction, Type: strategy.MarketOrder, Price: 100, StopLoss: 95, TakeProfit: 110},
+			status: position.PositionOpen,
+			enter:  100.25, enterTime: t0,
+			commission: oneSide, fees: feesOneSide,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEngine(context.Background(), Config{
+				MarketFill: tt.fill,
+				Costs:      Costs{Slippage: FixedSlippage{Ticks: 1}, Commission: 2.5},
+			})
+			e.ProcessCandle(bar("1m", t0, 100, 101, 99, 100))
+
+			signal := tt.signal
+			signal.Symbol = "NQZ4"
+			signal.Timestamp = t0
+			p := e.Submit(signal, "", 2)
+			for _, c := range tt.bars {
+				e.ProcessCandle(c)
+			}
+
+			if p.Status != tt.status || p.ExitReason != tt.reason {
+				t.Fatalf("status = %s (%s), want %s (%s)", p.Status, p.ExitReason, tt.status, tt.reason)
+			}
+			if p.EnterPrice != tt.enter || !p.EnterTime.Equal(tt.enterTime) {
+				t.Errorf("entry = %v at %v, want %v at %v", p.EnterPrice, p.EnterTime, tt.enter, tt.enterTime)
+			}
+			if p.ExitPrice != tt.exit || !p.ExitTime.Equal(tt.exitTime) {
+				t.Errorf("exit = %v at %v, want %v at %v", p.ExitPrice, p.ExitTime, tt.exit, tt.exitTime)
+			}
+			if p.Commission != tt.commission || !near(p.Fees, tt.fees) {
+				t.Errorf("commission, fees = %v, %v, want %v, %v", p.Commission, p.Fees, tt.commission, tt.fees)
+			}
+		})
+	}
+}
+
+func TestFlattenClosesAtTheLastClose(t *testing.T) {
+	t0 := time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+	e := NewEngine(context.Background(), Config{
+		Costs: Costs{Slippage: FixedSlippage{Ticks: 2}, Commission: 1},
+	})
+	e.ProcessCandle(bar("1m", t0, 100, 101, 99, 100))
+	long := e.Submit(strategy.Signal{Symbol: "NQZ4", Action: strategy.BuyAction, Type: strategy.MarketOrder, Price: 100, StopLoss: 90, Timestamp: t0}, "", 1)
+	limit := e.Submit(strategy.Signal{Symbol: "NQZ4", Action: strategy.BuyAction, Type: strategy.LimitOrder, Price: 80, StopLoss: 70, Timestamp: t0}, "", 1)
+	e.ProcessCandle(bar("1m", t0.Add(time.Minute), 100, 104, 99, 103))
+
+	changed := e.Flatten(t0.Add(2 * time.Minute))
+	if len(changed) != 2 || len(e.Active()) != 0 {
+		t.Fatalf("flatten changed %d positions leaving %d active, want 2 and 0", len(changed), len(e.Active()))
+	}
+	// Entry at 100 + 0.5, exit at 103 - 0.5.
+	if long.Status != position.PositionClosed || long.EnterPrice != 100.5 || long.ExitPrice != 102.5 {
+		t.Errorf("long = %s %v -> %v, want closed 100.5 -> 102.5", long.Status, long.EnterPrice, long.ExitPrice)
+	}
+	if long.Commission != 2 || !near(long.Fees, 2.8) {
+		t.Errorf("long commission, fees = %v, %v, want 2, 2.8", long.Commission, long.Fees)
+	}
+	if limit.Status != position.PositionCancelled || limit.ExitReason != position.ExitFlattened {
+		t.Errorf("limit = %s (%s), want cancelled (flattened)", limit.Status, limit.ExitReason)
+	}
+}
+
+func near(got, want float64) bool {
+	const epsilon = 1e-9
+	return got-want < epsilon && want-got < epsilon
+}
@@ -0,0 +1,108 @@
+package execution
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// Resolution records how a bar that touched both a position's stop and its
+// target was settled. The fallback resolutions double as the policies used
+// when no finer data is available.
+type Resolution string
+
+const (
+	// ResolvedIntrabar means finer candles showed which level traded first.
+	ResolvedIntrabar Resolution = "intrabar"
+	// ResolvedPessimistic assumes the stop traded first.
+	ResolvedPessimistic Resolution = "pessimistic"
+	// ResolvedOptimistic assumes the target traded first.
+	ResolvedOptimistic Resolution = "optimistic"
+	// ResolvedOHLCPath assumes the bar went open, nearer extreme, farther
+	// extreme, close.
+	ResolvedOHLCPath Resolution = "ohlc_path"
+)
+
+func ParseFallback(value string) (Resolution, error) {
+	switch r := Resolution(value); r {
+	case ResolvedPessimistic, ResolvedOptimistic, ResolvedOHLCPath:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown intrabar fallback %q", value)
+	}
+}
+
+// resolve decides whether p's stop or target was hit first on c, drilling
+// into finer candles when the engine has an intrabar repository. It returns
+// the exit reason and the time of the candle that decided it.
+func (e *Engine) resolve(p *position.Position, c candle.Candle) (position.ExitReason, time.Time) {
+	for _, fine := range e.finerCandles(p, c) {
+		stopHit, targetHit := touches(p, fine)
+		switch {
+		case stopHit && targetHit:
+			return e.fallback(p, fine), fine.Timestamp
+		case stopHit:
+			e.resolutions[ResolvedIntrabar]++
+			return position.ExitStopLoss, fine.Timestamp
+		case targetHit:
+			e.resolutions[ResolvedIntrabar]++
+			return position.ExitTakeProfit, fine.Timestamp
+		}
+	}
+
+	return e.fallback(p, c), c.Timestamp
+}
+
+// finerCandles returns the intrabar candles of c that p could have exited
+// on. Candles before a limit entry filled on the same bar are skipped; market
+// entries fill at the open, so every candle counts however far they slipped.
+func (e *Engine) finerCandles(p *position.Position, c candle.Candle) []candle.Candle {
+	if e.config.Intrabar == nil || c.Timeframe.Duration() <= e.config.IntrabarTimeframe.Duration() {
+		return nil
+	}
+
+	end := c.Timestamp.Add(c.Timeframe.Duration() - time.Nanosecond)
+	candles := e.config.Intrabar.GetCandles(e.ctx, c.Market, c.Symbol, e.config.IntrabarTimeframe, c.Timestamp, end)
+	if p.Type != strategy.LimitOrder || !p.EnterTime.Equal(c.Timestamp) {
+		return candles
+	}
+
+	// The fill is found by the traded price, before any slippage.
+	price := p.EnterPrice - p.EntrySlippage*p.Direction()
+	for i, fine := range candles {
+		if fine.Low <= price && fine.High >= price {
+			return candles[i:]
+		}
+	}
+	return nil
+}
+
+func (e *Engine) fallback(p *position.Position, c candle.Candle) position.ExitReason {
+	policy := e.config.Fallback
+	e.resolutions[policy]++
+
+	switch policy {
+	case ResolvedOptimistic:
+		return position.ExitTakeProfit
+	case ResolvedOHLCPath:
+		highFirst := c.High-c.Open < c.Open-c.Low
+		if highFirst == p.IsLong() {
+			return position.ExitTakeProfit
+		}
+		return position.ExitStopLoss
+	default:
+		return position.ExitStopLoss
+	}
+}
+
+// Resolutions returns how many ambiguous exits were settled by each method.
+func (e *Engine) Resolutions() map[Resolution]int {
+	counts := make(map[Resolution]int, len(e.resolutions))
+	for r, n := range e.resolutions {
+		counts[r] = n
+	}
+	return counts
+}
@@ -0,0 +1,107 @@
+package execution
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// bar is an NQZ4 candle of timeframe starting at ts.
+func bar(timeframe string, ts time.Time, open, high, low, close float64) candle.Candle {
+	return candle.Candle{
+		Market:    "futures",
+		Symbol:    "NQZ4",
+		Timeframe: candle.MustParseTimeframe(timeframe),
+		Open:      open,
+		High:      high,
+		Low:       low,
+		Close:     close,
+		Timestamp: ts,
+	}
+}
+
+func TestResolveFromIntrabarCandles(t *testing.T) {
+	signal := time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+	fill := signal.Add(time.Minute)
+
+	tests := []struct {
+		name     string
+		order    strategy.OrderType
+		price    float64
+		slippage float64
+		seconds  []candle.Candle
+		want     position.ExitReason
+		wantTime time.Time
+		// wantEntry is the entry price after slippage.
+		wantEntry float64
+	}{
+		{
+			// The market fill slips a point above the open, so its entry
+			// price is never the open. The stop traded first at 09:31:01.
+			name:     "slipped market fill counts every second of the bar",
+			order:    strategy.MarketOrder,
+			slippage: 4,
+			seconds: []candle.Candle{
+				bar("1s", fill, 100, 100, 100, 100),
+				bar("1s", fill.Add(time.Second), 100, 100, 95, 96),
+				bar("1s", fill.Add(2*time.Second), 96, 105, 96, 104),
+			},
+			want:      position.ExitStopLoss,
+			wantTime:  fill.Add(time.Second),
+			wantEntry: 101,
+		},
+		{
+			// The target traded before the limit filled, so only the stop
+			// after the fill can close the position.
+			name:  "limit fill skips seconds before the fill",
+			order: strategy.LimitOrder,
+			price: 98,
+			seconds: []candle.Candle{
+				bar("1s", fill, 100, 105, 100, 104),
+				bar("1s", fill.Add(time.Second), 101, 101, 97, 97),
+				bar("1s", fill.Add(2*time.Second), 97, 97, 95, 96),
+			},
+			want:      position.ExitStopLoss,
+			wantTime:  fill.Add(2 * time.Second),
+			wantEntry: 98,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intrabar := candle.NewMemoryRepository()
+			intrabar.Load(tt.seconds)
+
+			e := NewEngine(context.Background(), Config{
+				Costs:    Costs{Slippage: FixedSlippage{Ticks: tt.slippage}},
+				Intrabar: intrabar,
+				Fallback: ResolvedOptimistic,
+			})
+			e.ProcessCandle(bar("1m", signal, 100, 100, 100, 100))
+			p := e.Submit(strategy.Signal{
+				Symbol:     "NQZ4",
+				Action:     strategy.BuyAction,
+				Type:       tt.order,
+				Price:      tt.price,
+				StopLoss:   96,
+				TakeProfit: 104,
+				Timestamp:  signal,
+			}, "", 1)
+			e.ProcessCandle(bar("1m", fill, 100, 105, 95, 100))
+
+			if p.EnterPrice != tt.wantEntry {
+				t.Errorf("entry = %v, want %v", p.EnterPrice, tt.wantEntry)
+			}
+			if p.ExitReason != tt.want || !p.ExitTime.Equal(tt.wantTime) {
+				t.Errorf("exit = %s at %v, want %s at %v", p.ExitReason, p.ExitTime, tt.want, tt.wantTime)
+			}
+			if got := e.Resolutions()[ResolvedIntrabar]; got != 1 {
+				t.Errorf("intrabar resolutions = %d, want 1", got)
+			}
+		})
+	}
+}
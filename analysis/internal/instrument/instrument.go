@@ -0,0 +1,72 @@
+package instrument
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Instrument holds the contract specification, per-side exchange fees and
+// per-contract margins for a futures root symbol.
+type Instrument struct {
+	Symbol            string
+	TickSize          float64
+	PointValue        float64
+	ExchangeFee       float64
+	NFAFee            float64
+	InitialMargin     float64
+	MaintenanceMargin float64
+
+	// Micro names the micro contract on the same index, if there is one.
+	Micro string
+}
+
+// TickValue is the dollar value of one tick for one contract.
+func (i Instrument) TickValue() float64 {
+	return i.TickSize * i.PointValue
+}
+
+// FeesPerSide is the exchange and regulatory fee charged per contract on
+// each entry or exit.
+func (i Instrument) FeesPerSide() float64 {
+	return i.ExchangeFee + i.NFAFee
+}
+
+// RoundToTick rounds price to the nearest tradable tick.
+func (i Instrument) RoundToTick(price float64) float64 {
+	if i.TickSize == 0 {
+		return price
+	}
+	return math.Round(price/i.TickSize) * i.TickSize
+}
+
+// CME non-member fees and outright margins; update alongside exchange
+// schedule changes.
+var instruments = map[string]Instrument{
+	"NQ":  {Symbol: "NQ", TickSize: 0.25, PointValue: 20, ExchangeFee: 1.38, NFAFee: 0.02, InitialMargin: 26400, MaintenanceMargin: 24000, Micro: "MNQ"},
+	"MNQ": {Symbol: "MNQ", TickSize: 0.25, PointValue: 2, ExchangeFee: 0.35, NFAFee: 0.02, InitialMargin: 2640, MaintenanceMargin: 2400},
+	"ES":  {Symbol: "ES", TickSize: 0.25, PointValue: 50, ExchangeFee: 1.38, NFAFee: 0.02, InitialMargin: 13915, MaintenanceMargin: 12650, Micro: "MES"},
+	"MES": {Symbol: "MES", TickSize: 0.25, PointValue: 5, ExchangeFee: 0.35, NFAFee: 0.02, InitialMargin: 1392, MaintenanceMargin: 1265},
+}
+
+// Lookup returns the specification for symbol, which may be a root (NQ) or
+// a dated contract (NQZ4).
+func Lookup(symbol string) (Instrument, bool) {
+	if inst, ok := instruments[symbol]; ok {
+		return inst, true
+	}
+	inst, ok := instruments[Root(symbol)]
+	return inst, ok
+}
+
+// Root strips a trailing futures month code and year from a contract symbol.
+func Root(symbol string) string {
+	trimmed := strings.TrimRightFunc(symbol, unicode.IsDigit)
+	if len(trimmed) < 2 || len(trimmed) == len(symbol) {
+		return symbol
+	}
+	if strings.ContainsRune("FGHJKMNQUVXZ", rune(trimmed[len(trimmed)-1])) {
+		return trimmed[:len(trimmed)-1]
+	}
+	return symbol
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+var newYork = loadNewYork()
+
+func loadNewYork() *time.Location {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		log.Fatalf("failed to load America/New_York location: %v", err)
+	}
+	return location
+}
+
+// Breakdown aggregates the trades sharing a key, such as an entry hour.
+type Breakdown struct {
+	Key     string  `json:"key"`
+	Trades  int     `json:"trades"`
+	Wins    int     `json:"wins"`
+	WinRate float64 `json:"win_rate"`
+	NetPnL  float64 `json:"net_pnl"`
+	// order sorts breakdowns chronologically rather than by key.
+	order int
+}
+
+// breakdown groups trades by the key each maps to.
+func breakdown(trades []Trade, key func(Trade) (string, int)) []Breakdown {
+	groups := make(map[string]*Breakdown)
+	for _, trade := range trades {
+		name, order := key(trade)
+		group, ok := groups[name]
+		if !ok {
+			group = &Breakdown{Key: name, order: order}
+			groups[name] = group
+		}
+		group.Trades++
+		group.NetPnL += trade.NetPnL
+		if trade.NetPnL > 0 {
+			group.Wins++
+		}
+	}
+
+	breakdowns := make([]Breakdown, 0, len(groups))
+	for _, group := range groups {
+		group.WinRate = float64(group.Wins) / float64(group.Trades)
+		breakdowns = append(breakdowns, *group)
+	}
+	sort.Slice(breakdowns, func(i, j int) bool {
+		if breakdowns[i].order != breakdowns[j].order {
+			return breakdowns[i].order < breakdowns[j].order
+		}
+		return breakdowns[i].Key < breakdowns[j].Key
+	})
+	return breakdowns
+}
+
+// setupOf names the setup and raided pool a trade was taken on.
+func setupOf(trade Trade) (string, int) {
+	switch {
+	case trade.Setup == "":
+		return "unknown", 0
+	case trade.Pool == "":
+		return trade.Setup, 0
+	default:
+		return fmt.Sprintf("%s: %s", trade.Setup, trade.Pool), 0
+	}
+}
+
+// sessionOf names the New York time window a trade was entered in, using
+// the same session boundaries as the strategies.
+func sessionOf(trade Trade) (string, int) {
+	local := trade.EnterTime.In(newYork)
+	minutes := local.Hour()*60 + local.Minute()
+	switch {
+	case minutes >= 20*60 || minutes < 3*60:
+		return "Asia", 0
+	case minutes < 7*60:
+		return "London", 1
+	case minutes < 9*60+30:
+		return "Pre Market", 2
+	case minutes < 12*60:
+		return "New York AM", 3
+	case minutes < 16*60:
+		return "New York PM", 4
+	default:
+		return "After Hours", 5
+	}
+}
+
+func weekdayOf(trade Trade) (string, int) {
+	weekday := trade.EnterTime.In(newYork).Weekday()
+	return weekday.String(), int(weekday)
+}
+
+func hourOf(trade Trade) (string, int) {
+	hour := trade.EnterTime.In(newYork).Hour()
+	return fmt.Sprintf("%02d:00", hour), hour
+}
+
+// sessionDate is the futures trading day ts belongs to; sessions roll at
+// 18:00 New York time.
+func sessionDate(ts time.Time) string {
+	local := ts.In(newYork)
+	if local.Hour() >= 18 {
+		local = local.AddDate(0, 0, 1)
+	}
+	return local.Format("2006-01-02")
+}
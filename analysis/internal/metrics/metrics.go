@@ -0,0 +1,271 @@
+// Package metrics summarises a finished backtest from its closed positions
+// and equity curve.
+package metrics
+
+import (
+	"html/template"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/instrument"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+)
+
+// tradingDays annualises daily Sharpe and Sortino ratios.
+const tradingDays = 252
+
+type Report struct {
+	Name           string    `json:"name"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	StartingEquity float64   `json:"starting_equity"`
+	EndingEquity   float64   `json:"ending_equity"`
+
+	NetPnL float64 `json:"net_pnl"`
+	// WinningPnL and LosingPnL total the net P&L of the winning and losing
+	// trades, the losses as a positive amount.
+	WinningPnL   float64 `json:"winning_pnl"`
+	LosingPnL    float64 `json:"losing_pnl"`
+	Costs        float64 `json:"costs"`
+	Trades       int     `json:"trades"`
+	Wins         int     `json:"wins"`
+	Losses       int     `json:"losses"`
+	WinRate      float64 `json:"win_rate"`
+	AverageWin   float64 `json:"average_win"`
+	AverageLoss  float64 `json:"average_loss"`
+	AverageR     float64 `json:"average_r"`
+	Expectancy   float64 `json:"expectancy"`
+	ProfitFactor float64 `json:"profit_factor"`
+	TradesPerDay float64 `json:"trades_per_day"`
+
+	MaxDrawdown         float64  `json:"max_drawdown"`
+	MaxDrawdownPct      float64  `json:"max_drawdown_pct"`
+	MaxDrawdownDuration Duration `json:"max_drawdown_duration"`
+
+	AnnualReturn float64 `json:"annual_return"`
+	Sharpe       float64 `json:"sharpe"`
+	Sortino      float64 `json:"sortino"`
+	Calmar       float64 `json:"calmar"`
+
+	BySetup   []Breakdown `json:"by_setup"`
+	BySession []Breakdown `json:"by_session"`
+	ByWeekday []Breakdown `json:"by_weekday"`
+	ByHour    []Breakdown `json:"by_hour"`
+
+	TradeLog    []Trade                 `json:"trade_log"`
+	EquityCurve []portfolio.EquityPoint `json:"-"`
+	// TradeCharts are SVG charts shown in the HTML report, one per trade.
+	TradeCharts []template.HTML `json:"-"`
+}
+
+// Trade is one closed position as it appears in a report.
+type Trade struct {
+	Symbol     string              `json:"symbol"`
+	Contract   string              `json:"contract"`
+	Action     string              `json:"action"`
+	Quantity   int                 `json:"quantity"`
+	EnterTime  time.Time           `json:"enter_time"`
+	ExitTime   time.Time           `json:"exit_time"`
+	EnterPrice float64             `json:"enter_price"`
+	ExitPrice  float64             `json:"exit_price"`
+	StopLoss   float64             `json:"stop_loss"`
+	TakeProfit float64             `json:"take_profit"`
+	ExitReason position.ExitReason `json:"exit_reason"`
+	Setup      string              `json:"setup,omitempty"`
+	Pool       string              `json:"pool,omitempty"`
+	NetPnL     float64             `json:"net_pnl"`
+	R          float64             `json:"r"`
+	// MAE and MFE are in dollars for the traded quantity.
+	MAE float64 `json:"mae"`
+	MFE float64 `json:"mfe"`
+}
+
+// Duration marshals as a Go duration string such as "26h30m0s".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	*d = Duration(parsed)
+	return err
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Compute builds a report from a portfolio's positions and equity curve.
+// Only closed positions count as trades.
+func Compute(name string, balance float64, positions []*position.Position, curve []portfolio.EquityPoint) Report {
+	report := Report{
+		Name:           name,
+		StartingEquity: balance,
+		EndingEquity:   balance,
+		EquityCurve:    curve,
+	}
+	if len(curve) > 0 {
+		report.Start = curve[0].Timestamp
+		report.End = curve[len(curve)-1].Timestamp
+		report.EndingEquity = curve[len(curve)-1].Equity
+	}
+
+	var totalR float64
+	for _, pos := range positions {
+		if pos.Status != position.PositionClosed {
+			continue
+		}
+		trade := newTrade(pos)
+		report.TradeLog = append(report.TradeLog, trade)
+
+		report.NetPnL += trade.NetPnL
+		report.Costs += pos.Commission + pos.Fees
+		totalR += trade.R
+		if trade.NetPnL > 0 {
+			report.Wins++
+			report.WinningPnL += trade.NetPnL
+		} else {
+			report.Losses++
+			report.LosingPnL -= trade.NetPnL
+		}
+	}
+	sort.SliceStable(report.TradeLog, func(i, j int) bool {
+		return report.TradeLog[i].ExitTime.Before(report.TradeLog[j].ExitTime)
+	})
+
+	report.Trades = len(report.TradeLog)
+	if report.Trades > 0 {
+		report.WinRate = float64(report.Wins) / float64(report.Trades)
+		report.AverageR = totalR / float64(report.Trades)
+		report.Expectancy = report.NetPnL / float64(report.Trades)
+	}
+	if report.Wins > 0 {
+		report.AverageWin = report.WinningPnL / float64(report.Wins)
+	}
+	if report.Losses > 0 {
+		report.AverageLoss = report.LosingPnL / float64(report.Losses)
+	}
+	if report.LosingPnL > 0 {
+		report.ProfitFactor = report.WinningPnL / report.LosingPnL
+	}
+
+	report.drawdown(curve)
+	report.ratios(curve)
+	report.BySetup = breakdown(report.TradeLog, setupOf)
+	report.BySession = breakdown(report.TradeLog, sessionOf)
+	report.ByWeekday = breakdown(report.TradeLog, weekdayOf)
+	report.ByHour = breakdown(report.TradeLog, hourOf)
+	return report
+}
+
+func newTrade(pos *position.Position) Trade {
+	inst, _ := instrument.Lookup(pos.TradedSymbol())
+	dollars := inst.PointValue * float64(pos.Quantity)
+	trade := Trade{
+		Symbol:     pos.Symbol,
+		Contract:   pos.TradedSymbol(),
+		Action:     string(pos.Action),
+		Quantity:   pos.Quantity,
+		EnterTime:  pos.EnterTime,
+		ExitTime:   pos.ExitTime,
+		EnterPrice: pos.EnterPrice,
+		ExitPrice:  pos.ExitPrice,
+		StopLoss:   pos.StopLoss,
+		TakeProfit: pos.TakeProfit,
+		ExitReason: pos.ExitReason,
+		NetPnL:     portfolio.NetPnL(pos),
+		R:          pos.RMultiple(),
+		MAE:        pos.MAE * dollars,
+		MFE:        pos.MFE * dollars,
+		Setup:      pos.Setup(),
+	}
+	if pos.Context != nil && pos.Context.Pool != nil {
+		trade.Pool = pos.Context.Pool.Name
+	}
+	return trade
+}
+
+// drawdown finds the deepest drop from a peak and the longest time spent
+// below a peak, including an unrecovered drawdown at the end of the curve.
+func (r *Report) drawdown(curve []portfolio.EquityPoint) {
+	var peakTime time.Time
+	for i, point := range curve {
+		if point.Drawdown > r.MaxDrawdown {
+			r.MaxDrawdown = point.Drawdown
+		}
+		r.MaxDrawdownPct = math.Max(r.MaxDrawdownPct, point.DrawdownPct)
+
+		if i == 0 || point.Drawdown == 0 {
+			peakTime = point.Timestamp
+			continue
+		}
+		if length := Duration(point.Timestamp.Sub(peakTime)); length > r.MaxDrawdownDuration {
+			r.MaxDrawdownDuration = length
+		}
+	}
+}
+
+// ratios computes annualised return, Sharpe, Sortino and Calmar from daily
+// closing equity, and trades per trading session.
+func (r *Report) ratios(curve []portfolio.EquityPoint) {
+	if len(curve) == 0 || r.StartingEquity <= 0 {
+		return
+	}
+
+	years := r.End.Sub(r.Start).Hours() / 24 / 365
+	if years > 0 && r.EndingEquity > 0 {
+		r.AnnualReturn = math.Pow(r.EndingEquity/r.StartingEquity, 1/years) - 1
+	}
+	if r.MaxDrawdownPct > 0 {
+		r.Calmar = r.AnnualReturn / r.MaxDrawdownPct
+	}
+	returns := dailyReturns(r.StartingEquity, curve)
+	r.TradesPerDay = float64(r.Trades) / float64(len(returns))
+	if len(returns) < 2 {
+		return
+	}
+	var mean float64
+	for _, ret := range returns {
+		mean += ret
+	}
+	mean /= float64(len(returns))
+
+	var variance, downside float64
+	for _, ret := range returns {
+		variance += (ret - mean) * (ret - mean)
+		if ret < 0 {
+			downside += ret * ret
+		}
+	}
+	stddev := math.Sqrt(variance / float64(len(returns)-1))
+	downsideDev := math.Sqrt(downside / float64(len(returns)))
+
+	annualise := math.Sqrt(tradingDays)
+	if stddev > 0 {
+		r.Sharpe = mean / stddev * annualise
+	}
+	if downsideDev > 0 {
+		r.Sortino = mean / downsideDev * annualise
+	}
+}
+
+// dailyReturns are the returns between each trading session's last equity
+// point and the one before it.
+func dailyReturns(balance float64, curve []portfolio.EquityPoint) []float64 {
+	var returns []float64
+	previous := balance
+	for i, point := range curve {
+		if i+1 < len(curve) && sessionDate(curve[i+1].Timestamp) == sessionDate(point.Timestamp) {
+			continue
+		}
+		if previous > 0 {
+			returns = append(returns, point.Equity/previous-1)
+		}
+		previous = point.Equity
+	}
+	return returns
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+)
+
+func TestCompute(t *testing.T) {
+	day := time.Date(2024, 10, 7, 13, 30, 0, 0, time.UTC)
+	trade := func(action strategy.Action, exit, stop float64, exitTime time.Time) *position.Position {
+		// One NQ contract from 100 with $7.80 of round-trip costs.
+		return &position.Position{
+			Symbol:     "NQZ4",
+			Quantity:   1,
+			Action:     action,
+			EnterPrice: 100,
+			ExitPrice:  exit,
+			StopLoss:   stop,
+			Commission: 5,
+			Fees:       2.8,
+			Status:     position.PositionClosed,
+			EnterTime:  exitTime.Add(-time.Minute),
+			ExitTime:   exitTime,
+		}
+	}
+	winner := trade(strategy.BuyAction, 110, 95, day.Add(2*time.Hour))
+	winner.MAE, winner.MFE = 2, 12
+	positions := []*position.Position{
+		// Listed out of exit order; the trade log is sorted by exit.
+		trade(strategy.BuyAction, 104, 98, day.Add(50*time.Hour)), // +$80 gross, 2R
+		winner, // +$200 gross, 2R
+		trade(strategy.SellAction, 105, 105, day.Add(26*time.Hour)), // -$100 gross, -1R
+		{Symbol: "NQZ4", Quantity: 1, Action: strategy.BuyAction, EnterPrice: 100, Status: position.PositionOpen},
+	}
+
+	// Daily returns of +1%, -1% and +1% with the peak on the first day.
+	curve := []portfolio.EquityPoint{
+		{Timestamp: day, Equity: 100000, Peak: 100000},
+		{Timestamp: day.Add(6*time.Hour + 30*time.Minute), Equity: 101000, Peak: 101000},
+		{Timestamp: day.Add(30*time.Hour + 30*time.Minute), Equity: 99990, Peak: 101000, Drawdown: 1010, DrawdownPct: 0.01},
+		{Timestamp: day.Add(54*time.Hour + 30*time.Minute), Equity: 100989.9, Peak: 101000, Drawdown: 10.1, DrawdownPct: 0.0001},
+	}
+
+	report := Compute("test", 100000, positions, curve)
+
+	if report.Trades != 3 || report.Wins != 2 || report.Losses != 1 {
+		t.Errorf("trades, wins, losses = %d, %d, %d, want 3, 2, 1", report.Trades, report.Wins, report.Losses)
+	}
+	if report.MaxDrawdownDuration != Duration(48*time.Hour) {
+		t.Errorf("max drawdown duration = %v, want 48h", report.MaxDrawdownDuration)
+	}
+	for i, want := range []time.Time{winner.ExitTime, day.Add(26 * time.Hour), day.Add(50 * time.Hour)} {
+		if got := report.TradeLog[i].ExitTime; !got.Equal(want) {
+			t.Errorf("trade log[%d] exit = %v, want %v", i, got, want)
+		}
+	}
+
+	for _, field := range []struct {
+		name      string
+		got, want float64
+	}{
+		// Net P&L is $192.20 - $107.80 + $72.20.
+		{"net pnl", report.NetPnL, 156.6},
+		{"winning pnl", report.WinningPnL, 264.4},
+		{"losing pnl", report.LosingPnL, 107.8},
+		{"costs", report.Costs, 23.4},
+		{"win rate", report.WinRate, 2.0 / 3},
+		{"average win", report.AverageWin, 132.2},
+		{"average loss", report.AverageLoss, 107.8},
+		{"average r", report.AverageR, 1},
+		{"expectancy", report.Expectancy, 52.2},
+		{"profit factor", report.ProfitFactor, 264.4 / 107.8},
+		{"trades per day", report.TradesPerDay, 1},
+		{"ending equity", report.EndingEquity, 100989.9},
+		{"max drawdown", report.MaxDrawdown, 1010},
+		{"max drawdown pct", report.MaxDrawdownPct, 0.01},
+		// Returns of r, -r, r have a mean of r/3, a sample deviation of
+		// 2r/sqrt(3) and a downside deviation of r/sqrt(3).
+		{"sharpe", report.Sharpe, math.Sqrt(21)},
+		{"sortino", report.Sortino, math.Sqrt(84)},
+		// 0.99% compounded over 54.5 hours.
+		{"annual return", report.AnnualReturn, 3.870914654},
+		{"calmar", report.Calmar, 387.0914654},
+		{"winner mae", report.TradeLog[0].MAE, 40},
+		{"winner mfe", report.TradeLog[0].MFE, 240},
+		{"winner r", report.TradeLog[0].R, 2},
+	} {
+		if math.Abs(field.got-field.want) > 1e-6*math.Max(1, math.Abs(field.want)) {
+			t.Errorf("%s = %v, want %v", field.name, field.got, field.want)
+		}
+	}
+}
+
+func TestComputeWithoutTrades(t *testing.T) {
+	report := Compute("empty", 50000, nil, nil)
+	if report.Trades != 0 || report.EndingEquity != 50000 || report.ProfitFactor != 0 || report.WinRate != 0 {
+		t.Errorf("empty report = %+v", report)
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed report.html.tmpl
+var reportTemplate string
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"money":   func(v float64) string { return fmt.Sprintf("$%.2f", v) },
+	"percent": func(v float64) string { return fmt.Sprintf("%.2f%%", 100*v) },
+	"number":  func(v float64) string { return fmt.Sprintf("%.2f", v) },
+}).Parse(reportTemplate))
+
+// WriteJSON writes the report as indented JSON to path.
+func (r Report) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal report: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// WriteHTML writes the report as a single HTML page with no external
+// assets to path.
+func (r Report) WriteHTML(path string) error {
+	var buf bytes.Buffer
+	if err := reportHTML.Execute(&buf, htmlReport{Report: r, EquitySVG: equitySVG(r)}); err != nil {
+		return fmt.Errorf("render report: %w", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// Write saves report.json and report.html under dir, creating it if needed.
+func (r Report) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create report dir: %w", err)
+	}
+	if err := r.WriteJSON(filepath.Join(dir, "report.json")); err != nil {
+		return err
+	}
+	return r.WriteHTML(filepath.Join(dir, "report.html"))
+}
+
+type htmlReport struct {
+	Report
+	EquitySVG template.HTML
+}
+
+// equitySVG draws the equity curve as an inline SVG polyline.
+func equitySVG(r Report) template.HTML {
+	const width, height = 960.0, 240.0
+	curve := r.EquityCurve
+	if len(curve) < 2 {
+		return ""
+	}
+
+	low, high := curve[0].Equity, curve[0].Equity
+	for _, point := range curve {
+		low = min(low, point.Equity)
+		high = max(high, point.Equity)
+	}
+	if high == low {
+		high = low + 1
+	}
+
+	var points strings.Builder
+	for i, point := range curve {
+		x := width * float64(i) / float64(len(curve)-1)
+		y := height - height*(point.Equity-low)/(high-low)
+		fmt.Fprintf(&points, "%.1f,%.1f ", x, y)
+	}
+	return template.HTML(fmt.Sprintf(
+		`<svg viewBox="0 0 %.0f %.0f" width="100%%" height="%.0f" preserveAspectRatio="none"><polyline fill="none" stroke="#2563eb" stroke-width="1.5" points="%s"/></svg>`,
+		width, height, height, strings.TrimSpace(points.String()),
+	))
+}
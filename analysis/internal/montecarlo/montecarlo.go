@@ -0,0 +1,208 @@
+// Package montecarlo resamples the closed trades of a backtest into many
+// alternative trade sequences to show how much of a result was luck of the
+// order.
+package montecarlo
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/mgordon34/gostonks/analysis/internal/instrument"
+	"github.com/mgordon34/gostonks/analysis/internal/metrics"
+)
+
+// Method is how each simulated sequence is drawn from the trades.
+type Method string
+
+const (
+	// Bootstrap draws as many trades as the run had, with replacement.
+	Bootstrap Method = "bootstrap"
+	// Shuffle replays every trade once in a random order.
+	Shuffle Method = "shuffle"
+)
+
+func ParseMethod(value string) (Method, error) {
+	switch method := Method(value); method {
+	case Bootstrap, Shuffle:
+		return method, nil
+	}
+	return "", fmt.Errorf("unknown method %q, one of %s, %s", value, Bootstrap, Shuffle)
+}
+
+type Config struct {
+	Method         Method
+	Simulations    int
+	Seed           uint64
+	StartingEquity float64
+	// SkipProbability drops each trade with this chance, as if the signal
+	// had been missed.
+	SkipProbability float64
+	// SlippageTicks adds up to this many ticks of extra slippage, drawn
+	// uniformly, to each side of every trade.
+	SlippageTicks float64
+	// TrailingDrawdown is a prop-firm style limit: a simulation fails once
+	// equity falls this many dollars below its high-water mark. Zero turns
+	// it off.
+	TrailingDrawdown float64
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	if c.Method != Bootstrap && c.Method != Shuffle {
+		errs = append(errs, fmt.Errorf("unknown method %q", c.Method))
+	}
+	if c.Simulations <= 0 {
+		errs = append(errs, fmt.Errorf("simulations must be positive, got %d", c.Simulations))
+	}
+	if c.StartingEquity <= 0 {
+		errs = append(errs, fmt.Errorf("starting equity must be positive, got %g", c.StartingEquity))
+	}
+	if c.SkipProbability < 0 || c.SkipProbability >= 1 {
+		errs = append(errs, fmt.Errorf("skip probability must be in [0, 1), got %g", c.SkipProbability))
+	}
+	if c.SlippageTicks < 0 {
+		errs = append(errs, fmt.Errorf("slippage ticks must not be negative, got %g", c.SlippageTicks))
+	}
+	if c.TrailingDrawdown < 0 {
+		errs = append(errs, fmt.Errorf("trailing drawdown must not be negative, got %g", c.TrailingDrawdown))
+	}
+	return errors.Join(errs...)
+}
+
+// Distribution summarises one figure across every simulation.
+type Distribution struct {
+	Mean float64 `json:"mean"`
+	P5   float64 `json:"p5"`
+	P25  float64 `json:"p25"`
+	P50  float64 `json:"p50"`
+	P75  float64 `json:"p75"`
+	P95  float64 `json:"p95"`
+}
+
+type Result struct {
+	Method         Method       `json:"method"`
+	Simulations    int          `json:"simulations"`
+	Trades         int          `json:"trades"`
+	FinalEquity    Distribution `json:"final_equity"`
+	MaxDrawdown    Distribution `json:"max_drawdown"`
+	MaxDrawdownPct Distribution `json:"max_drawdown_pct"`
+	// ProbabilityOfLoss is the share of simulations that ended below the
+	// starting equity.
+	ProbabilityOfLoss float64 `json:"probability_of_loss"`
+	// ProbabilityOfBreach is the share of simulations that hit the trailing
+	// drawdown limit.
+	ProbabilityOfBreach float64 `json:"probability_of_breach"`
+}
+
+// Run simulates config.Simulations trade sequences drawn from trades. Equity
+// moves once per trade by its net P&L less any slippage noise.
+func Run(trades []metrics.Trade, config Config) (Result, error) {
+	if err := config.Validate(); err != nil {
+		return Result{}, err
+	}
+	if len(trades) == 0 {
+		return Result{}, errors.New("no closed trades to resample")
+	}
+
+	// Slippage noise is per contract, so price it from each trade's
+	// instrument up front.
+	slippagePerTick := make([]float64, len(trades))
+	for i, trade := range trades {
+		if inst, ok := instrument.Lookup(trade.Contract); ok {
+			slippagePerTick[i] = inst.TickValue() * float64(max(trade.Quantity, 1))
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(config.Seed, config.Seed))
+	finals := make([]float64, config.Simulations)
+	drawdowns := make([]float64, config.Simulations)
+	drawdownPcts := make([]float64, config.Simulations)
+	order := make([]int, len(trades))
+	var losses, breaches int
+	for sim := range config.Simulations {
+		for i := range order {
+			if config.Method == Bootstrap {
+				order[i] = rng.IntN(len(trades))
+			} else {
+				order[i] = i
+			}
+		}
+		if config.Method == Shuffle {
+			rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		}
+
+		equity, peak := config.StartingEquity, config.StartingEquity
+		var maxDrawdown, maxDrawdownPct float64
+		breached := false
+		for _, index := range order {
+			if config.SkipProbability > 0 && rng.Float64() < config.SkipProbability {
+				continue
+			}
+			pnl := trades[index].NetPnL
+			if config.SlippageTicks > 0 {
+				pnl -= 2 * config.SlippageTicks * rng.Float64() * slippagePerTick[index]
+			}
+
+			equity += pnl
+			peak = max(peak, equity)
+			drawdown := peak - equity
+			maxDrawdown = max(maxDrawdown, drawdown)
+			maxDrawdownPct = max(maxDrawdownPct, drawdown/peak)
+			if config.TrailingDrawdown > 0 && drawdown >= config.TrailingDrawdown {
+				breached = true
+			}
+		}
+
+		finals[sim] = equity
+		drawdowns[sim] = maxDrawdown
+		drawdownPcts[sim] = maxDrawdownPct
+		if equity < config.StartingEquity {
+			losses++
+		}
+		if breached {
+			breaches++
+		}
+	}
+
+	return Result{
+		Method:              config.Method,
+		Simulations:         config.Simulations,
+		Trades:              len(trades),
+		FinalEquity:         distribution(finals),
+		MaxDrawdown:         distribution(drawdowns),
+		MaxDrawdownPct:      distribution(drawdownPcts),
+		ProbabilityOfLoss:   float64(losses) / float64(config.Simulations),
+		ProbabilityOfBreach: float64(breaches) / float64(config.Simulations),
+	}, nil
+}
+
+func distribution(values []float64) Distribution {
+	sort.Float64s(values)
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return Distribution{
+		Mean: sum / float64(len(values)),
+		P5:   percentile(values, 0.05),
+		P25:  percentile(values, 0.25),
+		P50:  percentile(values, 0.50),
+		P75:  percentile(values, 0.75),
+		P95:  percentile(values, 0.95),
+	}
+}
+
+// percentile interpolates between the closest ranks of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p * float64(len(sorted)-1)
+	lo := int(rank)
+	if lo+1 >= len(sorted) {
+		return sorted[lo]
+	}
+	return sorted[lo] + (sorted[lo+1]-sorted[lo])*(rank-float64(lo))
+}
@@ -0,0 +1,134 @@
+package portfolio
+
+import (
+	"math"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/instrument"
+)
+
+// EquityPoint is the portfolio's marked-to-market state after a candle.
+type EquityPoint struct {
+	Timestamp   time.Time
+	Cash        float64
+	Realized    float64
+	Unrealized  float64
+	Equity      float64
+	MarginUsed  float64
+	Peak        float64
+	Drawdown    float64
+	DrawdownPct float64
+}
+
+// account tracks cash and P&L for a portfolio. Cash starts at the portfolio
+// balance and moves by realized P&L and trading costs as they are charged;
+// open positions contribute unrealized P&L marked at the latest close of
+// their symbol.
+type account struct {
+	cash     float64
+	realized float64
+	peak     float64
+	marks    map[string]float64
+	charged  map[*position.Position]float64
+	open     []*position.Position
+}
+
+func newAccount(balance float64) *account {
+	return &account{
+		cash:    balance,
+		peak:    balance,
+		marks:   make(map[string]float64),
+		charged: make(map[*position.Position]float64),
+	}
+}
+
+func (a *account) mark(symbol string, price float64) {
+	a.marks[symbol] = price
+}
+
+// apply books the costs and P&L of a position whose status just changed.
+func (a *account) apply(pos *position.Position) {
+	costs := pos.Commission + pos.Fees
+	a.cash -= costs - a.charged[pos]
+	a.charged[pos] = costs
+
+	switch pos.Status {
+	case position.PositionOpen:
+		a.open = append(a.open, pos)
+	case position.PositionClosed, position.PositionCancelled:
+		if pos.Status == position.PositionClosed {
+			pnl := grossPnL(pos, pos.ExitPrice)
+			a.cash += pnl
+			a.realized += pnl - costs
+		}
+		delete(a.charged, pos)
+		for i, open := range a.open {
+			if open == pos {
+				a.open = append(a.open[:i], a.open[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (a *account) unrealized() float64 {
+	var total float64
+	for _, pos := range a.open {
+		if price, ok := a.marks[pos.Symbol]; ok {
+			total += grossPnL(pos, price)
+		}
+	}
+	return total
+}
+
+func (a *account) equity() float64 {
+	return a.cash + a.unrealized()
+}
+
+// marginUsed is the initial or maintenance margin held by open positions.
+func (a *account) marginUsed(maintenance bool) float64 {
+	var total float64
+	for _, pos := range a.open {
+		inst, _ := instrument.Lookup(pos.TradedSymbol())
+		if maintenance {
+			total += inst.MaintenanceMargin * float64(pos.Quantity)
+		} else {
+			total += inst.InitialMargin * float64(pos.Quantity)
+		}
+	}
+	return total
+}
+
+// belowMaintenance reports whether equity no longer covers the maintenance
+// margin of the open positions.
+func (a *account) belowMaintenance() bool {
+	return len(a.open) > 0 && a.equity() < a.marginUsed(true)
+}
+
+func (a *account) snapshot(ts time.Time) EquityPoint {
+	unrealized := a.unrealized()
+	equity := a.cash + unrealized
+	a.peak = math.Max(a.peak, equity)
+
+	point := EquityPoint{
+		Timestamp:  ts,
+		Cash:       a.cash,
+		Realized:   a.realized,
+		Unrealized: unrealized,
+		Equity:     equity,
+		MarginUsed: a.marginUsed(false),
+		Peak:       a.peak,
+		Drawdown:   a.peak - equity,
+	}
+	if a.peak > 0 {
+		point.DrawdownPct = point.Drawdown / a.peak
+	}
+	return point
+}
+
+// grossPnL is the dollar P&L of pos at price before costs.
+func grossPnL(pos *position.Position, price float64) float64 {
+	inst, _ := instrument.Lookup(pos.TradedSymbol())
+	return pos.Points(price) * inst.PointValue * float64(pos.Quantity)
+}
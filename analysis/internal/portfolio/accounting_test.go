@@ -0,0 +1,120 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+)
+
+func TestAccount(t *testing.T) {
+	long := &position.Position{Symbol: "NQZ4", Quantity: 2, Action: strategy.BuyAction, EnterPrice: 100}
+	// Three micros traded off the NQ feed, marked at NQ prices.
+	micro := &position.Position{Symbol: "NQZ4", Contract: "MNQ", Quantity: 3, Action: strategy.SellAction, EnterPrice: 110}
+
+	a := newAccount(100000)
+	steps := []struct {
+		name string
+		do   func()
+		want EquityPoint
+	}{
+		{
+			// $2.50 commission and $1.40 fees a contract.
+			name: "entry costs come out of cash",
+			do: func() {
+				long.Status, long.Commission, long.Fees = position.PositionOpen, 5, 2.8
+				a.apply(long)
+			},
+			want: EquityPoint{Cash: 99992.2, Equity: 99992.2, MarginUsed: 52800, Peak: 100000, Drawdown: 7.8},
+		},
+		{
+			name: "a higher mark is unrealized profit",
+			do:   func() { a.mark("NQZ4", 105) },
+			// 5 points * $20 * 2 contracts.
+			want: EquityPoint{Cash: 99992.2, Unrealized: 200, Equity: 100192.2, MarginUsed: 52800, Peak: 100192.2},
+		},
+		{
+			name: "a lower mark draws down from the peak",
+			do:   func() { a.mark("NQZ4", 95) },
+			want: EquityPoint{Cash: 99992.2, Unrealized: -200, Equity: 99792.2, MarginUsed: 52800, Peak: 100192.2, Drawdown: 400},
+		},
+		{
+			name: "closing realizes the P&L less both sides of costs",
+			do: func() {
+				long.Status, long.ExitPrice, long.Commission, long.Fees = position.PositionClosed, 110, 10, 5.6
+				a.apply(long)
+			},
+			// 10 points * $20 * 2 = $400, less $15.60 of costs.
+			want: EquityPoint{Cash: 100384.4, Realized: 384.4, Equity: 100384.4, Peak: 100384.4},
+		},
+		{
+			name: "micros use their own point value and margin",
+			do: func() {
+				micro.Status, micro.Fees = position.PositionOpen, 1.11
+				a.apply(micro)
+				a.mark("NQZ4", 108)
+			},
+			// Short 2 points * $2 * 3 contracts.
+			want: EquityPoint{Cash: 100383.29, Realized: 384.4, Unrealized: 12, Equity: 100395.29, MarginUsed: 7920, Peak: 100395.29},
+		},
+		{
+			name: "cancelling refunds nothing and releases margin",
+			do: func() {
+				micro.Status = position.PositionCancelled
+				a.apply(micro)
+			},
+			want: EquityPoint{Cash: 100383.29, Realized: 384.4, Equity: 100383.29, Peak: 100395.29, Drawdown: 12},
+		},
+	}
+
+	ts := time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+	for _, step := range steps {
+		step.do()
+		got := a.snapshot(ts)
+		want := step.want
+		want.Timestamp = ts
+		want.DrawdownPct = want.Drawdown / want.Peak
+
+		for _, field := range []struct {
+			name      string
+			got, want float64
+		}{
+			{"cash", got.Cash, want.Cash},
+			{"realized", got.Realized, want.Realized},
+			{"unrealized", got.Unrealized, want.Unrealized},
+			{"equity", got.Equity, want.Equity},
+			{"margin used", got.MarginUsed, want.MarginUsed},
+			{"peak", got.Peak, want.Peak},
+			{"drawdown", got.Drawdown, want.Drawdown},
+			{"drawdown pct", got.DrawdownPct, want.DrawdownPct},
+		} {
+			if math.Abs(field.got-field.want) > 1e-6 {
+				t.Errorf("%s: %s = %v, want %v", step.name, field.name, field.got, field.want)
+			}
+		}
+	}
+}
+
+func TestBelowMaintenance(t *testing.T) {
+	a := newAccount(25000)
+	pos := &position.Position{Symbol: "NQZ4", Quantity: 1, Action: strategy.BuyAction, EnterPrice: 100, Status: position.PositionOpen}
+	a.apply(pos)
+
+	// NQ maintenance is $24,000, so $1,000 of losses, 50 points, is the most
+	// the account can take.
+	for _, tt := range []struct {
+		mark float64
+		want bool
+	}{
+		{100, false},
+		{50, false},
+		{49.75, true},
+	} {
+		a.mark("NQZ4", tt.mark)
+		if got := a.belowMaintenance(); got != tt.want {
+			t.Errorf("marked at %v: below maintenance = %v, want %v", tt.mark, got, tt.want)
+		}
+	}
+}
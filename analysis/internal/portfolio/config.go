@@ -0,0 +1,156 @@
+package portfolio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// Config describes the portfolios a service runs and the strategies each
+// one trades.
+type Config struct {
+	Portfolios []PortfolioConfig `json:"portfolios"`
+}
+
+type PortfolioConfig struct {
+	Name       string                `json:"name"`
+	Balance    float64               `json:"balance"`
+	Strategies []strategy.Definition `json:"strategies"`
+}
+
+// LoadConfig reads and validates the JSON config at path. Unknown fields are
+// rejected so a misspelt setting does not silently fall back to a default.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s:\n%w", path, err)
+	}
+	return config, nil
+}
+
+// Validate reports every problem in the config, each prefixed with the path
+// to the offending field such as portfolios[0].strategies[1].symbols.
+func (c Config) Validate() error {
+	if len(c.Portfolios) == 0 {
+		return errors.New("portfolios: at least one portfolio is required")
+	}
+
+	var errs []error
+	names := make(map[string]int)
+	for i, p := range c.Portfolios {
+		path := fmt.Sprintf("portfolios[%d]", i)
+		if first, ok := names[p.Name]; ok && p.Name != "" {
+			errs = append(errs, fmt.Errorf("%s.name: %q is already used by portfolios[%d]", path, p.Name, first))
+		} else {
+			names[p.Name] = i
+		}
+		errs = append(errs, strategy.PrefixErrors(path, p.Validate())...)
+	}
+	return errors.Join(errs...)
+}
+
+// Portfolio returns the portfolio called name, which may be empty when the
+// config has only one.
+func (c Config) Portfolio(name string) (PortfolioConfig, error) {
+	if name == "" {
+		if len(c.Portfolios) != 1 {
+			return PortfolioConfig{}, fmt.Errorf("config has %d portfolios, name the one to use", len(c.Portfolios))
+		}
+		return c.Portfolios[0], nil
+	}
+	for _, p := range c.Portfolios {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return PortfolioConfig{}, fmt.Errorf("config has no portfolio named %s", name)
+}
+
+func (c PortfolioConfig) Validate() error {
+	var errs []error
+	if c.Name == "" {
+		errs = append(errs, errors.New("name: required"))
+	}
+	if c.Balance <= 0 {
+		errs = append(errs, fmt.Errorf("balance: must be positive, got %g", c.Balance))
+	}
+	if len(c.Strategies) == 0 {
+		errs = append(errs, errors.New("strategies: at least one strategy is required"))
+	}
+
+	names := make(map[string]int)
+	for i, def := range c.Strategies {
+		path := fmt.Sprintf("strategies[%d]", i)
+		if first, ok := names[def.Name]; ok && def.Name != "" {
+			errs = append(errs, fmt.Errorf("%s.name: %q is already used by strategies[%d]", path, def.Name, first))
+		} else {
+			names[def.Name] = i
+		}
+		errs = append(errs, strategy.PrefixErrors(path, def.Validate())...)
+	}
+	return errors.Join(errs...)
+}
+
+// NewStrategies builds the portfolio's strategies from the registry,
+// reporting every definition whose params are invalid.
+func (c PortfolioConfig) NewStrategies(ctx context.Context, repo candle.Repository) ([]strategy.Strategy, error) {
+	var strategies []strategy.Strategy
+	var errs []error
+	for i, def := range c.Strategies {
+		s, err := strategy.New(ctx, repo, def)
+		if err != nil {
+			errs = append(errs, strategy.PrefixErrors(fmt.Sprintf("strategies[%d]", i), err)...)
+			continue
+		}
+		strategies = append(strategies, s)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return strategies, nil
+}
+
+// WithSymbols returns a copy of the portfolio with every strategy trading
+// symbols, such as a specific contract month in local data.
+func (c PortfolioConfig) WithSymbols(symbols []string) PortfolioConfig {
+	c.Strategies = append(c.Strategies[:0:0], c.Strategies...)
+	for i := range c.Strategies {
+		c.Strategies[i].Symbols = symbols
+	}
+	return c
+}
+
+// Markets returns the markets and symbols the portfolio's strategies trade,
+// each listed once in config order.
+func (c PortfolioConfig) Markets() (markets []string, symbols []string) {
+	seen := make(map[string]bool)
+	for _, def := range c.Strategies {
+		if !seen["market:"+def.Market] {
+			seen["market:"+def.Market] = true
+			markets = append(markets, def.Market)
+		}
+		for _, symbol := range def.Symbols {
+			if !seen["symbol:"+symbol] {
+				seen["symbol:"+symbol] = true
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	return markets, symbols
+}
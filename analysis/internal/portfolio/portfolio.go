@@ -1,27 +1,260 @@
 package portfolio
 
 import (
+	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/execution"
+	"github.com/mgordon34/gostonks/analysis/internal/instrument"
 	"github.com/mgordon34/gostonks/analysis/internal/strategy"
 	"github.com/mgordon34/gostonks/market/cmd/candle"
 )
 
+// Recorder receives a portfolio's activity as it happens, for example to
+// persist a backtest run. Signals are recorded with the reason they were
+// rejected, or a nil error when they became an order.
+type Recorder interface {
+	RecordSignal(signal strategy.Signal, rejection error)
+	RecordOrder(pos *position.Position)
+	RecordPosition(pos *position.Position)
+	RecordEquity(point EquityPoint)
+}
+
 type Portfolio struct {
 	Name 		string
 	Strategies 	[]strategy.Strategy
 	Balance 	float64
-	Positions	[]position.Position
+	Positions	[]*position.Position
+	Execution	*execution.Engine
+
+	// Sizer picks the quantity for each signal, one contract when nil.
+	// AllowMicro lets sizes that are not whole contracts trade as micros.
+	Sizer		Sizer
+	AllowMicro	bool
+	Risk		RiskLimits
+
+	// EquityCurve gets a point after every candle; OnEquity, if set, is
+	// called with each point as it is recorded.
+	EquityCurve	[]EquityPoint
+	OnEquity	func(EquityPoint)
+	Recorder	Recorder
+
+	mu		sync.Mutex
+	account 	*account
+	guard		*guard
+	atr		map[string]*atr
+	now		time.Time
 }
 
 func (p *Portfolio) ProcessCandle(c candle.Candle) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.init()
+	p.now = c.Timestamp
+	if p.atr[c.Symbol] == nil {
+		p.atr[c.Symbol] = &atr{period: 14}
+	}
+	p.atr[c.Symbol].update(c)
+
+	// Orders from earlier candles trade against this one before strategies
+	// see it, so a signal never fills on the bar that produced it.
+	for _, pos := range p.Execution.ProcessCandle(c) {
+		p.book(pos)
+	}
+	p.account.mark(c.Symbol, c.Close)
+
+	if p.account.belowMaintenance() {
+		p.flatten("below maintenance margin")
+	}
+	if reason := p.guard.update(c.Timestamp, p.account.equity()); reason != "" {
+		p.flatten(reason)
+	}
+
 	for _, strategy := range p.Strategies {
 		strategy.ProcessCandle(c)
 		signal := strategy.GenerateSignal(c)
 
 		if signal != nil {
 			log.Printf("Signal found: %+v", *signal)
+			contract, quantity, err := p.accept(*signal)
+			if p.Recorder != nil {
+				p.Recorder.RecordSignal(*signal, err)
+			}
+			if err != nil {
+				log.Printf("Signal rejected: %v", err)
+				continue
+			}
+
+			pos := p.Execution.Submit(*signal, contract, quantity)
+			p.guard.trades++
+			p.Positions = append(p.Positions, pos)
+			if p.Recorder != nil {
+				p.Recorder.RecordOrder(pos)
+			}
+			if pos.Status == position.PositionOpen {
+				p.book(pos)
+			}
 		}
 	}
+
+	p.record(c.Timestamp)
+}
+
+// Kill flattens the portfolio and stops it taking any further signals.
+func (p *Portfolio) Kill(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.init()
+	p.guard.halt("kill switch: " + reason)
+	p.flatten("kill switch: " + reason)
+}
+
+// Flatten closes every position at the latest prices and records the
+// equity that leaves, for a run that ends with positions still open.
+func (p *Portfolio) Flatten(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.account == nil || len(p.Execution.Active()) == 0 {
+		return
+	}
+	p.flatten(reason)
+	p.record(p.now)
+}
+
+// Equity returns the latest marked-to-market equity. It is safe to call
+// while candles are being processed.
+func (p *Portfolio) Equity() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.account == nil {
+		return p.Balance
+	}
+	return p.account.equity()
+}
+
+func (p *Portfolio) init() {
+	if p.account != nil {
+		return
+	}
+	p.account = newAccount(p.Balance)
+	p.guard = newGuard(p.Risk, p.Balance)
+	p.atr = make(map[string]*atr)
+}
+
+// flatten closes every position at the latest prices and books the results.
+func (p *Portfolio) flatten(reason string) {
+	log.Printf("Portfolio %s flattening at %s: %s", p.Name, p.now.Format("2006-01-02 15:04:05"), reason)
+	for _, pos := range p.Execution.Flatten(p.now) {
+		p.book(pos)
+	}
+}
+
+// book updates the account for a position whose status changed.
+func (p *Portfolio) book(pos *position.Position) {
+	p.account.apply(pos)
+	p.guard.closed(pos)
+	if p.Recorder != nil {
+		p.Recorder.RecordPosition(pos)
+	}
+	if pos.Status == position.PositionClosed {
+		logTrade(pos)
+		return
+	}
+	log.Printf("Position %s %s: %+v", pos.Symbol, pos.Status, *pos)
+}
+
+// accept checks signal against the risk limits, sizing and margin, and
+// returns the contract and quantity to trade or why it cannot be traded.
+// Signals for symbols without an instrument specification are rejected, as
+// their P&L and margin cannot be worked out.
+func (p *Portfolio) accept(signal strategy.Signal) (string, int, error) {
+	if _, ok := instrument.Lookup(signal.Symbol); !ok {
+		return "", 0, fmt.Errorf("unknown instrument %s", signal.Symbol)
+	}
+	if err := p.guard.allow(signal, p.Execution.Active()); err != nil {
+		return "", 0, err
+	}
+
+	contract, quantity := p.size(signal)
+	if quantity == 0 {
+		return "", 0, fmt.Errorf("sized to zero contracts for %s", signal.Symbol)
+	}
+	if !p.hasMargin(contract, signal.Symbol, quantity) {
+		return "", 0, fmt.Errorf("insufficient margin for %d %s", quantity, signal.Symbol)
+	}
+	return contract, quantity, nil
+}
+
+// size returns the contract and quantity to trade for signal. An empty
+// contract means the signal's own symbol.
+func (p *Portfolio) size(signal strategy.Signal) (string, int) {
+	inst, _ := instrument.Lookup(signal.Symbol)
+	if p.Sizer == nil {
+		return "", 1
+	}
+
+	ctx := SizingContext{
+		Signal:		signal,
+		Instrument:	inst,
+		Equity:		p.account.equity(),
+		ATR:		p.atr[signal.Symbol].current(),
+	}
+	ctx.Trades, ctx.WinRate, ctx.Payoff = tradeStats(p.Positions)
+	return roundContracts(p.Sizer.Size(ctx), inst, p.AllowMicro)
+}
+
+// hasMargin reports whether equity covers the initial margin of every
+// pending and open position plus quantity more contracts of contract, or
+// of symbol when contract is empty.
+func (p *Portfolio) hasMargin(contract, symbol string, quantity int) bool {
+	if contract == "" {
+		contract = symbol
+	}
+	inst, _ := instrument.Lookup(contract)
+	required := inst.InitialMargin * float64(quantity)
+	for _, pos := range p.Execution.Active() {
+		held, _ := instrument.Lookup(pos.TradedSymbol())
+		required += held.InitialMargin * float64(pos.Quantity)
+	}
+	return p.account.equity() >= required
+}
+
+func (p *Portfolio) record(ts time.Time) {
+	point := p.account.snapshot(ts)
+	p.EquityCurve = append(p.EquityCurve, point)
+	if p.OnEquity != nil {
+		p.OnEquity(point)
+	}
+	if p.Recorder != nil {
+		p.Recorder.RecordEquity(point)
+	}
+}
+
+func logTrade(pos *position.Position) {
+	log.Printf(
+		"Trade closed %d %s %s by %s: entry %.2f (slippage %.2f) exit %.2f (slippage %.2f), commission $%.2f, fees $%.2f, net $%.2f",
+		pos.Quantity,
+		pos.TradedSymbol(),
+		pos.Action,
+		pos.ExitReason,
+		pos.EnterPrice,
+		pos.EntrySlippage,
+		pos.ExitPrice,
+		pos.ExitSlippage,
+		pos.Commission,
+		pos.Fees,
+		NetPnL(pos),
+	)
+}
+
+// NetPnL is the realized dollar P&L of a closed position after costs.
+func NetPnL(pos *position.Position) float64 {
+	return grossPnL(pos, pos.ExitPrice) - pos.Commission - pos.Fees
 }
@@ -0,0 +1,132 @@
+package portfolio
+
+import (
+	"context"
+	"io"
+	"log"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/execution"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// scripted signals on the candles stamped with its signals' timestamps.
+type scripted struct {
+	signals []strategy.Signal
+}
+
+func (s *scripted) ProcessCandle(c candle.Candle) {}
+
+func (s *scripted) GenerateSignal(c candle.Candle) *strategy.Signal {
+	for _, signal := range s.signals {
+		if signal.Symbol == c.Symbol && signal.Timestamp.Equal(c.Timestamp) {
+			return &signal
+		}
+	}
+	return nil
+}
+
+func bar(symbol string, ts time.Time, open, high, low, close float64) candle.Candle {
+	return candle.Candle{
+		Market:    "futures",
+		Symbol:    symbol,
+		Timeframe: candle.MustParseTimeframe("1m"),
+		Open:      open,
+		High:      high,
+		Low:       low,
+		Close:     close,
+		Timestamp: ts,
+	}
+}
+
+// newPortfolio trades signals with $2.50 commission a contract a side and
+// no slippage.
+func newPortfolio(t *testing.T, signals ...strategy.Signal) *Portfolio {
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(output) })
+
+	return &Portfolio{
+		Name:       "test",
+		Strategies: []strategy.Strategy{&scripted{signals: signals}},
+		Balance:    100000,
+		Execution:  execution.NewEngine(context.Background(), execution.Config{Costs: execution.Costs{Commission: 2.5}}),
+	}
+}
+
+func TestFlattenBooksOpenPositions(t *testing.T) {
+	t0 := time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+	p := newPortfolio(t, strategy.Signal{Symbol: "NQZ4", Action: strategy.BuyAction, Type: strategy.MarketOrder, Price: 100, StopLoss: 90, TakeProfit: 200, Timestamp: t0})
+
+	// Flattening before any candle has nothing to do.
+	p.Flatten("end of test")
+	if len(p.EquityCurve) != 0 {
+		t.Fatalf("%d equity points after flattening nothing, want 0", len(p.EquityCurve))
+	}
+
+	p.ProcessCandle(bar("NQZ4", t0, 100, 101, 99, 100))
+	p.ProcessCandle(bar("NQZ4", t0.Add(time.Minute), 100, 106, 99, 105))
+	p.Flatten("end of test")
+
+	pos := p.Positions[0]
+	if pos.Status != position.PositionClosed || pos.ExitReason != position.ExitFlattened || pos.ExitPrice != 105 {
+		t.Errorf("position = %s (%s) at %v, want closed (flattened) at 105", pos.Status, pos.ExitReason, pos.ExitPrice)
+	}
+
+	// 5 points on one NQ contract is $100, less $5 commission and $2.80 of
+	// fees.
+	last := p.EquityCurve[len(p.EquityCurve)-1]
+	if len(p.EquityCurve) != 3 || math.Abs(last.Realized-92.2) > 1e-9 || last.Unrealized != 0 || math.Abs(last.Equity-100092.2) > 1e-9 {
+		t.Errorf("last of %d equity points = %+v, want 92.2 realized and nothing unrealized", len(p.EquityCurve), last)
+	}
+	if math.Abs(p.Equity()-100092.2) > 1e-9 {
+		t.Errorf("equity = %v, want 100092.2", p.Equity())
+	}
+}
+
+func TestEquityWhileProcessing(t *testing.T) {
+	t0 := time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+	p := newPortfolio(t, strategy.Signal{Symbol: "NQZ4", Action: strategy.BuyAction, Type: strategy.MarketOrder, Price: 100, StopLoss: 50, TakeProfit: 500, Timestamp: t0})
+
+	// Run with -race: equity is read, as a dashboard would, while candles
+	// mark the open position.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 200 {
+			price := 100 + float64(i%10)
+			p.ProcessCandle(bar("NQZ4", t0.Add(time.Duration(i)*time.Minute), price, price+1, price-1, price))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if p.Equity() == p.Balance {
+				t.Error("equity never moved from the starting balance")
+			}
+			return
+		default:
+			p.Equity()
+		}
+	}
+}
+
+func TestUnknownInstrumentsAreRejected(t *testing.T) {
+	t0 := time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+	p := newPortfolio(t, strategy.Signal{Symbol: "XYZZ4", Action: strategy.BuyAction, Type: strategy.MarketOrder, Price: 100, StopLoss: 90, TakeProfit: 110, Timestamp: t0})
+
+	p.ProcessCandle(bar("XYZZ4", t0, 100, 101, 99, 100))
+	if len(p.Positions) != 0 || len(p.Execution.Active()) != 0 {
+		t.Fatalf("signal for an unknown instrument was traded: %+v", p.Positions)
+	}
+	if _, _, err := p.accept(strategy.Signal{Symbol: "XYZZ4", Timestamp: t0}); err == nil {
+		t.Error("accept allowed an unknown instrument")
+	}
+	if _, _, err := p.accept(strategy.Signal{Symbol: "NQZ4", Price: 100, StopLoss: 90, Timestamp: t0}); err != nil {
+		t.Errorf("accept rejected NQZ4: %v", err)
+	}
+}
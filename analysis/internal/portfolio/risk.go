@@ -0,0 +1,134 @@
+package portfolio
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+)
+
+// RiskLimits are portfolio guardrails checked before a signal becomes an
+// order. A zero value disables the limit.
+type RiskLimits struct {
+	MaxPositionsPerSymbol int
+	MaxPositions          int
+	MaxTradesPerSession   int
+
+	// DailyLossLimit flattens the portfolio and stops trading for the rest
+	// of the session once equity falls this far below the session's opening
+	// equity. TrailingDrawdown does the same, for good, once equity falls
+	// this far below its high-water mark.
+	DailyLossLimit   float64
+	TrailingDrawdown float64
+
+	// LossCooldown blocks new signals for this long after a losing trade.
+	LossCooldown time.Duration
+}
+
+// sessionRollHour is when a new futures session begins, New York time.
+const sessionRollHour = 18
+
+// guard tracks the state the risk limits are evaluated against.
+type guard struct {
+	limits   RiskLimits
+	location *time.Location
+
+	session       string
+	sessionEquity float64
+	trades        int
+	highWater     float64
+	lastLoss      time.Time
+
+	sessionHalted bool
+	halted        string
+}
+
+func newGuard(limits RiskLimits, equity float64) *guard {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		log.Fatalf("failed to load America/New_York location: %v", err)
+	}
+	return &guard{limits: limits, location: location, highWater: equity}
+}
+
+// sessionOf returns the trading day ts belongs to. Sessions start at 18:00
+// New York time and are named after the day they close on.
+func (g *guard) sessionOf(ts time.Time) string {
+	local := ts.In(g.location)
+	if local.Hour() >= sessionRollHour {
+		local = local.AddDate(0, 0, 1)
+	}
+	return local.Format("2006-01-02")
+}
+
+// update rolls the session and checks the loss limits against equity at ts.
+// It returns a reason when the portfolio has to be flattened.
+func (g *guard) update(ts time.Time, equity float64) string {
+	if session := g.sessionOf(ts); session != g.session {
+		g.session = session
+		g.sessionEquity = equity
+		g.trades = 0
+		g.sessionHalted = false
+	}
+	g.highWater = math.Max(g.highWater, equity)
+
+	if g.halted != "" || g.sessionHalted {
+		return ""
+	}
+	if g.limits.TrailingDrawdown > 0 && g.highWater-equity >= g.limits.TrailingDrawdown {
+		g.halted = fmt.Sprintf("trailing drawdown of $%.2f from $%.2f reached", g.limits.TrailingDrawdown, g.highWater)
+		return g.halted
+	}
+	if g.limits.DailyLossLimit > 0 && g.sessionEquity-equity >= g.limits.DailyLossLimit {
+		g.sessionHalted = true
+		return fmt.Sprintf("daily loss limit of $%.2f reached for session %s", g.limits.DailyLossLimit, g.session)
+	}
+	return ""
+}
+
+// closed records a finished position for the loss cooldown.
+func (g *guard) closed(pos *position.Position) {
+	if pos.Status == position.PositionClosed && NetPnL(pos) < 0 {
+		g.lastLoss = pos.ExitTime
+	}
+}
+
+// allow returns an error naming the first limit signal would break given
+// the portfolio's pending and open positions.
+func (g *guard) allow(signal strategy.Signal, active []*position.Position) error {
+	switch {
+	case g.halted != "":
+		return fmt.Errorf("portfolio halted: %s", g.halted)
+	case g.sessionHalted:
+		return fmt.Errorf("daily loss limit reached for session %s", g.session)
+	case g.limits.LossCooldown > 0 && !g.lastLoss.IsZero() && signal.Timestamp.Before(g.lastLoss.Add(g.limits.LossCooldown)):
+		return fmt.Errorf("cooling down after loss at %s", g.lastLoss.Format("2006-01-02 15:04:05"))
+	case g.limits.MaxTradesPerSession > 0 && g.trades >= g.limits.MaxTradesPerSession:
+		return fmt.Errorf("%d trades already taken in session %s", g.trades, g.session)
+	case g.limits.MaxPositions > 0 && len(active) >= g.limits.MaxPositions:
+		return fmt.Errorf("%d positions already working", len(active))
+	}
+
+	if g.limits.MaxPositionsPerSymbol > 0 {
+		var held int
+		for _, pos := range active {
+			if pos.Symbol == signal.Symbol {
+				held++
+			}
+		}
+		if held >= g.limits.MaxPositionsPerSymbol {
+			return fmt.Errorf("%d positions already working on %s", held, signal.Symbol)
+		}
+	}
+	return nil
+}
+
+// halt stops all further trading for reason.
+func (g *guard) halt(reason string) {
+	if g.halted == "" {
+		g.halted = reason
+	}
+}
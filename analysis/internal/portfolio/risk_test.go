@@ -0,0 +1,143 @@
+package portfolio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+)
+
+func TestGuardAllow(t *testing.T) {
+	now := time.Date(2024, 10, 8, 14, 0, 0, 0, time.UTC)
+	nq := &position.Position{Symbol: "NQZ4"}
+	es := &position.Position{Symbol: "ESZ4"}
+
+	tests := []struct {
+		name    string
+		limits  RiskLimits
+		setup   func(g *guard)
+		active  []*position.Position
+		signal  time.Time
+		wantErr bool
+	}{
+		{name: "no limits", active: []*position.Position{nq, nq, es}},
+		{name: "below max positions", limits: RiskLimits{MaxPositions: 2}, active: []*position.Position{nq}},
+		{name: "at max positions", limits: RiskLimits{MaxPositions: 2}, active: []*position.Position{nq, es}, wantErr: true},
+		{name: "other symbol held", limits: RiskLimits{MaxPositionsPerSymbol: 1}, active: []*position.Position{es}},
+		{name: "symbol already held", limits: RiskLimits{MaxPositionsPerSymbol: 1}, active: []*position.Position{es, nq}, wantErr: true},
+		{
+			name:    "session trade limit",
+			limits:  RiskLimits{MaxTradesPerSession: 1},
+			setup:   func(g *guard) { g.trades = 1 },
+			wantErr: true,
+		},
+		{
+			name:    "inside the loss cooldown",
+			limits:  RiskLimits{LossCooldown: 30 * time.Minute},
+			setup:   func(g *guard) { g.lastLoss = now.Add(-29 * time.Minute) },
+			wantErr: true,
+		},
+		{
+			name:   "after the loss cooldown",
+			limits: RiskLimits{LossCooldown: 30 * time.Minute},
+			setup:  func(g *guard) { g.lastLoss = now.Add(-30 * time.Minute) },
+		},
+		{
+			name:    "halted",
+			setup:   func(g *guard) { g.halt("kill switch") },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		g := newGuard(tt.limits, 100000)
+		g.update(now, 100000)
+		if tt.setup != nil {
+			tt.setup(g)
+		}
+		err := g.allow(strategy.Signal{Symbol: "NQZ4", Timestamp: now}, tt.active)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: allow error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGuardLossLimits(t *testing.T) {
+	// 18:00 New York is 22:00 UTC in October; the session after it closes on
+	// the 9th.
+	day := time.Date(2024, 10, 8, 14, 0, 0, 0, time.UTC)
+	nextSession := time.Date(2024, 10, 8, 22, 0, 0, 0, time.UTC)
+
+	type step struct {
+		ts        time.Time
+		equity    float64
+		flatten   bool
+		allowed   bool
+		sessionOf string
+	}
+	tests := []struct {
+		name   string
+		limits RiskLimits
+		steps  []step
+	}{
+		{
+			name:   "daily loss limit halts for the rest of the session",
+			limits: RiskLimits{DailyLossLimit: 1000},
+			steps: []step{
+				{day, 100000, false, true, "2024-10-08"},
+				{day.Add(time.Hour), 99100, false, true, "2024-10-08"},
+				{day.Add(2 * time.Hour), 99000, true, false, "2024-10-08"},
+				// Flattening once is enough, even if equity keeps falling.
+				{day.Add(3 * time.Hour), 98000, false, false, "2024-10-08"},
+				{nextSession.Add(-time.Minute), 98000, false, false, "2024-10-08"},
+				{nextSession, 98000, false, true, "2024-10-09"},
+			},
+		},
+		{
+			name:   "trailing drawdown halts for good",
+			limits: RiskLimits{TrailingDrawdown: 2000},
+			steps: []step{
+				{day, 100000, false, true, "2024-10-08"},
+				{day.Add(time.Hour), 101500, false, true, "2024-10-08"},
+				{day.Add(2 * time.Hour), 99600, false, true, "2024-10-08"},
+				{day.Add(3 * time.Hour), 99500, true, false, "2024-10-08"},
+				{nextSession, 99500, false, false, "2024-10-09"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		g := newGuard(tt.limits, 100000)
+		for i, s := range tt.steps {
+			reason := g.update(s.ts, s.equity)
+			if (reason != "") != s.flatten {
+				t.Errorf("%s: step %d flatten reason = %q, want flatten %v", tt.name, i, reason, s.flatten)
+			}
+			err := g.allow(strategy.Signal{Symbol: "NQZ4", Timestamp: s.ts}, nil)
+			if (err == nil) != s.allowed {
+				t.Errorf("%s: step %d allow error = %v, want allowed %v", tt.name, i, err, s.allowed)
+			}
+			if got := g.sessionOf(s.ts); got != s.sessionOf {
+				t.Errorf("%s: step %d session = %s, want %s", tt.name, i, got, s.sessionOf)
+			}
+		}
+	}
+}
+
+func TestGuardLossCooldownStartsOnLosingTrades(t *testing.T) {
+	exit := time.Date(2024, 10, 8, 14, 0, 0, 0, time.UTC)
+	g := newGuard(RiskLimits{LossCooldown: time.Hour}, 100000)
+
+	// A $100 gross winner that $120 of costs turn into a loss.
+	g.closed(&position.Position{Symbol: "NQZ4", Quantity: 1, Action: strategy.BuyAction, EnterPrice: 100, ExitPrice: 105, Commission: 120, Status: position.PositionClosed, ExitTime: exit})
+	if !g.lastLoss.Equal(exit) {
+		t.Errorf("last loss = %v, want %v", g.lastLoss, exit)
+	}
+
+	g.closed(&position.Position{Symbol: "NQZ4", Quantity: 1, Action: strategy.BuyAction, EnterPrice: 100, ExitPrice: 110, Status: position.PositionClosed, ExitTime: exit.Add(time.Minute)})
+	g.closed(&position.Position{Symbol: "NQZ4", Status: position.PositionCancelled, ExitTime: exit.Add(2 * time.Minute)})
+	if !g.lastLoss.Equal(exit) {
+		t.Errorf("last loss moved to %v by a winner or a cancel", g.lastLoss)
+	}
+}
@@ -0,0 +1,224 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/instrument"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// SizingContext is what a Sizer sees when a signal is accepted.
+type SizingContext struct {
+	Signal     strategy.Signal
+	Instrument instrument.Instrument
+	Equity     float64
+	// ATR is the 14-bar average true range of the signal's symbol, or zero
+	// until enough candles have been seen.
+	ATR float64
+	// Trades, WinRate and Payoff describe the portfolio's closed trades:
+	// how many, the fraction that made money and the average win over the
+	// average loss.
+	Trades  int
+	WinRate float64
+	Payoff  float64
+}
+
+// RiskPerContract is the dollar loss of one contract of Instrument if the
+// signal is stopped out at its stop loss.
+func (s SizingContext) RiskPerContract() float64 {
+	return math.Abs(s.Signal.Price-s.Signal.StopLoss) * s.Instrument.PointValue
+}
+
+// Sizer decides how many contracts of the signal's instrument to trade. The
+// result may be fractional; the portfolio rounds it down to whole contracts,
+// or to micro contracts when it allows them.
+type Sizer interface {
+	Size(ctx SizingContext) float64
+}
+
+// FixedContracts trades the same number of contracts on every signal.
+type FixedContracts struct {
+	Contracts float64
+}
+
+func (s FixedContracts) Size(ctx SizingContext) float64 {
+	return s.Contracts
+}
+
+// FixedRisk risks the same dollar amount to the stop on every signal.
+type FixedRisk struct {
+	Dollars float64
+}
+
+func (s FixedRisk) Size(ctx SizingContext) float64 {
+	return riskTo(s.Dollars, ctx.RiskPerContract())
+}
+
+// PercentRisk risks a fraction of current equity to the stop.
+type PercentRisk struct {
+	Percent float64
+}
+
+func (s PercentRisk) Size(ctx SizingContext) float64 {
+	return riskTo(s.Percent*ctx.Equity, ctx.RiskPerContract())
+}
+
+// VolatilityTarget sizes so that a move of Multiple ATRs costs Dollars,
+// regardless of where the stop is. Nothing is traded until the ATR is known.
+type VolatilityTarget struct {
+	Dollars  float64
+	Multiple float64
+}
+
+func (s VolatilityTarget) Size(ctx SizingContext) float64 {
+	return riskTo(s.Dollars, s.Multiple*ctx.ATR*ctx.Instrument.PointValue)
+}
+
+// KellyCap limits another Sizer so that no trade risks more than Fraction
+// of the Kelly-optimal share of equity, estimated from the portfolio's
+// closed trades. Until MinTrades trades have closed the inner size is used
+// as is; a negative edge sizes to zero.
+type KellyCap struct {
+	Sizer     Sizer
+	Fraction  float64
+	MinTrades int
+}
+
+func (s KellyCap) Size(ctx SizingContext) float64 {
+	size := s.Sizer.Size(ctx)
+	if ctx.Trades < s.MinTrades || ctx.Payoff == 0 {
+		return size
+	}
+
+	kelly := ctx.WinRate - (1-ctx.WinRate)/ctx.Payoff
+	if kelly <= 0 {
+		return 0
+	}
+	return math.Min(size, riskTo(s.Fraction*kelly*ctx.Equity, ctx.RiskPerContract()))
+}
+
+func riskTo(dollars, perContract float64) float64 {
+	if perContract <= 0 {
+		return 0
+	}
+	return dollars / perContract
+}
+
+// ParseSizer builds a Sizer from a spec such as "fixed:1", "risk:500",
+// "percent:0.01" or "atr:500:2".
+func ParseSizer(spec string) (Sizer, error) {
+	parts := strings.Split(spec, ":")
+	params := make([]float64, len(parts)-1)
+	for i, part := range parts[1:] {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sizing parameter in %q: %w", spec, err)
+		}
+		params[i] = value
+	}
+
+	want := map[string]int{"fixed": 1, "risk": 1, "percent": 1, "atr": 2}
+	n, ok := want[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown sizing policy %q", parts[0])
+	}
+	if len(params) != n {
+		return nil, fmt.Errorf("sizing spec %q wants %d parameter(s)", spec, n)
+	}
+
+	switch parts[0] {
+	case "fixed":
+		return FixedContracts{Contracts: params[0]}, nil
+	case "risk":
+		return FixedRisk{Dollars: params[0]}, nil
+	case "percent":
+		return PercentRisk{Percent: params[0]}, nil
+	default:
+		return VolatilityTarget{Dollars: params[0], Multiple: params[1]}, nil
+	}
+}
+
+// roundContracts turns a fractional size in inst into a tradable quantity.
+// Without micros the size is rounded down to whole contracts. With micros,
+// sizes that are not a whole number of full contracts trade as micros
+// instead; an empty contract means the signal's own symbol.
+func roundContracts(size float64, inst instrument.Instrument, allowMicro bool) (string, int) {
+	const epsilon = 1e-9
+	whole := int(math.Floor(size + epsilon))
+
+	micro, ok := instrument.Lookup(inst.Micro)
+	if !allowMicro || !ok || micro.PointValue == 0 {
+		return "", whole
+	}
+
+	ratio := int(math.Round(inst.PointValue / micro.PointValue))
+	micros := int(math.Floor(size*float64(ratio) + epsilon))
+	if micros%ratio == 0 {
+		return "", micros / ratio
+	}
+	return micro.Symbol, micros
+}
+
+// atr is a Wilder average true range over a fixed period.
+type atr struct {
+	period    int
+	seen      int
+	value     float64
+	prevClose float64
+}
+
+func (a *atr) update(c candle.Candle) {
+	tr := c.High - c.Low
+	if a.seen > 0 {
+		tr = math.Max(tr, math.Max(math.Abs(c.High-a.prevClose), math.Abs(c.Low-a.prevClose)))
+	}
+	a.prevClose = c.Close
+	a.seen++
+
+	if a.seen <= a.period {
+		a.value += (tr - a.value) / float64(a.seen)
+		return
+	}
+	a.value += (tr - a.value) / float64(a.period)
+}
+
+func (a *atr) current() float64 {
+	if a == nil || a.seen < a.period {
+		return 0
+	}
+	return a.value
+}
+
+// tradeStats summarises closed positions for Kelly sizing.
+func tradeStats(positions []*position.Position) (trades int, winRate, payoff float64) {
+	var wins, losses int
+	var won, lost float64
+	for _, pos := range positions {
+		if pos.Status != position.PositionClosed {
+			continue
+		}
+		pnl := NetPnL(pos)
+		if pnl > 0 {
+			wins++
+			won += pnl
+		} else {
+			losses++
+			lost -= pnl
+		}
+	}
+
+	trades = wins + losses
+	if trades == 0 {
+		return 0, 0, 0
+	}
+	winRate = float64(wins) / float64(trades)
+	if wins > 0 && losses > 0 && lost > 0 {
+		payoff = (won / float64(wins)) / (lost / float64(losses))
+	}
+	return trades, winRate, payoff
+}
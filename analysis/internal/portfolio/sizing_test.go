@@ -0,0 +1,143 @@
+package portfolio
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/instrument"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+)
+
+func TestSizers(t *testing.T) {
+	nq, _ := instrument.Lookup("NQ")
+	// A 10 point stop risks $200 a contract.
+	base := SizingContext{
+		Signal:     strategy.Signal{Symbol: "NQZ4", Price: 100, StopLoss: 90},
+		Instrument: nq,
+		Equity:     100000,
+		ATR:        5,
+	}
+	with := func(change func(*SizingContext)) SizingContext {
+		ctx := base
+		change(&ctx)
+		return ctx
+	}
+
+	tests := []struct {
+		name  string
+		sizer Sizer
+		ctx   SizingContext
+		want  float64
+	}{
+		{"fixed contracts", FixedContracts{Contracts: 2}, base, 2},
+		{"fixed risk", FixedRisk{Dollars: 500}, base, 2.5},
+		{"percent of equity", PercentRisk{Percent: 0.01}, base, 5},
+		{"no stop sizes to zero", FixedRisk{Dollars: 500}, with(func(c *SizingContext) { c.Signal.StopLoss = 100 }), 0},
+		// Two 5 point ATRs on NQ cost $200 a contract.
+		{"volatility target", VolatilityTarget{Dollars: 400, Multiple: 2}, base, 2},
+		{"volatility target before the ATR is known", VolatilityTarget{Dollars: 400, Multiple: 2}, with(func(c *SizingContext) { c.ATR = 0 }), 0},
+		{
+			"kelly before enough trades",
+			KellyCap{Sizer: FixedRisk{Dollars: 2000}, Fraction: 0.5, MinTrades: 20},
+			with(func(c *SizingContext) { c.Trades, c.WinRate, c.Payoff = 10, 0.5, 2 }),
+			10,
+		},
+		{
+			// Kelly is 0.5 - 0.5/2 = 0.25; half of it on $10,000 is $1,250.
+			"kelly caps the inner size",
+			KellyCap{Sizer: FixedRisk{Dollars: 2000}, Fraction: 0.5, MinTrades: 20},
+			with(func(c *SizingContext) { c.Equity, c.Trades, c.WinRate, c.Payoff = 10000, 30, 0.5, 2 }),
+			6.25,
+		},
+		{
+			"kelly leaves a smaller inner size alone",
+			KellyCap{Sizer: FixedRisk{Dollars: 200}, Fraction: 0.5, MinTrades: 20},
+			with(func(c *SizingContext) { c.Equity, c.Trades, c.WinRate, c.Payoff = 10000, 30, 0.5, 2 }),
+			1,
+		},
+		{
+			"kelly with a negative edge",
+			KellyCap{Sizer: FixedRisk{Dollars: 2000}, Fraction: 0.5, MinTrades: 20},
+			with(func(c *SizingContext) { c.Trades, c.WinRate, c.Payoff = 30, 0.2, 2 }),
+			0,
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.sizer.Size(tt.ctx); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: size = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoundContracts(t *testing.T) {
+	nq, _ := instrument.Lookup("NQ")
+	mnq, _ := instrument.Lookup("MNQ")
+
+	tests := []struct {
+		size       float64
+		inst       instrument.Instrument
+		allowMicro bool
+		contract   string
+		quantity   int
+	}{
+		{2.7, nq, false, "", 2},
+		{2.7, nq, true, "MNQ", 27},
+		{3, nq, true, "", 3},
+		{2.9999999999, nq, false, "", 3},
+		{0.05, nq, true, "", 0},
+		{0.7, nq, false, "", 0},
+		{4.6, mnq, true, "", 4},
+	}
+	for _, tt := range tests {
+		contract, quantity := roundContracts(tt.size, tt.inst, tt.allowMicro)
+		if contract != tt.contract || quantity != tt.quantity {
+			t.Errorf("roundContracts(%v, %s, %v) = %q, %d, want %q, %d", tt.size, tt.inst.Symbol, tt.allowMicro, contract, quantity, tt.contract, tt.quantity)
+		}
+	}
+}
+
+func TestParseSizer(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Sizer
+		wantErr bool
+	}{
+		{spec: "fixed:1", want: FixedContracts{Contracts: 1}},
+		{spec: "risk:500", want: FixedRisk{Dollars: 500}},
+		{spec: "percent:0.01", want: PercentRisk{Percent: 0.01}},
+		{spec: "atr:500:2", want: VolatilityTarget{Dollars: 500, Multiple: 2}},
+		{spec: "atr:500", wantErr: true},
+		{spec: "fixed:one", wantErr: true},
+		{spec: "martingale:2", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSizer(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSizer(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSizer(%q) = %#v, want %#v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestTradeStats(t *testing.T) {
+	closed := func(exit float64) *position.Position {
+		return &position.Position{Symbol: "NQZ4", Quantity: 1, Action: strategy.BuyAction, EnterPrice: 100, ExitPrice: exit, Status: position.PositionClosed}
+	}
+	positions := []*position.Position{
+		closed(120), // +$400
+		closed(110), // +$200
+		closed(85),  // -$300
+		{Symbol: "NQZ4", Quantity: 1, Action: strategy.BuyAction, EnterPrice: 100, Status: position.PositionOpen},
+	}
+
+	trades, winRate, payoff := tradeStats(positions)
+	// The average win of $300 over the average loss of $300.
+	if trades != 3 || math.Abs(winRate-2.0/3) > 1e-9 || math.Abs(payoff-1) > 1e-9 {
+		t.Errorf("tradeStats = %d, %v, %v, want 3, 0.667, 1", trades, winRate, payoff)
+	}
+}
@@ -0,0 +1,132 @@
+package runs
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+)
+
+// equityBatch is how many equity points are buffered between writes.
+const equityBatch = 500
+
+// Recorder is a portfolio.Recorder that writes a run to a Repository as the
+// session progresses. Close must be called to flush the last equity points
+// and mark the run finished.
+type Recorder struct {
+	ctx   context.Context
+	repo  *Repository
+	RunID int
+
+	signalID int
+	orders   map[*position.Position]int
+	pending  []portfolio.EquityPoint
+	first    time.Time
+	last     portfolio.EquityPoint
+}
+
+var _ portfolio.Recorder = (*Recorder)(nil)
+
+// NewRecorder creates run in repo and returns a Recorder for it. An empty
+// CodeVersion is filled from the binary's VCS revision.
+func NewRecorder(ctx context.Context, repo *Repository, run Run) *Recorder {
+	if run.CodeVersion == "" {
+		run.CodeVersion = CodeVersion()
+	}
+
+	// Writes outlive ctx so a run interrupted by shutdown is still closed.
+	ctx = context.WithoutCancel(ctx)
+	return &Recorder{
+		ctx:    ctx,
+		repo:   repo,
+		RunID:  repo.CreateRun(ctx, run),
+		orders: make(map[*position.Position]int),
+	}
+}
+
+func (r *Recorder) RecordSignal(signal strategy.Signal, rejection error) {
+	var reason string
+	if rejection != nil {
+		reason = rejection.Error()
+	}
+	r.signalID = r.repo.AddSignal(r.ctx, r.RunID, signal, reason)
+}
+
+// RecordOrder stores pos as an order placed from the last recorded signal.
+func (r *Recorder) RecordOrder(pos *position.Position) {
+	r.orders[pos] = r.repo.AddOrder(r.ctx, r.RunID, r.signalID, pos)
+	r.signalID = 0
+}
+
+func (r *Recorder) RecordPosition(pos *position.Position) {
+	orderID, ok := r.orders[pos]
+	if !ok {
+		orderID = r.repo.AddOrder(r.ctx, r.RunID, 0, pos)
+		r.orders[pos] = orderID
+	}
+	r.repo.SavePosition(r.ctx, r.RunID, orderID, pos)
+	if !pos.IsOpen() {
+		delete(r.orders, pos)
+	}
+}
+
+// RecordEquity buffers point. Points sharing a timestamp, as when several
+// symbols close a bar together, keep only the last.
+func (r *Recorder) RecordEquity(point portfolio.EquityPoint) {
+	if r.first.IsZero() {
+		r.first = point.Timestamp
+	}
+	r.last = point
+
+	if n := len(r.pending); n > 0 && r.pending[n-1].Timestamp.Equal(point.Timestamp) {
+		r.pending[n-1] = point
+		return
+	}
+	if len(r.pending) >= equityBatch {
+		r.flush()
+	}
+	r.pending = append(r.pending, point)
+}
+
+// Close writes any buffered equity points and marks the run finished.
+func (r *Recorder) Close() {
+	r.flush()
+	r.repo.FinishRun(r.ctx, r.RunID, r.first, r.last.Timestamp, r.last.Equity)
+}
+
+func (r *Recorder) flush() {
+	if len(r.pending) == 0 {
+		return
+	}
+	r.repo.AddEquityPoints(r.ctx, r.RunID, r.pending)
+	r.pending = r.pending[:0]
+}
+
+// CodeVersion returns the VCS revision the binary was built from, marked
+// dirty when built from a modified tree, or "unknown".
+func CodeVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if modified == "true" {
+		return revision + "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,341 @@
+// Package runs stores backtest runs and everything they traded in Postgres
+// so runs can be compared after the fact.
+package runs
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/mgordon34/gostonks/analysis/cmd/position"
+	"github.com/mgordon34/gostonks/analysis/internal/portfolio"
+	"github.com/mgordon34/gostonks/analysis/internal/strategy"
+)
+
+// Run describes one backtest session.
+type Run struct {
+	ID              int
+	Portfolio       string
+	Strategy        string
+	Params          map[string]any
+	Market          string
+	Symbols         []string
+	DataStart       time.Time
+	DataEnd         time.Time
+	CodeVersion     string
+	StartingBalance float64
+	EndingEquity    float64
+	StartedAt       time.Time
+	FinishedAt      time.Time
+}
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func NewRepository(db *pgxpool.Pool) *Repository {
+	return &Repository{db}
+}
+
+// CreateRun inserts run and returns its id.
+func (r *Repository) CreateRun(ctx context.Context, run Run) int {
+	sql := `INSERT INTO backtest_runs (portfolio, strategy, params, market, symbols, code_version, starting_balance)
+			VALUES (@portfolio, @strategy, @params, @market, @symbols, @code_version, @starting_balance)
+			RETURNING id`
+
+	params, err := json.Marshal(run.Params)
+	if err != nil {
+		log.Fatalf("Failed to marshal run params: %v", err)
+	}
+
+	var id int
+	err = r.db.QueryRow(
+		ctx,
+		sql,
+		pgx.NamedArgs{
+			"portfolio":        run.Portfolio,
+			"strategy":         run.Strategy,
+			"params":           params,
+			"market":           run.Market,
+			"symbols":          strings.Join(run.Symbols, ","),
+			"code_version":     run.CodeVersion,
+			"starting_balance": run.StartingBalance,
+		},
+	).Scan(&id)
+	if err != nil {
+		log.Fatalf("Failed to create backtest run: %v", err)
+	}
+
+	return id
+}
+
+// FinishRun records the range of data a run covered and where it ended.
+func (r *Repository) FinishRun(ctx context.Context, id int, dataStart time.Time, dataEnd time.Time, endingEquity float64) {
+	sql := `UPDATE backtest_runs
+			SET data_start = @data_start, data_end = @data_end, ending_equity = @ending_equity, finished_at = NOW()
+			WHERE id = @id`
+
+	_, err := r.db.Exec(
+		ctx,
+		sql,
+		pgx.NamedArgs{
+			"id":            id,
+			"data_start":    nullTime(dataStart),
+			"data_end":      nullTime(dataEnd),
+			"ending_equity": endingEquity,
+		},
+	)
+	if err != nil {
+		log.Fatalf("Failed to finish backtest run: %v", err)
+	}
+}
+
+// GetRuns returns every run, newest first.
+func (r *Repository) GetRuns(ctx context.Context) []Run {
+	sql := `SELECT id, portfolio, strategy, params, market, symbols, data_start, data_end,
+				code_version, starting_balance, ending_equity, started_at, finished_at
+			FROM backtest_runs
+			ORDER BY started_at DESC`
+
+	rows, err := r.db.Query(ctx, sql)
+	if err != nil {
+		log.Fatalf("Failed to query backtest runs: %v", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var run Run
+		var params []byte
+		var symbols string
+		var dataStart, dataEnd, finishedAt *time.Time
+		var endingEquity *float64
+		if err := rows.Scan(
+			&run.ID,
+			&run.Portfolio,
+			&run.Strategy,
+			&params,
+			&run.Market,
+			&symbols,
+			&dataStart,
+			&dataEnd,
+			&run.CodeVersion,
+			&run.StartingBalance,
+			&endingEquity,
+			&run.StartedAt,
+			&finishedAt,
+		); err != nil {
+			log.Fatalf("Failed to scan backtest run: %v", err)
+		}
+		if err := json.Unmarshal(params, &run.Params); err != nil {
+			log.Fatalf("Failed to unmarshal run params: %v", err)
+		}
+		run.Symbols = strings.Split(symbols, ",")
+		if dataStart != nil {
+			run.DataStart = *dataStart
+		}
+		if dataEnd != nil {
+			run.DataEnd = *dataEnd
+		}
+		if finishedAt != nil {
+			run.FinishedAt = *finishedAt
+		}
+		if endingEquity != nil {
+			run.EndingEquity = *endingEquity
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Fatalf("Backtest run rows error: %v", err)
+	}
+
+	return runs
+}
+
+// AddSignal records a signal and why it was rejected, if it was, and
+// returns its id.
+func (r *Repository) AddSignal(ctx context.Context, runID int, signal strategy.Signal, rejection string) int {
+	sql := `INSERT INTO signals (run_id, symbol, action, order_type, price, stop_loss, take_profit, timestamp, cancel_time, accepted, reject_reason, setup, context)
+			VALUES (@run_id, @symbol, @action, @order_type, @price, @stop_loss, @take_profit, @timestamp, @cancel_time, @accepted, @reject_reason, @setup, @context)
+			RETURNING id`
+
+	var setup *string
+	var signalContext []byte
+	if signal.Context != nil {
+		setup = nullString(signal.Context.Setup)
+		var err error
+		signalContext, err = json.Marshal(signal.Context)
+		if err != nil {
+			log.Fatalf("Failed to marshal signal context: %v", err)
+		}
+	}
+
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		sql,
+		pgx.NamedArgs{
+			"run_id":        runID,
+			"symbol":        signal.Symbol,
+			"action":        string(signal.Action),
+			"order_type":    string(signal.Type),
+			"price":         signal.Price,
+			"stop_loss":     signal.StopLoss,
+			"take_profit":   signal.TakeProfit,
+			"timestamp":     signal.Timestamp,
+			"cancel_time":   nullTime(signal.CancelTime),
+			"accepted":      rejection == "",
+			"reject_reason": nullString(rejection),
+			"setup":         setup,
+			"context":       signalContext,
+		},
+	).Scan(&id)
+	if err != nil {
+		log.Fatalf("Failed to add signal: %v", err)
+	}
+
+	return id
+}
+
+// AddOrder records the order a signal was submitted as and returns its id.
+// signalID may be zero when the order did not come from a recorded signal.
+func (r *Repository) AddOrder(ctx context.Context, runID int, signalID int, pos *position.Position) int {
+	sql := `INSERT INTO orders (run_id, signal_id, symbol, contract, quantity, action, order_type, price, submitted_at)
+			VALUES (@run_id, @signal_id, @symbol, @contract, @quantity, @action, @order_type, @price, @submitted_at)
+			RETURNING id`
+
+	var signal *int
+	if signalID != 0 {
+		signal = &signalID
+	}
+
+	var id int
+	err := r.db.QueryRow(
+		ctx,
+		sql,
+		pgx.NamedArgs{
+			"run_id":       runID,
+			"signal_id":    signal,
+			"symbol":       pos.Symbol,
+			"contract":     pos.TradedSymbol(),
+			"quantity":     pos.Quantity,
+			"action":       string(pos.Action),
+			"order_type":   string(pos.Type),
+			"price":        pos.EnterPrice,
+			"submitted_at": pos.Timestamp,
+		},
+	).Scan(&id)
+	if err != nil {
+		log.Fatalf("Failed to add order: %v", err)
+	}
+
+	return id
+}
+
+// SavePosition inserts or updates the position filled from orderID.
+func (r *Repository) SavePosition(ctx context.Context, runID int, orderID int, pos *position.Position) {
+	sql := `INSERT INTO positions (run_id, order_id, symbol, contract, quantity, action, status, exit_reason,
+				enter_price, exit_price, stop_loss, take_profit, enter_time, exit_time,
+				entry_slippage, exit_slippage, commission, fees, mae, mfe, net_pnl, setup)
+			VALUES (@run_id, @order_id, @symbol, @contract, @quantity, @action, @status, @exit_reason,
+				@enter_price, @exit_price, @stop_loss, @take_profit, @enter_time, @exit_time,
+				@entry_slippage, @exit_slippage, @commission, @fees, @mae, @mfe, @net_pnl, @setup)
+			ON CONFLICT (order_id) DO UPDATE SET
+				status = EXCLUDED.status,
+				exit_reason = EXCLUDED.exit_reason,
+				enter_price = EXCLUDED.enter_price,
+				exit_price = EXCLUDED.exit_price,
+				enter_time = EXCLUDED.enter_time,
+				exit_time = EXCLUDED.exit_time,
+				entry_slippage = EXCLUDED.entry_slippage,
+				exit_slippage = EXCLUDED.exit_slippage,
+				commission = EXCLUDED.commission,
+				fees = EXCLUDED.fees,
+				mae = EXCLUDED.mae,
+				mfe = EXCLUDED.mfe,
+				net_pnl = EXCLUDED.net_pnl`
+
+	args := pgx.NamedArgs{
+		"run_id":         runID,
+		"order_id":       orderID,
+		"symbol":         pos.Symbol,
+		"contract":       pos.TradedSymbol(),
+		"quantity":       pos.Quantity,
+		"action":         string(pos.Action),
+		"status":         string(pos.Status),
+		"exit_reason":    nullString(string(pos.ExitReason)),
+		"enter_price":    (*float64)(nil),
+		"exit_price":     (*float64)(nil),
+		"stop_loss":      pos.StopLoss,
+		"take_profit":    pos.TakeProfit,
+		"enter_time":     nullTime(pos.EnterTime),
+		"exit_time":      nullTime(pos.ExitTime),
+		"entry_slippage": pos.EntrySlippage,
+		"exit_slippage":  pos.ExitSlippage,
+		"commission":     pos.Commission,
+		"fees":           pos.Fees,
+		"mae":            pos.MAE,
+		"mfe":            pos.MFE,
+		"net_pnl":        (*float64)(nil),
+		"setup":          nullString(pos.Setup()),
+	}
+	if !pos.EnterTime.IsZero() {
+		args["enter_price"] = pos.EnterPrice
+	}
+	if pos.Status == position.PositionClosed {
+		args["exit_price"] = pos.ExitPrice
+		args["net_pnl"] = portfolio.NetPnL(pos)
+	}
+
+	if _, err := r.db.Exec(ctx, sql, args); err != nil {
+		log.Fatalf("Failed to save position: %v", err)
+	}
+}
+
+// AddEquityPoints bulk inserts a run's equity points.
+func (r *Repository) AddEquityPoints(ctx context.Context, runID int, points []portfolio.EquityPoint) {
+	rows := make([][]any, len(points))
+	for i, point := range points {
+		rows[i] = []any{
+			runID,
+			point.Timestamp,
+			point.Cash,
+			point.Realized,
+			point.Unrealized,
+			point.Equity,
+			point.MarginUsed,
+			point.Drawdown,
+			point.DrawdownPct,
+		}
+	}
+
+	_, err := r.db.CopyFrom(
+		ctx,
+		pgx.Identifier{"equity_points"},
+		[]string{"run_id", "timestamp", "cash", "realized", "unrealized", "equity", "margin_used", "drawdown", "drawdown_pct"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		log.Fatalf("Failed to add equity points: %v", err)
+	}
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,76 @@
+package strategy
+
+import (
+	"time"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// Aggregator builds bars of a higher timeframe from the candles of one
+// series. Intraday bars align to the clock in UTC; daily and weekly bars
+// follow the futures session, opening at 18:00 New York time.
+type Aggregator struct {
+	Timeframe candle.Timeframe
+	Location  *time.Location
+
+	bar candle.Candle
+	end time.Time
+}
+
+func NewAggregator(timeframe candle.Timeframe, location *time.Location) *Aggregator {
+	return &Aggregator{Timeframe: timeframe, Location: location}
+}
+
+// Add folds c into the bar it belongs to and returns any bars that closed,
+// oldest first. A bar closes when a candle ends at or after its close, or
+// when a candle for a later bar arrives first because of a gap in the data.
+func (a *Aggregator) Add(c candle.Candle) []candle.Candle {
+	var closed []candle.Candle
+
+	start, end := a.Bounds(c.Timestamp)
+	if !a.bar.Timestamp.IsZero() && !a.bar.Timestamp.Equal(start) {
+		closed = append(closed, a.bar)
+		a.bar = candle.Candle{}
+	}
+
+	if a.bar.Timestamp.IsZero() {
+		a.bar = candle.Candle{
+			Market:    c.Market,
+			Symbol:    c.Symbol,
+			Timeframe: a.Timeframe,
+			Open:      c.Open,
+			High:      c.High,
+			Low:       c.Low,
+			Close:     c.Close,
+			Volume:    c.Volume,
+			Timestamp: start,
+		}
+		a.end = end
+	} else {
+		a.bar.High = max(a.bar.High, c.High)
+		a.bar.Low = min(a.bar.Low, c.Low)
+		a.bar.Close = c.Close
+		a.bar.Volume += c.Volume
+	}
+
+	if !c.Timestamp.Add(c.Timeframe.Duration()).Before(a.end) {
+		closed = append(closed, a.bar)
+		a.bar = candle.Candle{}
+	}
+	return closed
+}
+
+// Bounds returns the open and close of the bar containing t.
+func (a *Aggregator) Bounds(t time.Time) (time.Time, time.Time) {
+	switch a.Timeframe.Unit {
+	case candle.Day:
+		start := sessionDay(t, a.Location)
+		return start.UTC(), start.AddDate(0, 0, a.Timeframe.Count).UTC()
+	case candle.Week:
+		start := sessionWeek(t, a.Location)
+		return start.UTC(), start.AddDate(0, 0, 7*a.Timeframe.Count).UTC()
+	default:
+		start := a.Timeframe.Truncate(t)
+		return start, start.Add(a.Timeframe.Duration())
+	}
+}
@@ -0,0 +1,176 @@
+package strategy
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// BarBuffer is a fixed-capacity ring of candles in timestamp order. Appending
+// evicts the oldest bar once full, so memory stays constant no matter how
+// long a backtest runs.
+//
+// Range low/high queries are answered from sparse tables maintained
+// alongside the ring: lows[k][i] holds the absolute index of the lowest bar in
+// the 2^k bars starting at absolute index i (stored at slot i % capacity).
+// Each append fills in the log(capacity) ranges that end at the new bar, and
+// any range is then covered by two overlapping power-of-two ranges, so
+// queries are O(1) after an O(log n) timestamp search.
+type BarBuffer struct {
+	bars  []candle.Candle
+	next  int
+	count int
+
+	lows  [][]int
+	highs [][]int
+}
+
+func NewBarBuffer(capacity int) *BarBuffer {
+	capacity = max(capacity, 1)
+	levels := bits.Len(uint(capacity))
+
+	b := &BarBuffer{
+		bars:  make([]candle.Candle, capacity),
+		lows:  make([][]int, levels),
+		highs: make([][]int, levels),
+	}
+	for k := range levels {
+		b.lows[k] = make([]int, capacity)
+		b.highs[k] = make([]int, capacity)
+	}
+
+	return b
+}
+
+func (b *BarBuffer) Len() int {
+	return b.count
+}
+
+func (b *BarBuffer) Cap() int {
+	return len(b.bars)
+}
+
+func (b *BarBuffer) Reset() {
+	b.next = 0
+	b.count = 0
+}
+
+// Append adds c as the newest bar. A bar with the same timestamp as the
+// newest replaces it; older bars are rejected.
+func (b *BarBuffer) Append(c candle.Candle) bool {
+	if last, ok := b.Last(); ok {
+		if c.Timestamp.Before(last.Timestamp) {
+			return false
+		}
+		if c.Timestamp.Equal(last.Timestamp) {
+			b.set(b.next-1, c)
+			return true
+		}
+	}
+
+	b.next++
+	b.count = min(b.count+1, len(b.bars))
+	b.set(b.next-1, c)
+	return true
+}
+
+// At returns the i-th bar held, oldest first.
+func (b *BarBuffer) At(i int) candle.Candle {
+	return b.bars[b.slot(b.oldest()+i)]
+}
+
+func (b *BarBuffer) Last() (candle.Candle, bool) {
+	if b.count == 0 {
+		return candle.Candle{}, false
+	}
+	return b.At(b.count - 1), true
+}
+
+// Get returns the bar stamped exactly ts.
+func (b *BarBuffer) Get(ts time.Time) (candle.Candle, bool) {
+	i := b.search(ts)
+	if i < b.count && b.At(i).Timestamp.Equal(ts) {
+		return b.At(i), true
+	}
+	return candle.Candle{}, false
+}
+
+// Min returns the bar with the lowest low between start and end inclusive,
+// preferring the earliest on ties.
+func (b *BarBuffer) Min(start time.Time, end time.Time) (candle.Candle, bool) {
+	return b.query(b.lows, b.lower, start, end)
+}
+
+// Max returns the bar with the highest high between start and end
+// inclusive, preferring the earliest on ties.
+func (b *BarBuffer) Max(start time.Time, end time.Time) (candle.Candle, bool) {
+	return b.query(b.highs, b.higher, start, end)
+}
+
+func (b *BarBuffer) query(table [][]int, pick func(int, int) int, start time.Time, end time.Time) (candle.Candle, bool) {
+	lo := b.search(start)
+	hi := b.search(end.Add(1)) - 1
+	if lo > hi || b.count == 0 {
+		return candle.Candle{}, false
+	}
+
+	i := b.oldest() + lo
+	j := b.oldest() + hi
+	k := bits.Len(uint(j-i+1)) - 1
+	best := pick(table[k][b.slot(i)], table[k][b.slot(j-(1<<k)+1)])
+
+	return b.bars[b.slot(best)], true
+}
+
+// set stores c at absolute index abs and rebuilds every sparse table range
+// ending there.
+func (b *BarBuffer) set(abs int, c candle.Candle) {
+	b.bars[b.slot(abs)] = c
+	b.lows[0][b.slot(abs)] = abs
+	b.highs[0][b.slot(abs)] = abs
+
+	for k := 1; k < len(b.lows); k++ {
+		start := abs - (1 << k) + 1
+		if start < b.oldest() {
+			break
+		}
+		mid := start + (1 << (k - 1))
+		b.lows[k][b.slot(start)] = b.lower(b.lows[k-1][b.slot(start)], b.lows[k-1][b.slot(mid)])
+		b.highs[k][b.slot(start)] = b.higher(b.highs[k-1][b.slot(start)], b.highs[k-1][b.slot(mid)])
+	}
+}
+
+// lower returns whichever of two absolute indices has the lower low,
+// keeping the earlier one on ties.
+func (b *BarBuffer) lower(earlier int, later int) int {
+	if b.bars[b.slot(later)].Low < b.bars[b.slot(earlier)].Low {
+		return later
+	}
+	return earlier
+}
+
+// higher returns whichever of two absolute indices has the higher high,
+// keeping the earlier one on ties.
+func (b *BarBuffer) higher(earlier int, later int) int {
+	if b.bars[b.slot(later)].High > b.bars[b.slot(earlier)].High {
+		return later
+	}
+	return earlier
+}
+
+// search returns the position of the first bar at or after ts.
+func (b *BarBuffer) search(ts time.Time) int {
+	return sort.Search(b.count, func(i int) bool {
+		return !b.At(i).Timestamp.Before(ts)
+	})
+}
+
+func (b *BarBuffer) oldest() int {
+	return b.next - b.count
+}
+
+func (b *BarBuffer) slot(abs int) int {
+	return abs % len(b.bars)
+}
@@ -0,0 +1,112 @@
+package strategy
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+func TestBarBufferEvictsAtCapacity(t *testing.T) {
+	candles := series(time.Date(2024, 10, 8, 0, 0, 0, 0, time.UTC), "1m", 5, flat)
+	b := NewBarBuffer(3)
+	for _, c := range candles {
+		b.Append(c)
+	}
+
+	if b.Len() != 3 || b.Cap() != 3 {
+		t.Fatalf("len, cap = %d, %d, want 3, 3", b.Len(), b.Cap())
+	}
+	for i := range b.Len() {
+		if got, want := b.At(i).Timestamp, candles[i+2].Timestamp; !got.Equal(want) {
+			t.Errorf("bar %d at %v, want %v", i, got, want)
+		}
+	}
+	if _, ok := b.Get(candles[1].Timestamp); ok {
+		t.Error("evicted bar is still held")
+	}
+	if last, _ := b.Last(); !last.Timestamp.Equal(candles[4].Timestamp) {
+		t.Errorf("last bar at %v, want %v", last.Timestamp, candles[4].Timestamp)
+	}
+}
+
+func TestBarBufferReplacesNewest(t *testing.T) {
+	candles := series(time.Date(2024, 10, 8, 0, 0, 0, 0, time.UTC), "1m", 3, flat)
+	b := NewBarBuffer(5)
+	for _, c := range candles {
+		b.Append(c)
+	}
+
+	// The newest bar updates in place, becoming the range's low.
+	updated := candles[2]
+	updated.Low = 19000
+	if !b.Append(updated) {
+		t.Fatal("update of the newest bar was rejected")
+	}
+	if b.Len() != 3 {
+		t.Errorf("len = %d after an update, want 3", b.Len())
+	}
+	if low, _ := b.Min(candles[0].Timestamp, candles[2].Timestamp); low.Low != 19000 {
+		t.Errorf("range low = %v, want the updated 19000", low.Low)
+	}
+
+	if b.Append(candles[1]) {
+		t.Error("a bar older than the newest was accepted")
+	}
+	if last, _ := b.Last(); last.Low != 19000 {
+		t.Errorf("last bar low = %v after a rejected append, want 19000", last.Low)
+	}
+}
+
+func TestBarBufferRangesMatchAScan(t *testing.T) {
+	// Prices from a small set give plenty of ties, which go to the earliest
+	// bar.
+	rng := rand.New(rand.NewPCG(1, 2))
+	candles := series(time.Date(2024, 10, 8, 0, 0, 0, 0, time.UTC), "1m", 100, func(i int) (float64, float64, float64, float64) {
+		p := 20000 + float64(rng.IntN(8))
+		return p, p + float64(rng.IntN(4)), p - float64(rng.IntN(4)), p
+	})
+
+	// A capacity that is not a power of two wraps the ring at every level of
+	// the sparse tables.
+	b := NewBarBuffer(13)
+	for n, c := range candles {
+		b.Append(c)
+		held := candles[max(0, n+1-b.Cap()) : n+1]
+		for i := range held {
+			for j := i; j < len(held); j++ {
+				low, high := held[i], held[i]
+				for _, bar := range held[i+1 : j+1] {
+					if bar.Low < low.Low {
+						low = bar
+					}
+					if bar.High > high.High {
+						high = bar
+					}
+				}
+
+				if got, _ := b.Min(held[i].Timestamp, held[j].Timestamp); !sameBar(got, low) {
+					t.Fatalf("after %d bars: min of %d..%d = %v at %v, want %v at %v", n+1, i, j, got.Low, got.Timestamp, low.Low, low.Timestamp)
+				}
+				if got, _ := b.Max(held[i].Timestamp, held[j].Timestamp); !sameBar(got, high) {
+					t.Fatalf("after %d bars: max of %d..%d = %v at %v, want %v at %v", n+1, i, j, got.High, got.Timestamp, high.High, high.Timestamp)
+				}
+			}
+		}
+	}
+
+	// Bounds between bars cover the bars inside them, and a range with no
+	// bars finds nothing.
+	last := candles[len(candles)-1].Timestamp
+	if got, _ := b.Max(last.Add(-90*time.Second), last.Add(time.Hour)); !got.Timestamp.After(last.Add(-2 * time.Minute)) {
+		t.Errorf("max of the last two bars at %v", got.Timestamp)
+	}
+	if _, ok := b.Min(last.Add(time.Second), last.Add(time.Hour)); ok {
+		t.Error("found a low after the newest bar")
+	}
+}
+
+func sameBar(a, b candle.Candle) bool {
+	return a.Timestamp.Equal(b.Timestamp) && a.Low == b.Low && a.High == b.High
+}
@@ -20,3 +20,23 @@ const (
 	MarketOrder OrderType = "market"
 	LimitOrder OrderType = "limit"
 )
+
+// PoolKind tags where a liquidity pool came from, so strategies can choose
+// which pools count as a raid.
+type PoolKind string
+
+const (
+	SessionPool PoolKind = "session"
+	HigherTimeframePool PoolKind = "higher_timeframe"
+	PreviousDayPool PoolKind = "previous_day"
+	PreviousWeekPool PoolKind = "previous_week"
+	PreviousMonthPool PoolKind = "previous_month"
+	MidnightOpenPool PoolKind = "midnight_open"
+	NYOpenPool PoolKind = "ny_open"
+	OpeningRangePool PoolKind = "opening_range"
+	EqualHighsPool PoolKind = "equal_highs"
+	EqualLowsPool PoolKind = "equal_lows"
+)
+
+// PoolKinds lists every pool kind, for validating configs.
+var PoolKinds = []PoolKind{SessionPool, HigherTimeframePool, PreviousDayPool, PreviousWeekPool, PreviousMonthPool, MidnightOpenPool, NYOpenPool, OpeningRangePool, EqualHighsPool, EqualLowsPool}
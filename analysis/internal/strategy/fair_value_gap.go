@@ -24,12 +24,30 @@ type FairValueGap struct {
 	State				GapStatus
 	UnfilledPrice 		float64
 	LastAffectedCandle 	*candle.Candle
+	InversionCandle 	*candle.Candle
 }
 
 func (gap *FairValueGap) Age(c *candle.Candle) (int, error) {
 	return gap.Candle.Age(c)
 }
 
+func (gap FairValueGap) Bounds() (float64, float64) {
+	return math.Min(gap.StartPrice, gap.EndPrice), math.Max(gap.StartPrice, gap.EndPrice)
+}
+
+func (gap FairValueGap) Bias() Direction {
+	return gap.Direction
+}
+
+func (gap FairValueGap) Origin() *candle.Candle {
+	return gap.Candle
+}
+
+// Active reports whether the gap is still open or partially filled.
+func (gap FairValueGap) Active() bool {
+	return gap.State == GapOpen || gap.State == GapPartiallyFilled
+}
+
 func (gap *FairValueGap) Width() int {
 	width, err := gap.Candle.Age(gap.LastAffectedCandle)
 	if err != nil {
@@ -50,6 +68,7 @@ func (gap *FairValueGap) processCandle(c *candle.Candle) {
 			gap.UnfilledPrice = math.Max(c.Low, gap.EndPrice)
 			if c.Close < gap.StartPrice {
 				gap.State = GapInversed
+				gap.InversionCandle = c
 			} else {
 				gap.State = GapPartiallyFilled
 			}
@@ -60,6 +79,7 @@ func (gap *FairValueGap) processCandle(c *candle.Candle) {
 			gap.UnfilledPrice = math.Min(c.High, gap.EndPrice)
 			if c.Close > gap.StartPrice {
 				gap.State = GapInversed
+				gap.InversionCandle = c
 			} else {
 				gap.State = GapPartiallyFilled
 			}
@@ -68,9 +88,22 @@ func (gap *FairValueGap) processCandle(c *candle.Candle) {
 	}
 }
 
+// BalancedPriceRange is where a gap overlaps an earlier, still active gap
+// in the other direction. It takes the direction of the newer gap.
+type BalancedPriceRange struct {
+	PriceZone
+	// Gaps are the earlier and newer gaps that overlap.
+	Gaps [2]FairValueGap
+}
+
+// maxGaps is how many gaps, and how many balanced price ranges, a
+// GapManager keeps; the oldest are dropped first.
+const maxGaps = 500
+
 type GapManager struct {
 	candles  	[]candle.Candle
 	gaps		[]FairValueGap
+	ranges		[]BalancedPriceRange
 }
 
 func (gm *GapManager) ProcessCandle(c candle.Candle) {
@@ -83,6 +116,9 @@ func (gm *GapManager) ProcessCandle(c candle.Candle) {
 	for i := range gm.gaps {
       gm.gaps[i].processCandle(&c)
 	}
+	for i := range gm.ranges {
+		gm.ranges[i].processCandle(&c)
+	}
 }
 
 func (gm *GapManager) addGapIfExists() {
@@ -101,7 +137,8 @@ func (gm *GapManager) addGapIfExists() {
 			State: GapOpen,
 		}
 		// log.Printf("Adding FvG at %s: %+v", gap.Candle.Timestamp.Format(time.RFC3339), gap)
-		gm.gaps = append(gm.gaps, gap)
+		gm.addRanges(gap)
+		gm.gaps = keepLast(append(gm.gaps, gap), maxGaps)
 	} else if gm.candles[0].Low > gm.candles[2].High {
 		gap := FairValueGap{
 			Direction: Sellside,
@@ -113,10 +150,45 @@ func (gm *GapManager) addGapIfExists() {
 			State: GapOpen,
 		}
 		// log.Printf("Adding FvG at %s: %+v", gap.Candle.Timestamp.Format(time.RFC3339), gap)
-		gm.gaps = append(gm.gaps, gap)
+		gm.addRanges(gap)
+		gm.gaps = keepLast(append(gm.gaps, gap), maxGaps)
 	}
 }
 
+// addRanges adds a balanced price range for every active gap in the other
+// direction that gap overlaps.
+func (gm *GapManager) addRanges(gap FairValueGap) {
+	low, high := gap.Bounds()
+	for _, other := range gm.gaps {
+		if other.Direction == gap.Direction || !other.Active() {
+			continue
+		}
+		otherLow, otherHigh := other.Bounds()
+		overlapLow, overlapHigh := math.Max(low, otherLow), math.Min(high, otherHigh)
+		if overlapLow >= overlapHigh {
+			continue
+		}
+		gm.ranges = append(gm.ranges, BalancedPriceRange{
+			PriceZone: PriceZone{
+				Direction:  gap.Direction,
+				Low:        overlapLow,
+				High:       overlapHigh,
+				Candle:     gap.Candle,
+				FormCandle: &gm.candles[2],
+				State:      ZoneActive,
+			},
+			Gaps: [2]FairValueGap{other, gap},
+		})
+	}
+	gm.ranges = keepLast(gm.ranges, maxGaps)
+}
+
+// Gaps returns the gaps tracked since the manager was last reset, up to
+// maxGaps of the newest.
+func (gm *GapManager) Gaps() []FairValueGap {
+	return gm.gaps
+}
+
 func (gm * GapManager) GetInverses(c *candle.Candle, maxAge int, maxWidth int) ([]FairValueGap, error) {
 	if maxAge < 0 {
 		maxAge = math.MaxInt
@@ -143,3 +215,15 @@ func (gm * GapManager) GetInverses(c *candle.Candle, maxAge int, maxWidth int) (
 
 	return gaps, nil
 }
+
+// BalancedRanges returns the balanced price ranges tracked since the
+// manager was last reset, up to maxGaps of the newest.
+func (gm *GapManager) BalancedRanges() []BalancedPriceRange {
+	return gm.ranges
+}
+
+// GetBalancedRanges returns the unbroken balanced price ranges formed within
+// maxAge bars of c, any age when maxAge is negative.
+func (gm *GapManager) GetBalancedRanges(c *candle.Candle, maxAge int) ([]BalancedPriceRange, error) {
+	return activeWithin(gm.ranges, c, maxAge)
+}
@@ -0,0 +1,86 @@
+package strategy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// HigherTimeframe tracks fair value gaps, liquidity pools and structure on
+// bars aggregated from a strategy's base candles. Gaps and swings form on the
+// higher timeframe's bars; the high and low of every closed bar become pools
+// that base candles can raid, so a daily timeframe gives the previous day's
+// high and low. Each symbol is tracked separately.
+type HigherTimeframe struct {
+	Timeframe candle.Timeframe
+	Symbols   map[string]*Levels
+
+	location  *time.Location
+	structure StructureParams
+}
+
+// Levels is what a HigherTimeframe tracks for one symbol.
+type Levels struct {
+	Gaps      GapManager
+	Pools     LiquidityPoolManager
+	Structure StructureManager
+	Blocks    BlockManager
+
+	aggregator *Aggregator
+}
+
+func NewHigherTimeframe(timeframe candle.Timeframe, location *time.Location, structure StructureParams) *HigherTimeframe {
+	return &HigherTimeframe{
+		Timeframe: timeframe,
+		Symbols:   make(map[string]*Levels),
+		location:  location,
+		structure: structure,
+	}
+}
+
+// Levels returns the levels tracked for symbol, creating them on first use.
+func (h *HigherTimeframe) Levels(symbol string) *Levels {
+	levels, ok := h.Symbols[symbol]
+	if !ok {
+		levels = &Levels{
+			Structure:  NewStructureManager(h.structure),
+			aggregator: NewAggregator(h.Timeframe, h.location),
+		}
+		h.Symbols[symbol] = levels
+	}
+	return levels
+}
+
+// ProcessCandle adds a base candle. Bars that close are processed before the
+// candle raids any pools, except that a bar the candle completes is only
+// added after, so the candle that made a bar's high does not also raid it.
+func (h *HigherTimeframe) ProcessCandle(c candle.Candle) {
+	levels := h.Levels(c.Symbol)
+
+	closed := levels.aggregator.Add(c)
+	var completed []candle.Candle
+	for _, bar := range closed {
+		if start, _ := levels.aggregator.Bounds(c.Timestamp); bar.Timestamp.Equal(start) {
+			completed = append(completed, bar)
+			continue
+		}
+		h.closeBar(levels, bar)
+	}
+
+	levels.Pools.UpdateLPs(c)
+	for _, bar := range completed {
+		h.closeBar(levels, bar)
+	}
+}
+
+func (h *HigherTimeframe) closeBar(levels *Levels, bar candle.Candle) {
+	levels.Gaps.ProcessCandle(bar)
+	levels.Structure.ProcessCandle(bar)
+	levels.Blocks.ProcessCandle(bar, &levels.Structure)
+	// The base candles have already raided whatever the bar traded through.
+	levels.Pools.track(
+		LiquidityPool{Price: bar.High, Direction: Buyside, Candle: &bar, Name: fmt.Sprintf("%s High", h.Timeframe), Kind: HigherTimeframePool},
+		LiquidityPool{Price: bar.Low, Direction: Sellside, Candle: &bar, Name: fmt.Sprintf("%s Low", h.Timeframe), Kind: HigherTimeframePool},
+	)
+}
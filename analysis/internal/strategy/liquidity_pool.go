@@ -11,6 +11,7 @@ type LiquidityPool struct {
 	Direction 	Direction
 	Candle 		*candle.Candle
 	Name		string
+	Kind		PoolKind
 
 	timeRaided	time.Time
 	RaidCandle	*candle.Candle
@@ -25,6 +26,10 @@ func (lp *LiquidityPool) SetRaided(c candle.Candle) {
 	lp.RaidCandle = &c
 }
 
+// maxPools is how many active and how many raided pools a
+// LiquidityPoolManager keeps; the oldest of each are dropped first.
+const maxPools = 500
+
 type LiquidityPoolManager struct {
 	activePools []LiquidityPool
 	raidedPools []LiquidityPool
@@ -48,12 +53,24 @@ func (lpm *LiquidityPoolManager) UpdateLPs(candle candle.Candle) {
 			lpm.raidedPools = append(lpm.raidedPools, curPool)
 		}
 	}
+	lpm.raidedPools = keepLast(lpm.raidedPools, maxPools)
 }
 
+// AddLP tracks a new pool. Pools without a source candle, such as the low of
+// a session with no bars, are ignored.
 func (lpm *LiquidityPoolManager) AddLP(lp LiquidityPool) {
+	if lp.Candle == nil || lp.Candle.Timestamp.IsZero() {
+		return
+	}
 	lpm.UpdateLPs(*lp.Candle)
 
-	lpm.activePools = append(lpm.activePools, lp)
+	lpm.activePools = keepLast(append(lpm.activePools, lp), maxPools)
+}
+
+// track adds pools without first raiding the active pools with their source
+// candles, for pools whose candles price has already traded through.
+func (lpm *LiquidityPoolManager) track(pools ...LiquidityPool) {
+	lpm.activePools = keepLast(append(lpm.activePools, pools...), maxPools)
 }
 
 func (lpm *LiquidityPoolManager) GetPools(isActive bool) []LiquidityPool {
@@ -0,0 +1,175 @@
+package strategy
+
+import (
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+type BlockKind string
+
+const (
+	// OrderBlock is the last opposing candle before a displacement leg that
+	// broke structure.
+	OrderBlock BlockKind = "order_block"
+	// BreakerBlock is a broken order block whose candle had swept the swing
+	// before it, now expected to hold from the other side.
+	BreakerBlock BlockKind = "breaker"
+	// MitigationBlock is a broken order block that failed without sweeping
+	// the swing before it.
+	MitigationBlock BlockKind = "mitigation_block"
+)
+
+// blockLookback is how many candles before a displacement leg are searched
+// for its order block.
+const blockLookback = 50
+
+// maxBlocks is how many blocks a BlockManager keeps, broken ones included;
+// the oldest are dropped first.
+const maxBlocks = 500
+
+// Block is an order block, breaker or mitigation block spanning the full
+// range of its candle.
+type Block struct {
+	PriceZone
+	Kind BlockKind
+	// Swept reports whether the block's candle traded beyond the swing
+	// before it, which decides what it becomes once broken.
+	Swept bool
+}
+
+// BlockManager finds order blocks from structure breaks made with
+// displacement and turns broken order blocks into breakers and mitigation
+// blocks.
+type BlockManager struct {
+	candles []candle.Candle
+	blocks  []Block
+}
+
+// ProcessCandle adds c, which structure must already have processed.
+func (bm *BlockManager) ProcessCandle(c candle.Candle, structure *StructureManager) {
+	bm.candles = append(bm.candles, c)
+	if len(bm.candles) > blockLookback {
+		bm.candles = bm.candles[1:]
+	}
+
+	var flipped []Block
+	for i := range bm.blocks {
+		block := &bm.blocks[i]
+		if !block.processCandle(&c) || block.Kind != OrderBlock {
+			continue
+		}
+		kind := MitigationBlock
+		if block.Swept {
+			kind = BreakerBlock
+		}
+		flipped = append(flipped, Block{
+			PriceZone: PriceZone{
+				Direction:  opposite(block.Direction),
+				Low:        block.Low,
+				High:       block.High,
+				Candle:     block.Candle,
+				FormCandle: block.BreakCandle,
+				State:      ZoneActive,
+			},
+			Kind: kind,
+		})
+	}
+	bm.blocks = keepLast(append(bm.blocks, flipped...), maxBlocks)
+
+	breaks := structure.Breaks()
+	for i := len(breaks) - 1; i >= 0 && breaks[i].Candle.Timestamp.Equal(c.Timestamp); i-- {
+		if breaks[i].Displacement != nil {
+			bm.addOrderBlock(breaks[i], structure.Swings())
+		}
+	}
+}
+
+// addOrderBlock adds the last candle closing against brk's direction before
+// its displacement leg began.
+func (bm *BlockManager) addOrderBlock(brk StructureBreak, swings []SwingPoint) {
+	start := brk.Displacement.StartCandle.Timestamp
+	for i := len(bm.candles) - 1; i >= 0; i-- {
+		c := bm.candles[i]
+		if !c.Timestamp.Before(start) {
+			continue
+		}
+		if (brk.Direction == Buyside && c.Close >= c.Open) || (brk.Direction == Sellside && c.Close <= c.Open) {
+			continue
+		}
+
+		for _, block := range bm.blocks {
+			if block.Kind == OrderBlock && block.Candle.Timestamp.Equal(c.Timestamp) {
+				return
+			}
+		}
+		bm.blocks = append(bm.blocks, Block{
+			PriceZone: PriceZone{
+				Direction:  brk.Direction,
+				Low:        c.Low,
+				High:       c.High,
+				Candle:     &c,
+				FormCandle: brk.Candle,
+				State:      ZoneActive,
+			},
+			Kind:  OrderBlock,
+			Swept: sweeps(c, brk.Direction, swings),
+		})
+		bm.blocks = keepLast(bm.blocks, maxBlocks)
+		return
+	}
+}
+
+// sweeps reports whether c traded beyond the last swing on its side that
+// formed before it: below a swing low for a bullish block, above a swing
+// high for a bearish one.
+func sweeps(c candle.Candle, direction Direction, swings []SwingPoint) bool {
+	for i := len(swings) - 1; i >= 0; i-- {
+		swing := swings[i]
+		if swing.Direction == direction || !swing.Candle.Timestamp.Before(c.Timestamp) {
+			continue
+		}
+		if direction == Buyside {
+			return c.Low < swing.Price
+		}
+		return c.High > swing.Price
+	}
+	return false
+}
+
+func opposite(direction Direction) Direction {
+	if direction == Buyside {
+		return Sellside
+	}
+	return Buyside
+}
+
+// Blocks returns the blocks kept, in the order they formed.
+func (bm *BlockManager) Blocks() []Block {
+	return bm.blocks
+}
+
+// GetOrderBlocks returns the unbroken order blocks formed within maxAge
+// bars of c, any age when maxAge is negative.
+func (bm *BlockManager) GetOrderBlocks(c *candle.Candle, maxAge int) ([]Block, error) {
+	return activeWithin(bm.ofKind(OrderBlock), c, maxAge)
+}
+
+// GetBreakers returns the unbroken breakers formed within maxAge bars of c.
+func (bm *BlockManager) GetBreakers(c *candle.Candle, maxAge int) ([]Block, error) {
+	return activeWithin(bm.ofKind(BreakerBlock), c, maxAge)
+}
+
+// GetMitigationBlocks returns the unbroken mitigation blocks formed within
+// maxAge bars of c.
+func (bm *BlockManager) GetMitigationBlocks(c *candle.Candle, maxAge int) ([]Block, error) {
+	return activeWithin(bm.ofKind(MitigationBlock), c, maxAge)
+}
+
+func (bm *BlockManager) ofKind(kind BlockKind) []Block {
+	var blocks []Block
+	for _, block := range bm.blocks {
+		if block.Kind == kind {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
@@ -0,0 +1,111 @@
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// IFVGParams tunes the raid plus inverse fair value gap setup.
+type IFVGParams struct {
+	// MaxRaidAge is how many bars after a raid an inverse may still trigger.
+	MaxRaidAge int `json:"max_raid_age"`
+	// MaxInverseWidth is the widest gap, in bars, that counts as an inverse.
+	MaxInverseWidth int `json:"max_inverse_width"`
+	// RMultiple places the target at this many times the stop distance.
+	RMultiple float64 `json:"r_multiple"`
+	// CancelAfter cancels an unfilled order this long after the signal.
+	CancelAfter Duration `json:"cancel_after"`
+	// RaidPools limits the pools whose raids can trigger a setup to these
+	// kinds, any kind when empty.
+	RaidPools []PoolKind `json:"raid_pools,omitempty"`
+}
+
+func DefaultIFVGParams() IFVGParams {
+	return IFVGParams{
+		MaxRaidAge:      10,
+		MaxInverseWidth: 20,
+		RMultiple:       1,
+		CancelAfter:     Duration(120 * time.Minute),
+	}
+}
+
+func (p IFVGParams) Validate() error {
+	var errs []error
+	if p.MaxRaidAge < 0 {
+		errs = append(errs, fmt.Errorf("params.max_raid_age: must not be negative, got %d", p.MaxRaidAge))
+	}
+	if p.MaxInverseWidth < 0 {
+		errs = append(errs, fmt.Errorf("params.max_inverse_width: must not be negative, got %d", p.MaxInverseWidth))
+	}
+	if p.RMultiple <= 0 {
+		errs = append(errs, fmt.Errorf("params.r_multiple: must be positive, got %g", p.RMultiple))
+	}
+	if p.CancelAfter <= 0 {
+		errs = append(errs, errors.New("params.cancel_after: must be positive"))
+	}
+	for i, kind := range p.RaidPools {
+		if !slices.Contains(PoolKinds, kind) {
+			errs = append(errs, fmt.Errorf("params.raid_pools[%d]: unknown pool kind %q", i, kind))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// raids reports whether a raid of pool can trigger a setup.
+func (p IFVGParams) raids(pool LiquidityPool) bool {
+	return len(p.RaidPools) == 0 || slices.Contains(p.RaidPools, pool.Kind)
+}
+
+// Duration reads and writes a Go duration string such as "120m".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Clock is a time of day, read and written as "15:04".
+type Clock time.Duration
+
+// On returns the clock time on local's date, in local's location.
+func (c Clock) On(local time.Time) time.Time {
+	d := time.Duration(c)
+	return time.Date(local.Year(), local.Month(), local.Day(), int(d.Hours()), int(d.Minutes())%60, 0, 0, local.Location())
+}
+
+// Is reports whether local falls exactly on the clock time.
+func (c Clock) Is(local time.Time) bool {
+	return local.Equal(c.On(local))
+}
+
+func (c Clock) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Clock) UnmarshalText(text []byte) error {
+	parsed, err := time.Parse("15:04", string(text))
+	if err != nil {
+		return fmt.Errorf("invalid time of day %q, expected HH:MM", text)
+	}
+	*c = Clock(time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute)
+	return nil
+}
+
+func (c Clock) String() string {
+	d := time.Duration(c)
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,369 @@
+package strategy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mgordon34/gostonks/analysis/internal/instrument"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// PoolGenerator finds liquidity pools in a stream of base candles. It sees
+// every candle, for every symbol, and returns the pools that became known
+// with it; price is checked against them starting with that candle.
+type PoolGenerator interface {
+	ProcessCandle(c candle.Candle) []LiquidityPool
+}
+
+// PoolDefinition configures one pool generator in a strategy definition.
+type PoolDefinition struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// PoolFactory builds a generator from its definition. Times of day are read
+// in location.
+type PoolFactory func(def PoolDefinition, location *time.Location) (PoolGenerator, error)
+
+var poolRegistry = map[string]PoolFactory{}
+
+// RegisterPool makes a pool generator available to config files under kind.
+func RegisterPool(kind string, factory PoolFactory) {
+	if _, ok := poolRegistry[kind]; ok {
+		panic(fmt.Sprintf("pool type %q registered twice", kind))
+	}
+	poolRegistry[kind] = factory
+}
+
+// PoolTypes returns the registered pool generator types in sorted order.
+func PoolTypes() []string {
+	types := make([]string, 0, len(poolRegistry))
+	for kind := range poolRegistry {
+		types = append(types, kind)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewPoolGenerator builds def with the factory registered for its type.
+func NewPoolGenerator(def PoolDefinition, location *time.Location) (PoolGenerator, error) {
+	factory, ok := poolRegistry[def.Type]
+	if !ok {
+		return nil, fmt.Errorf("type: unknown pool type %q", def.Type)
+	}
+	return factory(def, location)
+}
+
+// periodGenerator adds the high and low of each completed day, week or month
+// as pools once the next period opens. A period is only used if the
+// generator saw it from its open.
+type periodGenerator struct {
+	kind   PoolKind
+	name   string
+	open   func(time.Time) time.Time
+	ranges map[string]*periodRange
+}
+
+type periodRange struct {
+	open      time.Time
+	high, low candle.Candle
+	whole     bool
+}
+
+func newPeriodGenerator(kind PoolKind, name string, open func(time.Time) time.Time) *periodGenerator {
+	return &periodGenerator{kind: kind, name: name, open: open, ranges: make(map[string]*periodRange)}
+}
+
+func (g *periodGenerator) ProcessCandle(c candle.Candle) []LiquidityPool {
+	open := g.open(c.Timestamp)
+	current, ok := g.ranges[c.Symbol]
+	if ok && current.open.Equal(open) {
+		if c.High > current.high.High {
+			current.high = c
+		}
+		if c.Low < current.low.Low {
+			current.low = c
+		}
+		return nil
+	}
+
+	g.ranges[c.Symbol] = &periodRange{open: open, high: c, low: c, whole: ok}
+	if !ok || !current.whole {
+		return nil
+	}
+	return []LiquidityPool{
+		{Price: current.high.High, Direction: Buyside, Candle: &current.high, Name: g.name + " High", Kind: g.kind},
+		{Price: current.low.Low, Direction: Sellside, Candle: &current.low, Name: g.name + " Low", Kind: g.kind},
+	}
+}
+
+// openGenerator turns the open of the candle at a time of day into a pool
+// once price trades entirely away from it: below the open when price left
+// upwards, above it when price left downwards.
+type openGenerator struct {
+	kind     PoolKind
+	name     string
+	at       Clock
+	location *time.Location
+	pending  map[string]candle.Candle
+}
+
+func (g *openGenerator) ProcessCandle(c candle.Candle) []LiquidityPool {
+	if g.at.Is(c.Timestamp.In(g.location)) {
+		g.pending[c.Symbol] = c
+		return nil
+	}
+
+	open, ok := g.pending[c.Symbol]
+	if !ok {
+		return nil
+	}
+	var direction Direction
+	switch {
+	case c.Low > open.Open:
+		direction = Sellside
+	case c.High < open.Open:
+		direction = Buyside
+	default:
+		return nil
+	}
+	delete(g.pending, c.Symbol)
+	return []LiquidityPool{{Price: open.Open, Direction: direction, Candle: &open, Name: g.name, Kind: g.kind}}
+}
+
+// openingRangeGenerator adds the high and low of the first Duration of
+// trading from Start as pools when the range closes.
+type openingRangeGenerator struct {
+	params   OpeningRangeParams
+	location *time.Location
+	ranges   map[string]*periodRange
+}
+
+// OpeningRangeParams sets when the opening range starts and how long it runs.
+type OpeningRangeParams struct {
+	Start    Clock    `json:"start"`
+	Duration Duration `json:"duration"`
+}
+
+func (g *openingRangeGenerator) ProcessCandle(c candle.Candle) []LiquidityPool {
+	start := g.params.Start.On(c.Timestamp.In(g.location))
+	end := start.Add(time.Duration(g.params.Duration))
+	current := g.ranges[c.Symbol]
+
+	if !c.Timestamp.Before(start) && c.Timestamp.Before(end) {
+		if current == nil || !current.open.Equal(start) {
+			// A range missing its first candle is incomplete.
+			g.ranges[c.Symbol] = &periodRange{open: start, high: c, low: c, whole: c.Timestamp.Equal(start)}
+			return nil
+		}
+		if c.High > current.high.High {
+			current.high = c
+		}
+		if c.Low < current.low.Low {
+			current.low = c
+		}
+		return nil
+	}
+
+	if current == nil || !current.open.Equal(start) || c.Timestamp.Before(end) {
+		return nil
+	}
+	delete(g.ranges, c.Symbol)
+	if !current.whole {
+		return nil
+	}
+	return []LiquidityPool{
+		{Price: current.high.High, Direction: Buyside, Candle: &current.high, Name: "Opening Range High", Kind: OpeningRangePool},
+		{Price: current.low.Low, Direction: Sellside, Candle: &current.low, Name: "Opening Range Low", Kind: OpeningRangePool},
+	}
+}
+
+// EqualLevelsParams tunes equal high and low detection.
+type EqualLevelsParams struct {
+	// ToleranceTicks is how far apart two swings may be and still be equal.
+	ToleranceTicks int `json:"tolerance_ticks"`
+	// SwingBars is how many bars either side of a swing must not exceed it.
+	SwingBars int `json:"swing_bars"`
+	// MaxAge forgets swings older than this.
+	MaxAge Duration `json:"max_age"`
+}
+
+func (p EqualLevelsParams) Validate() error {
+	var errs []error
+	if p.ToleranceTicks < 0 {
+		errs = append(errs, fmt.Errorf("params.tolerance_ticks: must not be negative, got %d", p.ToleranceTicks))
+	}
+	if p.SwingBars <= 0 {
+		errs = append(errs, fmt.Errorf("params.swing_bars: must be positive, got %d", p.SwingBars))
+	}
+	if p.MaxAge <= 0 {
+		errs = append(errs, errors.New("params.max_age: must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// equalLevelsGenerator adds a pool when a swing high or low forms within the
+// tolerance of an earlier swing that price has not traded beyond since. The
+// pool sits at the more extreme of the two.
+type equalLevelsGenerator struct {
+	params EqualLevelsParams
+	series map[string]*swingSeries
+}
+
+type swingSeries struct {
+	swings      swingDetector
+	highs, lows []candle.Candle
+}
+
+func (g *equalLevelsGenerator) ProcessCandle(c candle.Candle) []LiquidityPool {
+	series, ok := g.series[c.Symbol]
+	if !ok {
+		series = &swingSeries{swings: swingDetector{left: g.params.SwingBars, right: g.params.SwingBars}}
+		g.series[c.Symbol] = series
+	}
+	tolerance := 0.0
+	if inst, ok := instrument.Lookup(c.Symbol); ok {
+		tolerance = float64(g.params.ToleranceTicks) * inst.TickSize
+	}
+	cutoff := c.Timestamp.Add(-time.Duration(g.params.MaxAge))
+
+	series.highs = unbroken(series.highs, func(s candle.Candle) bool {
+		return c.High <= s.High+tolerance && s.Timestamp.After(cutoff)
+	})
+	series.lows = unbroken(series.lows, func(s candle.Candle) bool {
+		return c.Low >= s.Low-tolerance && s.Timestamp.After(cutoff)
+	})
+
+	var pools []LiquidityPool
+	high, low := series.swings.add(c)
+	if high != nil {
+		if i := nearest(series.highs, high.Price, tolerance, func(s candle.Candle) float64 { return s.High }); i >= 0 {
+			pools = append(pools, LiquidityPool{Price: max(high.Price, series.highs[i].High), Direction: Buyside, Candle: high.Candle, Name: "Equal Highs", Kind: EqualHighsPool})
+			series.highs = append(series.highs[:i], series.highs[i+1:]...)
+		}
+		series.highs = append(series.highs, *high.Candle)
+	}
+	if low != nil {
+		if i := nearest(series.lows, low.Price, tolerance, func(s candle.Candle) float64 { return s.Low }); i >= 0 {
+			pools = append(pools, LiquidityPool{Price: min(low.Price, series.lows[i].Low), Direction: Sellside, Candle: low.Candle, Name: "Equal Lows", Kind: EqualLowsPool})
+			series.lows = append(series.lows[:i], series.lows[i+1:]...)
+		}
+		series.lows = append(series.lows, *low.Candle)
+	}
+	return pools
+}
+
+// nearest returns the index of the swing closest to price within tolerance,
+// or -1.
+func nearest(swings []candle.Candle, price, tolerance float64, level func(candle.Candle) float64) int {
+	best, bestDistance := -1, math.Inf(1)
+	for i, s := range swings {
+		if distance := math.Abs(level(s) - price); distance <= tolerance && distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return best
+}
+
+// unbroken keeps the swings that keep reports true for, in order.
+func unbroken(swings []candle.Candle, keep func(candle.Candle) bool) []candle.Candle {
+	kept := swings[:0]
+	for _, s := range swings {
+		if keep(s) {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// sessionDay returns the 18:00 New York open of the futures session that t
+// trades in.
+func sessionDay(t time.Time, location *time.Location) time.Time {
+	local := t.In(location)
+	open := time.Date(local.Year(), local.Month(), local.Day(), 18, 0, 0, 0, location)
+	if open.After(local) {
+		open = open.AddDate(0, 0, -1)
+	}
+	return open
+}
+
+// sessionWeek returns the Sunday evening open of the week t trades in.
+func sessionWeek(t time.Time, location *time.Location) time.Time {
+	open := sessionDay(t, location)
+	return open.AddDate(0, 0, -int(open.Weekday()))
+}
+
+// sessionMonth returns the open of the first session of the month t trades
+// in, the evening before the first of the month.
+func sessionMonth(t time.Time, location *time.Location) time.Time {
+	tradeDate := sessionDay(t, location).AddDate(0, 0, 1)
+	return time.Date(tradeDate.Year(), tradeDate.Month(), 0, 18, 0, 0, 0, location)
+}
+
+func init() {
+	periods := []struct {
+		kind PoolKind
+		name string
+		open func(time.Time, *time.Location) time.Time
+	}{
+		{PreviousDayPool, "Previous Day", sessionDay},
+		{PreviousWeekPool, "Previous Week", sessionWeek},
+		{PreviousMonthPool, "Previous Month", sessionMonth},
+	}
+	for _, period := range periods {
+		RegisterPool(string(period.kind), func(def PoolDefinition, location *time.Location) (PoolGenerator, error) {
+			if err := decodeParams(def.Params, &struct{}{}); err != nil {
+				return nil, err
+			}
+			return newPeriodGenerator(period.kind, period.name, func(t time.Time) time.Time {
+				return period.open(t, location).UTC()
+			}), nil
+		})
+	}
+
+	opens := []struct {
+		kind PoolKind
+		name string
+		at   Clock
+	}{
+		{MidnightOpenPool, "Midnight Open", Clock(0)},
+		{NYOpenPool, "NY Open", Clock(9*time.Hour + 30*time.Minute)},
+	}
+	for _, open := range opens {
+		RegisterPool(string(open.kind), func(def PoolDefinition, location *time.Location) (PoolGenerator, error) {
+			params := struct {
+				At Clock `json:"at"`
+			}{At: open.at}
+			if err := decodeParams(def.Params, &params); err != nil {
+				return nil, err
+			}
+			return &openGenerator{kind: open.kind, name: open.name, at: params.At, location: location, pending: make(map[string]candle.Candle)}, nil
+		})
+	}
+
+	RegisterPool(string(OpeningRangePool), func(def PoolDefinition, location *time.Location) (PoolGenerator, error) {
+		params := OpeningRangeParams{Start: Clock(9*time.Hour + 30*time.Minute), Duration: Duration(15 * time.Minute)}
+		if err := decodeParams(def.Params, &params); err != nil {
+			return nil, err
+		}
+		if params.Duration <= 0 {
+			return nil, errors.New("params.duration: must be positive")
+		}
+		return &openingRangeGenerator{params: params, location: location, ranges: make(map[string]*periodRange)}, nil
+	})
+
+	RegisterPool("equal_levels", func(def PoolDefinition, location *time.Location) (PoolGenerator, error) {
+		params := EqualLevelsParams{ToleranceTicks: 2, SwingBars: 2, MaxAge: Duration(24 * time.Hour)}
+		if err := decodeParams(def.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := params.Validate(); err != nil {
+			return nil, err
+		}
+		return &equalLevelsGenerator{params: params, series: make(map[string]*swingSeries)}, nil
+	})
+}
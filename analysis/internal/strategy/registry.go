@@ -0,0 +1,195 @@
+package strategy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// Definition describes one strategy instance, as read from a config file.
+// Params holds the strategy-specific settings for the factory of Type.
+type Definition struct {
+	Type      string           `json:"type"`
+	Name      string           `json:"name"`
+	Market    string           `json:"market"`
+	Symbols   []string         `json:"symbols"`
+	Timeframe candle.Timeframe `json:"timeframe"`
+	// HigherTimeframes are aggregated from Timeframe candles for context,
+	// such as 5m and 1h gaps or the previous day's high and low.
+	HigherTimeframes []candle.Timeframe `json:"higher_timeframes,omitempty"`
+	// Pools adds liquidity pools from generators alongside the session
+	// highs and lows.
+	Pools []PoolDefinition `json:"pools,omitempty"`
+	// Structure overrides the swing and displacement settings of the
+	// strategy's structure trackers.
+	Structure json.RawMessage `json:"structure,omitempty"`
+	Lookback  int             `json:"lookback"`
+	Params    json.RawMessage `json:"params,omitempty"`
+}
+
+// Factory builds a strategy from its definition, returning an error when the
+// params are invalid for that strategy type.
+type Factory func(ctx context.Context, repo candle.Repository, def Definition) (Strategy, error)
+
+var registry = map[string]Factory{}
+
+// Register makes a strategy type available to config files under kind.
+func Register(kind string, factory Factory) {
+	if _, ok := registry[kind]; ok {
+		panic(fmt.Sprintf("strategy type %q registered twice", kind))
+	}
+	registry[kind] = factory
+}
+
+// Types returns the registered strategy types in sorted order.
+func Types() []string {
+	types := make([]string, 0, len(registry))
+	for kind := range registry {
+		types = append(types, kind)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New validates def and builds it with the factory registered for its type.
+func New(ctx context.Context, repo candle.Repository, def Definition) (Strategy, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return registry[def.Type](ctx, repo, def)
+}
+
+// Validate checks the fields every strategy type needs, reporting all of the
+// problems at once.
+func (d Definition) Validate() error {
+	var errs []error
+	if d.Type == "" {
+		errs = append(errs, fmt.Errorf("type: required, one of %s", strings.Join(Types(), ", ")))
+	} else if _, ok := registry[d.Type]; !ok {
+		errs = append(errs, fmt.Errorf("type: unknown strategy type %q, one of %s", d.Type, strings.Join(Types(), ", ")))
+	}
+	if d.Name == "" {
+		errs = append(errs, errors.New("name: required"))
+	}
+	if d.Market == "" {
+		errs = append(errs, errors.New("market: required"))
+	}
+	if len(d.Symbols) == 0 {
+		errs = append(errs, errors.New("symbols: at least one symbol is required"))
+	}
+	for i, symbol := range d.Symbols {
+		if strings.TrimSpace(symbol) == "" {
+			errs = append(errs, fmt.Errorf("symbols[%d]: empty symbol", i))
+		}
+	}
+	for i, higher := range d.HigherTimeframes {
+		switch {
+		case d.Timeframe.IsZero():
+			errs = append(errs, fmt.Errorf("higher_timeframes[%d]: a base timeframe is required to aggregate from", i))
+		case higher.Duration() <= d.Timeframe.Duration() || higher.Duration()%d.Timeframe.Duration() != 0:
+			errs = append(errs, fmt.Errorf("higher_timeframes[%d]: %s is not a multiple of the %s timeframe", i, higher, d.Timeframe))
+		case (higher.Unit == candle.Day || higher.Unit == candle.Week) && higher.Count != 1:
+			errs = append(errs, fmt.Errorf("higher_timeframes[%d]: only 1d and 1w session bars are supported, got %s", i, higher))
+		}
+	}
+	for i, pool := range d.Pools {
+		if _, ok := poolRegistry[pool.Type]; !ok {
+			errs = append(errs, fmt.Errorf("pools[%d].type: unknown pool type %q, one of %s", i, pool.Type, strings.Join(PoolTypes(), ", ")))
+		}
+	}
+	if _, err := d.StructureParams(); err != nil {
+		errs = append(errs, err)
+	}
+	if d.Lookback <= 0 {
+		errs = append(errs, fmt.Errorf("lookback: must be positive, got %d", d.Lookback))
+	}
+	return errors.Join(errs...)
+}
+
+// StructureParams returns the default structure settings overlaid with
+// Structure.
+func (d Definition) StructureParams() (StructureParams, error) {
+	params := DefaultStructureParams()
+	if err := decode(d.Structure, &params); err != nil {
+		return params, fmt.Errorf("structure: %w", err)
+	}
+	return params, params.Validate()
+}
+
+// decodeParams overlays raw onto params, which should hold the defaults,
+// rejecting fields the strategy does not know about.
+func decodeParams(raw json.RawMessage, params any) error {
+	if err := decode(raw, params); err != nil {
+		return fmt.Errorf("params: %w", err)
+	}
+	return nil
+}
+
+func decode(raw json.RawMessage, v any) error {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// PrefixErrors flattens err, which may be joined, and prefixes each error
+// with path, so nested config problems report where they are.
+func PrefixErrors(path string, err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{fmt.Errorf("%s.%w", path, err)}
+	}
+
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, PrefixErrors(path, e)...)
+	}
+	return errs
+}
+
+func init() {
+	Register("ifvg", func(ctx context.Context, repo candle.Repository, def Definition) (Strategy, error) {
+		params := DefaultIFVGParams()
+		if err := decodeParams(def.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := params.Validate(); err != nil {
+			return nil, err
+		}
+		structure, err := def.StructureParams()
+		if err != nil {
+			return nil, err
+		}
+		strategy := NewBarStrategy(ctx, repo, def.Name, def.Market, def.Symbols, def.Lookback)
+		strategy.Timeframe = def.Timeframe
+		strategy.Params = params
+		strategy.StructureParams = structure
+		for _, higher := range def.HigherTimeframes {
+			strategy.Higher = append(strategy.Higher, NewHigherTimeframe(higher, strategy.Location, structure))
+		}
+		var errs []error
+		for i, pool := range def.Pools {
+			generator, err := NewPoolGenerator(pool, strategy.Location)
+			if err != nil {
+				errs = append(errs, PrefixErrors(fmt.Sprintf("pools[%d]", i), err)...)
+				continue
+			}
+			strategy.Generators = append(strategy.Generators, generator)
+		}
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+		return strategy, nil
+	})
+}
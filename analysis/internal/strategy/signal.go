@@ -3,6 +3,7 @@ package strategy
 import "time"
 
 type Signal struct {
+	Symbol		string
 	Action		Action
 	Type 		OrderType
 	Price		float64
@@ -10,4 +11,7 @@ type Signal struct {
 	StopLoss	float64
 	Timestamp 	time.Time
 	CancelTime	time.Time
+
+	// Context explains why the signal fired.
+	Context		*SignalContext
 }
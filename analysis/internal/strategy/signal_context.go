@@ -0,0 +1,109 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// SetupRaidInverse is a liquidity pool raid confirmed by an inverted fair
+// value gap in the opposite direction.
+const SetupRaidInverse = "raid_ifvg"
+
+// SignalContext records what a strategy saw when it fired a signal so trades
+// can be audited and filtered by setup.
+type SignalContext struct {
+	Setup string       `json:"setup"`
+	Pool  *PoolContext `json:"pool,omitempty"`
+	Gap   *GapContext  `json:"gap,omitempty"`
+	Stop  StopContext  `json:"stop"`
+}
+
+// PoolContext is the liquidity pool a signal traded off.
+type PoolContext struct {
+	Name       string        `json:"name"`
+	Kind       PoolKind      `json:"kind,omitempty"`
+	Direction  Direction     `json:"direction"`
+	Price      float64       `json:"price"`
+	Candle     candle.Candle `json:"candle"`
+	RaidCandle candle.Candle `json:"raid_candle"`
+}
+
+// GapContext is the fair value gap that confirmed a signal.
+type GapContext struct {
+	Direction       Direction     `json:"direction"`
+	StartPrice      float64       `json:"start_price"`
+	EndPrice        float64       `json:"end_price"`
+	Candle          candle.Candle `json:"candle"`
+	InversionCandle candle.Candle `json:"inversion_candle"`
+}
+
+// StopContext explains where a signal's stop loss came from: the extreme
+// of Candle, the most extreme bar between From and To.
+type StopContext struct {
+	Method         string        `json:"method"`
+	Price          float64       `json:"price"`
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	Candle         candle.Candle `json:"candle"`
+	RiskPoints     float64       `json:"risk_points"`
+	TargetMultiple float64       `json:"target_multiple"`
+}
+
+func newPoolContext(pool LiquidityPool) *PoolContext {
+	ctx := &PoolContext{Name: pool.Name, Kind: pool.Kind, Direction: pool.Direction, Price: pool.Price}
+	if pool.Candle != nil {
+		ctx.Candle = *pool.Candle
+	}
+	if pool.RaidCandle != nil {
+		ctx.RaidCandle = *pool.RaidCandle
+	}
+	return ctx
+}
+
+func newGapContext(gap FairValueGap) *GapContext {
+	ctx := &GapContext{Direction: gap.Direction, StartPrice: gap.StartPrice, EndPrice: gap.EndPrice}
+	if gap.Candle != nil {
+		ctx.Candle = *gap.Candle
+	}
+	if gap.InversionCandle != nil {
+		ctx.InversionCandle = *gap.InversionCandle
+	}
+	return ctx
+}
+
+// raidInverseContext describes a raid_ifvg signal on c whose stop sits at
+// the extreme of slCandle between the raid and c.
+func raidInverseContext(raid LiquidityPool, inverse FairValueGap, slCandle candle.Candle, sl float64, c candle.Candle, targetMultiple float64) *SignalContext {
+	return &SignalContext{
+		Setup: SetupRaidInverse,
+		Pool:  newPoolContext(raid),
+		Gap:   newGapContext(inverse),
+		Stop: StopContext{
+			Method:         "raid_extreme",
+			Price:          sl,
+			From:           raid.RaidCandle.Timestamp,
+			To:             c.Timestamp,
+			Candle:         slCandle,
+			RiskPoints:     math.Abs(c.Close - sl),
+			TargetMultiple: targetMultiple,
+		},
+	}
+}
+
+func (ctx *SignalContext) String() string {
+	if ctx == nil {
+		return "<nil>"
+	}
+
+	s := ctx.Setup
+	if ctx.Pool != nil {
+		s += fmt.Sprintf(" %s %.2f raided %s", ctx.Pool.Name, ctx.Pool.Price, ctx.Pool.RaidCandle.Timestamp.Format("15:04"))
+	}
+	if ctx.Gap != nil {
+		s += fmt.Sprintf(", %s gap %.2f-%.2f inverted %s", ctx.Gap.Direction, ctx.Gap.StartPrice, ctx.Gap.EndPrice, ctx.Gap.InversionCandle.Timestamp.Format("15:04"))
+	}
+	return s + fmt.Sprintf(", stop %.2f from %s", ctx.Stop.Price, ctx.Stop.Method)
+}
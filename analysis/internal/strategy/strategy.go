@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"slices"
 	"time"
 
 	"github.com/mgordon34/gostonks/market/cmd/candle"
@@ -21,12 +22,32 @@ type BarStrategy struct {
 	Market   	string
 	Symbols  	[]string
 	Lookback 	int
-	Bars     	map[string]map[time.Time]candle.Candle
+	// Timeframe limits the strategy to candles of one timeframe, any
+	// timeframe when zero.
+	Timeframe	candle.Timeframe
+	Params		IFVGParams
+	// Higher tracks gaps and pools on timeframes aggregated from the base
+	// candles, updated before each base candle is processed.
+	Higher		[]*HigherTimeframe
+	// Generators add pools beyond the session highs and lows, kept per
+	// symbol in Generated. Active ones carry over when the day is
+	// initialized.
+	Generators	[]PoolGenerator
+	Generated	map[string]*LiquidityPoolManager
+	warmed		map[string]bool
+	// sessions holds the 09:30 open each symbol was last initialized for.
+	sessions	map[string]time.Time
+	Bars     	map[string]*BarBuffer
 	repo   		candle.Repository
 
 	Location 	*time.Location
 	Pools	 	LiquidityPoolManager
 	Gaps   		GapManager
+	// Structure follows each symbol's swings and breaks across days; it is
+	// not reset with the session pools and gaps.
+	StructureParams	StructureParams
+	Structure	map[string]*StructureManager
+	Blocks		map[string]*BlockManager
 }
 
 func NewBarStrategy(ctx context.Context, repo candle.Repository, name string, market string, symbols []string, lookback int) *BarStrategy {
@@ -41,13 +62,27 @@ func NewBarStrategy(ctx context.Context, repo candle.Repository, name string, ma
 		Market:   market,
 		Symbols:  symbols,
 		Lookback: lookback,
-		Bars:     make(map[string]map[time.Time]candle.Candle),
+		Params:   DefaultIFVGParams(),
+		Bars:     make(map[string]*BarBuffer),
+		Generated: make(map[string]*LiquidityPoolManager),
+		warmed:   make(map[string]bool),
+		sessions: make(map[string]time.Time),
+		StructureParams: DefaultStructureParams(),
+		Structure: make(map[string]*StructureManager),
+		Blocks:   make(map[string]*BlockManager),
 
 		Location: nyLocation,
 	}
 }
 
 func (b *BarStrategy) initializeDay(symbol string, timestamp time.Time) {
+	// Generated pools raided on earlier days are dropped; active ones are
+	// still current and carry over.
+	generated := b.generated(symbol)
+	carried := generated.GetPools(true)
+	*generated = LiquidityPoolManager{}
+	generated.track(carried...)
+
 	b.Pools = LiquidityPoolManager{}
 	b.Gaps = GapManager{}
 
@@ -65,62 +100,72 @@ func (b *BarStrategy) initializeDay(symbol string, timestamp time.Time) {
 	preMarketLow := b.getMinInRange(symbol, preMarketOpen, timestamp)
 	preMarketHigh := b.getMaxInRange(symbol, preMarketOpen, timestamp)
 
-	b.Pools.AddLP(LiquidityPool{Price: asiaLow.Low, Direction: Sellside, Candle: &asiaLow, Name: "Asia Low"})
-	b.Pools.AddLP(LiquidityPool{Price: asiaHigh.High, Direction: Buyside, Candle: &asiaHigh, Name: "Asia High"})
-	b.Pools.AddLP(LiquidityPool{Price: londonLow.Low, Direction: Sellside, Candle: &londonLow, Name: "London Low"})
-	b.Pools.AddLP(LiquidityPool{Price: londonHigh.High, Direction: Buyside, Candle: &londonHigh, Name: "London High"})
-	b.Pools.AddLP(LiquidityPool{Price: preMarketLow.Low, Direction: Sellside, Candle: &preMarketLow, Name: "Pre Market Low"})
-	b.Pools.AddLP(LiquidityPool{Price: preMarketHigh.High, Direction: Buyside, Candle: &preMarketHigh, Name: "Pre Market High"})
+	b.Pools.AddLP(LiquidityPool{Price: asiaLow.Low, Direction: Sellside, Candle: &asiaLow, Name: "Asia Low", Kind: SessionPool})
+	b.Pools.AddLP(LiquidityPool{Price: asiaHigh.High, Direction: Buyside, Candle: &asiaHigh, Name: "Asia High", Kind: SessionPool})
+	b.Pools.AddLP(LiquidityPool{Price: londonLow.Low, Direction: Sellside, Candle: &londonLow, Name: "London Low", Kind: SessionPool})
+	b.Pools.AddLP(LiquidityPool{Price: londonHigh.High, Direction: Buyside, Candle: &londonHigh, Name: "London High", Kind: SessionPool})
+	b.Pools.AddLP(LiquidityPool{Price: preMarketLow.Low, Direction: Sellside, Candle: &preMarketLow, Name: "Pre Market Low", Kind: SessionPool})
+	b.Pools.AddLP(LiquidityPool{Price: preMarketHigh.High, Direction: Buyside, Candle: &preMarketHigh, Name: "Pre Market High", Kind: SessionPool})
 
 	log.Printf("Active Pools: %v", b.Pools.GetPools(true))
 	log.Printf("Raided Pools: %v", b.Pools.GetPools(false))
 }
 
 func (b *BarStrategy) ProcessCandle(c candle.Candle) {
+	if !b.accepts(c) {
+		return
+	}
 	for _, symbol := range b.Symbols {
 		if c.Symbol == symbol {
-			if _, ok := b.Bars[c.Symbol]; !ok {
-				b.Bars[c.Symbol] = make(map[time.Time]candle.Candle)
-			}
-
-			ts := c.Timestamp.UTC().Truncate(time.Minute)
-			b.Bars[c.Symbol][ts] = c
+			b.bars(c.Symbol).Append(c)
 
 			if err := b.getNCandles(c); err != nil {
 				log.Println(err)
 				return
 			}
+			b.warm(c)
+			for _, higher := range b.Higher {
+				higher.ProcessCandle(c)
+			}
+			b.generatePools(c)
 
-			tsNY := c.Timestamp.In(b.Location)
-			if tsNY.Hour() == 9 && tsNY.Minute() == 30 {
+			if open, ok := b.sessionOpen(c); ok && !b.sessions[c.Symbol].Equal(open) {
 				log.Printf("Candle at 09:30 America/New_York for %s: %s", c.Symbol, c.Timestamp.Format("2006-01-02 15:04:05"))
-				b.initializeDay(c.Symbol, c.Timestamp)
+				b.sessions[c.Symbol] = open
+				b.initializeDay(c.Symbol, open)
 			}
 
 			b.Pools.UpdateLPs(c)
+			b.generated(c.Symbol).UpdateLPs(c)
 			b.Gaps.ProcessCandle(c)
+			b.processStructure(c)
 		}
 	}
 }
 
 func (b *BarStrategy) GenerateSignal(c candle.Candle) *Signal {
+	if !b.accepts(c) {
+		return nil
+	}
 	for _, symbol := range b.Symbols {
 		if c.Symbol != symbol {
 			continue
 		}
 
-		tsNY := c.Timestamp.In(b.Location)
-		startTime := time.Date(tsNY.Year(), tsNY.Month(), tsNY.Day(), 9, 30, 0, 0, b.Location)
-		endTime := time.Date(tsNY.Year(), tsNY.Month(), tsNY.Day(), 16, 00, 0, 0, b.Location)
-		if tsNY.Before(startTime) || !tsNY.Before(endTime) {
+		if !b.inSession(c) {
 			continue
 		}
 
-		raids := b.Pools.GetPools(false)
+		var raids []LiquidityPool
+		for _, raid := range b.raidedPools(c.Symbol) {
+			if b.Params.raids(raid) {
+				raids = append(raids, raid)
+			}
+		}
 		if len(raids) == 0 {
 			continue
 		}
-		inverses, err := b.Gaps.GetInverses(&c, 0, 20)
+		inverses, err := b.Gaps.GetInverses(&c, 0, b.Params.MaxInverseWidth)
 		if err != nil {
 			log.Fatalf("Error getting inverses: %v", err)
 		}
@@ -135,7 +180,7 @@ func (b *BarStrategy) GenerateSignal(c candle.Candle) *Signal {
 				log.Fatalf("Error getting raid width: %v", err)
 			}
 
-			if raidAge > 10 || raidWidth > math.MaxInt {
+			if raidAge > b.Params.MaxRaidAge || raidWidth > math.MaxInt {
 				continue
 			}
 
@@ -145,27 +190,33 @@ func (b *BarStrategy) GenerateSignal(c candle.Candle) *Signal {
 			}
 			for _, inverse := range inverses {
 				if raid.Direction == Buyside && inverse.Direction == Buyside && c.Close < raid.Price {
-					sl := b.getMaxInRange(c.Symbol, raid.RaidCandle.Timestamp, c.Timestamp).High
+					slCandle := b.getMaxInRange(c.Symbol, raid.RaidCandle.Timestamp, c.Timestamp)
+					sl := slCandle.High
 					signal := Signal{
+						Symbol: c.Symbol,
 						Action: SellAction,
 						Type: MarketOrder,
 						Price: c.Close,
-						TakeProfit: c.Close - (sl - c.Close) * 1,
+						TakeProfit: c.Close - (sl - c.Close) * b.Params.RMultiple,
 						StopLoss: sl,
 						Timestamp: c.Timestamp,
-						CancelTime: c.Timestamp.Add(120 * time.Minute),
+						CancelTime: c.Timestamp.Add(time.Duration(b.Params.CancelAfter)),
+						Context: raidInverseContext(raid, inverse, slCandle, sl, c, b.Params.RMultiple),
 					}
 					return &signal
 				} else if raid.Direction == Sellside && inverse.Direction == Sellside  && c.Close > raid.Price {
-					sl := b.getMinInRange(c.Symbol, raid.RaidCandle.Timestamp, c.Timestamp).Low
+					slCandle := b.getMinInRange(c.Symbol, raid.RaidCandle.Timestamp, c.Timestamp)
+					sl := slCandle.Low
 					signal := Signal{
+						Symbol: c.Symbol,
 						Action: BuyAction,
 						Type: MarketOrder,
 						Price: c.Close,
-						TakeProfit: c.Close + (c.Close - sl) * 1,
+						TakeProfit: c.Close + (c.Close - sl) * b.Params.RMultiple,
 						StopLoss: sl,
 						Timestamp: c.Timestamp,
-						CancelTime: c.Timestamp.Add(120 * time.Minute),
+						CancelTime: c.Timestamp.Add(time.Duration(b.Params.CancelAfter)),
+						Context: raidInverseContext(raid, inverse, slCandle, sl, c, b.Params.RMultiple),
 					}
 					return &signal
 				}
@@ -175,8 +226,127 @@ func (b *BarStrategy) GenerateSignal(c candle.Candle) *Signal {
 	return nil
 }
 
+// raidedPools returns the raided session pools followed by symbol's raided
+// generated pools and those of each higher timeframe.
+func (b *BarStrategy) raidedPools(symbol string) []LiquidityPool {
+	// Clone so appending never writes into the manager's backing array.
+	raided := slices.Clone(b.Pools.GetPools(false))
+	raided = append(raided, b.generated(symbol).GetPools(false)...)
+	for _, higher := range b.Higher {
+		raided = append(raided, higher.Levels(symbol).Pools.GetPools(false)...)
+	}
+	return raided
+}
+
+// warm feeds the lookback history before c through the higher timeframes,
+// pool generators, structure and blocks the first time a symbol has enough bars, so
+// they start with context rather than empty.
+func (b *BarStrategy) warm(c candle.Candle) {
+	if b.warmed[c.Symbol] {
+		return
+	}
+	b.warmed[c.Symbol] = true
+
+	bars := b.bars(c.Symbol)
+	for i := range bars.Len() {
+		bar := bars.At(i)
+		if !bar.Timestamp.Before(c.Timestamp) {
+			break
+		}
+		for _, higher := range b.Higher {
+			higher.ProcessCandle(bar)
+		}
+		b.generatePools(bar)
+		b.Pools.UpdateLPs(bar)
+		b.generated(bar.Symbol).UpdateLPs(bar)
+		b.processStructure(bar)
+	}
+}
+
+// processStructure adds c to its symbol's structure and then its blocks,
+// which are found from the breaks c makes.
+func (b *BarStrategy) processStructure(c candle.Candle) {
+	structure, ok := b.Structure[c.Symbol]
+	if !ok {
+		manager := NewStructureManager(b.StructureParams)
+		structure = &manager
+		b.Structure[c.Symbol] = structure
+	}
+	blocks, ok := b.Blocks[c.Symbol]
+	if !ok {
+		blocks = &BlockManager{}
+		b.Blocks[c.Symbol] = blocks
+	}
+	structure.ProcessCandle(c)
+	blocks.ProcessCandle(c, structure)
+}
+
+// generatePools tracks the pools the generators find with c for c's symbol.
+func (b *BarStrategy) generatePools(c candle.Candle) {
+	generated := b.generated(c.Symbol)
+	for _, generator := range b.Generators {
+		generated.track(generator.ProcessCandle(c)...)
+	}
+}
+
+// generated returns the generated pools for symbol, creating the manager on
+// first use.
+func (b *BarStrategy) generated(symbol string) *LiquidityPoolManager {
+	generated, ok := b.Generated[symbol]
+	if !ok {
+		generated = &LiquidityPoolManager{}
+		b.Generated[symbol] = generated
+	}
+	return generated
+}
+
+// sessionOpen returns the 09:30 New York open that c's bar spans, if it
+// spans one, so the day is initialized once whatever the timeframe.
+func (b *BarStrategy) sessionOpen(c candle.Candle) (time.Time, bool) {
+	start := c.Timestamp
+	if !c.Timeframe.IsZero() {
+		start = c.Timeframe.Truncate(c.Timestamp)
+	}
+	local := start.In(b.Location)
+	open := time.Date(local.Year(), local.Month(), local.Day(), 9, 30, 0, 0, b.Location)
+	if open.Before(start) {
+		open = open.AddDate(0, 0, 1)
+	}
+	return open, open.Equal(start) || open.Before(start.Add(c.Timeframe.Duration()))
+}
+
+// inSession reports whether c's bar overlaps 09:30 to 16:00 New York time.
+func (b *BarStrategy) inSession(c candle.Candle) bool {
+	start, end := c.Timestamp, c.Timestamp.Add(max(c.Timeframe.Duration(), time.Nanosecond))
+	local := start.In(b.Location)
+	for _, day := range []int{local.Day(), local.Day() + 1} {
+		sessionStart := time.Date(local.Year(), local.Month(), day, 9, 30, 0, 0, b.Location)
+		sessionEnd := time.Date(local.Year(), local.Month(), day, 16, 0, 0, 0, b.Location)
+		if start.Before(sessionEnd) && end.After(sessionStart) {
+			return true
+		}
+	}
+	return false
+}
+
+// accepts reports whether c is on the strategy's timeframe.
+func (b *BarStrategy) accepts(c candle.Candle) bool {
+	return b.Timeframe.IsZero() || c.Timeframe == b.Timeframe
+}
+
+// bars returns the ring buffer for symbol, creating one sized to Lookback.
+func (b *BarStrategy) bars(symbol string) *BarBuffer {
+	bars, ok := b.Bars[symbol]
+	if !ok {
+		bars = NewBarBuffer(b.Lookback)
+		b.Bars[symbol] = bars
+	}
+	return bars
+}
+
 func (b *BarStrategy) getNCandles(c candle.Candle) error {
-	if len(b.Bars[c.Symbol]) >= b.Lookback {
+	bars := b.bars(c.Symbol)
+	if bars.Len() >= b.Lookback {
 		return nil
 	}
 
@@ -184,16 +354,22 @@ func (b *BarStrategy) getNCandles(c candle.Candle) error {
 
 	candles := b.repo.GetPastCandles(b.ctx, c.Market, c.Symbol, c.Timeframe, c.Timestamp, b.Lookback)
 	if len(candles) > 0 {
-		if _, ok := b.Bars[c.Symbol]; !ok {
-			b.Bars[c.Symbol] = make(map[time.Time]candle.Candle)
+		// Keep any bars already received that are newer than the history.
+		held := make([]candle.Candle, bars.Len())
+		for i := range held {
+			held[i] = bars.At(i)
+		}
+
+		bars.Reset()
+		for i := len(candles) - 1; i >= 0; i-- {
+			bars.Append(candles[i])
 		}
-		for _, bar := range candles {
-			ts := bar.Timestamp.UTC().Truncate(time.Minute)
-			b.Bars[c.Symbol][ts] = bar
+		for _, bar := range held {
+			bars.Append(bar)
 		}
 	}
 
-	if len(b.Bars[c.Symbol]) < b.Lookback {
+	if bars.Len() < b.Lookback {
 		return fmt.Errorf("could not find all lookback candles for %s", c.Symbol)
 	}
 
@@ -201,51 +377,34 @@ func (b *BarStrategy) getNCandles(c candle.Candle) error {
 }
 
 func (b *BarStrategy) getMinInRange(symbol string, startTime time.Time, endTime time.Time) candle.Candle {
-	var low candle.Candle
-
 	if startTime.After(endTime) {
 		log.Fatal("startTime cannot be past endTime")
 	}
-	for ts := startTime; !ts.After(endTime); ts = ts.Add(time.Minute) {
-		ts = ts.UTC().Truncate(time.Minute)
-		c := b.Bars[symbol][ts]
-
-		if low.Low == 0.0 || c.Low < low.Low {
-			low = c
-		}
-	}
 
+	low, _ := b.bars(symbol).Min(startTime, endTime)
 	return low
 }
 
 func (b *BarStrategy) getMaxInRange(symbol string, startTime time.Time, endTime time.Time) candle.Candle {
-	var high candle.Candle
-
 	if startTime.After(endTime) {
 		log.Fatal("startTime cannot be past endTime")
 	}
-	for ts := startTime; !ts.After(endTime); ts = ts.Add(time.Minute) {
-		ts = ts.UTC().Truncate(time.Minute)
-		c := b.Bars[symbol][ts]
-
-		if high.High == 0.0 || c.High > high.High {
-			high = c
-		}
-	}
 
+	high, _ := b.bars(symbol).Max(startTime, endTime)
 	return high
 }
 
 func (b *BarStrategy) hasCandlesForRange(symbol string, start time.Time, end time.Time) bool {
-	bars := b.Bars[symbol]
-	if len(bars) == 0 {
+	bars := b.bars(symbol)
+	if bars.Len() == 0 {
 		log.Print("No bars found from getCandles")
 		return false
 	}
 
-	for ts := start; !ts.After(end); ts = ts.Add(time.Minute) {
-		key := ts.UTC().Truncate(time.Minute)
-		if _, ok := bars[key]; !ok {
+	last, _ := bars.Last()
+	timeframe := last.Timeframe
+	for ts := timeframe.Truncate(start); !ts.After(end); ts = ts.Add(timeframe.Duration()) {
+		if _, ok := bars.Get(ts); !ok {
 			log.Printf("Missing candle at %s", ts.Format("2006-01-02 15:04:05"))
 			return false
 		}
@@ -253,17 +412,3 @@ func (b *BarStrategy) hasCandlesForRange(symbol string, start time.Time, end tim
 
 	return true
 }
-
-func (b *BarStrategy) trimBars(symbol string, windowStart time.Time) {
-	bars := b.Bars[symbol]
-	if len(bars) == 0 {
-		return
-	}
-
-	cutoff := windowStart.UTC().Truncate(time.Minute)
-	for ts := range bars {
-		if ts.Before(cutoff) {
-			delete(bars, ts)
-		}
-	}
-}
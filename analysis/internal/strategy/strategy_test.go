@@ -0,0 +1,314 @@
+package strategy
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// series builds n candles of timeframe from start, with prices from price.
+func series(start time.Time, timeframe string, n int, price func(i int) (open, high, low, close float64)) []candle.Candle {
+	tf := candle.MustParseTimeframe(timeframe)
+	candles := make([]candle.Candle, n)
+	for i := range candles {
+		open, high, low, close := price(i)
+		candles[i] = candle.Candle{
+			Market:    "futures",
+			Symbol:    "NQZ4",
+			Timeframe: tf,
+			Open:      open,
+			High:      high,
+			Low:       low,
+			Close:     close,
+			Timestamp: start.Add(time.Duration(i) * tf.Duration()),
+		}
+	}
+	return candles
+}
+
+// replay runs candles through a new strategy with the given lookback.
+func replay(t *testing.T, candles []candle.Candle, lookback int) *BarStrategy {
+	t.Helper()
+
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(output) })
+
+	repo := candle.NewMemoryRepository()
+	repo.Load(candles)
+	b := NewBarStrategy(context.Background(), repo, "test", "futures", []string{"NQZ4"}, lookback)
+	for _, c := range candles {
+		b.ProcessCandle(c)
+	}
+	return b
+}
+
+func flat(i int) (float64, float64, float64, float64) {
+	p := 20000 + float64(i%7)
+	return p, p + 1, p - 1, p
+}
+
+func TestInitializeDayOncePerSession(t *testing.T) {
+	nyOpen := time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		timeframe string
+		start     time.Time
+		n         int
+		price     func(i int) (float64, float64, float64, float64)
+		// session is the last 09:30 open the strategy should initialize.
+		session time.Time
+		check   func(t *testing.T, b *BarStrategy)
+	}{
+		{
+			// A gap that forms at 09:30:12 would be reset by every other
+			// second of the 09:30 minute if each one initialized the day.
+			name:      "seconds keep gaps formed after the open",
+			timeframe: "1s",
+			start:     nyOpen.Add(-time.Minute),
+			n:         121,
+			session:   nyOpen,
+			price: func(i int) (float64, float64, float64, float64) {
+				if i >= 72 {
+					return 20010, 20011, 20009, 20010
+				}
+				return 20000, 20001, 19999, 20000
+			},
+			check: func(t *testing.T, b *BarStrategy) {
+				if len(b.Gaps.Gaps()) == 0 {
+					t.Error("gaps formed after the open were reset")
+				}
+			},
+		},
+		{
+			name:      "hours build session pools from the bar spanning the open",
+			timeframe: "1h",
+			start:     time.Date(2024, 10, 6, 0, 0, 0, 0, time.UTC),
+			n:         72,
+			session:   nyOpen,
+			price:     flat,
+			check: func(t *testing.T, b *BarStrategy) {
+				pools := append(b.Pools.GetPools(true), b.Pools.GetPools(false)...)
+				if len(pools) == 0 {
+					t.Error("no session pools built")
+				}
+			},
+		},
+		{
+			name:      "days initialize from a bar starting the evening before",
+			timeframe: "1d",
+			start:     time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC),
+			n:         38,
+			session:   nyOpen,
+			price:     flat,
+			check: func(t *testing.T, b *BarStrategy) {
+				last, _ := b.bars("NQZ4").Last()
+				if !b.inSession(last) {
+					t.Error("a daily bar should overlap the New York session")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candles := series(tt.start, tt.timeframe, tt.n, tt.price)
+			b := replay(t, candles, 5)
+
+			if got := b.sessions["NQZ4"]; !got.Equal(tt.session) {
+				t.Errorf("last session initialized = %v, want %v", got, tt.session)
+			}
+			if tt.check != nil {
+				tt.check(t, b)
+			}
+		})
+	}
+}
+
+func TestSessionOpen(t *testing.T) {
+	b := NewBarStrategy(context.Background(), candle.NewMemoryRepository(), "test", "futures", []string{"NQZ4"}, 1)
+	open := time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		timeframe string
+		start     time.Time
+		want      bool
+	}{
+		{"1s", open, true},
+		{"1s", open.Add(time.Second), false},
+		{"1m", open, true},
+		{"1m", open.Add(-time.Minute), false},
+		{"5m", open.Add(-5 * time.Minute), false},
+		{"1h", open.Add(-30 * time.Minute), true},
+		{"1h", open.Add(30 * time.Minute), false},
+		{"4h", time.Date(2024, 10, 8, 12, 0, 0, 0, time.UTC), true},
+		{"1d", time.Date(2024, 10, 8, 0, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		c := candle.Candle{Timeframe: candle.MustParseTimeframe(tt.timeframe), Timestamp: tt.start}
+		got, ok := b.sessionOpen(c)
+		if ok != tt.want {
+			t.Errorf("%s bar at %s spans open = %v, want %v", tt.timeframe, tt.start.Format(time.RFC3339), ok, tt.want)
+		}
+		if ok && !got.Equal(open) {
+			t.Errorf("%s bar at %s open = %v, want %v", tt.timeframe, tt.start.Format(time.RFC3339), got, open)
+		}
+	}
+}
+
+func TestLevelsKeyedBySymbol(t *testing.T) {
+	start := time.Date(2024, 10, 8, 0, 0, 0, 0, time.UTC)
+	nq := series(start, "1m", 480, func(i int) (float64, float64, float64, float64) {
+		p := 20000 + float64(i%13)
+		return p, p + 2, p - 2, p + 1
+	})
+	es := series(start, "1m", 480, func(i int) (float64, float64, float64, float64) {
+		p := 5700 + float64(i%11)
+		return p, p + 1, p - 1, p
+	})
+
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(output) })
+
+	repo := candle.NewMemoryRepository()
+	b := NewBarStrategy(context.Background(), repo, "test", "futures", []string{"NQZ4", "ESZ4"}, 5)
+	b.Higher = []*HigherTimeframe{NewHigherTimeframe(candle.MustParseTimeframe("1h"), b.Location, DefaultStructureParams())}
+	midnight, err := NewPoolGenerator(PoolDefinition{Type: string(MidnightOpenPool)}, b.Location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Generators = []PoolGenerator{midnight}
+	for i := range nq {
+		es[i].Symbol = "ESZ4"
+		b.ProcessCandle(nq[i])
+		b.ProcessCandle(es[i])
+	}
+
+	for symbol, bounds := range map[string][2]float64{"NQZ4": {19998, 20014}, "ESZ4": {5699, 5711}} {
+		levels := b.Higher[0].Levels(symbol)
+		generated := b.Generated[symbol]
+		if len(levels.Pools.GetPools(true))+len(levels.Pools.GetPools(false)) == 0 {
+			t.Errorf("%s: no higher timeframe pools", symbol)
+		}
+		if len(generated.GetPools(true))+len(generated.GetPools(false)) == 0 {
+			t.Errorf("%s: no generated pools", symbol)
+		}
+		for _, manager := range []*LiquidityPoolManager{&levels.Pools, generated} {
+			for _, pool := range manager.GetPools(true) {
+				if pool.Price < bounds[0] || pool.Price > bounds[1] {
+					t.Errorf("%s: pool %s at %v is outside the symbol's range", symbol, pool.Name, pool.Price)
+				}
+			}
+			for _, pool := range manager.GetPools(false) {
+				if pool.Price < bounds[0] || pool.Price > bounds[1] {
+					t.Errorf("%s: pool %s at %v is outside the symbol's range", symbol, pool.Name, pool.Price)
+				}
+				if pool.RaidCandle.Symbol != symbol {
+					t.Errorf("%s: pool %s raided by %s", symbol, pool.Name, pool.RaidCandle.Symbol)
+				}
+			}
+		}
+		swings := b.Structure[symbol].Swings()
+		if len(swings) == 0 {
+			t.Errorf("%s: no swings", symbol)
+		}
+		for _, swing := range swings {
+			if swing.Candle.Symbol != symbol {
+				t.Errorf("%s: swing from %s", symbol, swing.Candle.Symbol)
+			}
+		}
+	}
+}
+
+func TestStructureHistoryIsCapped(t *testing.T) {
+	// A rising sawtooth confirms a swing high and low every ten bars and
+	// breaks the last high on each leg up.
+	candles := series(time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), "1m", 20000, func(i int) (float64, float64, float64, float64) {
+		step := float64(min(i%10, 10-i%10))
+		p := 20000 + float64(i)/2 + 4*step
+		if i%10 < 5 {
+			return p - 3, p + 1, p - 4, p
+		}
+		return p + 3, p + 4, p - 1, p
+	})
+
+	structure := NewStructureManager(DefaultStructureParams())
+	var blocks BlockManager
+	for _, c := range candles {
+		structure.ProcessCandle(c)
+		blocks.ProcessCandle(c, &structure)
+	}
+
+	if got := len(structure.Breaks()); got != structureHistory {
+		t.Errorf("kept %d breaks, want %d", got, structureHistory)
+	}
+	if got := len(structure.Swings()); got != structureHistory {
+		t.Errorf("kept %d swings, want %d", got, structureHistory)
+	}
+	if got := len(structure.Displacements()); got > structureHistory {
+		t.Errorf("kept %d displacement legs, want at most %d", got, structureHistory)
+	}
+	if got := len(blocks.Blocks()); got > maxBlocks {
+		t.Errorf("kept %d blocks, want at most %d", got, maxBlocks)
+	}
+
+	last := structure.Breaks()[len(structure.Breaks())-1]
+	if !last.Candle.Timestamp.After(candles[len(candles)-100].Timestamp) {
+		t.Errorf("last break at %v is not among the latest candles", last.Candle.Timestamp)
+	}
+}
+
+func TestHigherTimeframeLevelsAreCapped(t *testing.T) {
+	// A steady rise leaves a gap on every 5m bar, raids each bar's high on
+	// the next and never comes back for the lows.
+	candles := series(time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), "1m", 20000, func(i int) (float64, float64, float64, float64) {
+		p := 20000 + float64(i)
+		return p, p + 1, p - 1, p + 1
+	})
+
+	higher := NewHigherTimeframe(candle.MustParseTimeframe("5m"), time.UTC, DefaultStructureParams())
+	for _, c := range candles {
+		higher.ProcessCandle(c)
+	}
+	levels := higher.Levels("NQZ4")
+
+	if got := len(levels.Pools.GetPools(true)); got != maxPools {
+		t.Errorf("kept %d active pools, want %d", got, maxPools)
+	}
+	if got := len(levels.Pools.GetPools(false)); got != maxPools {
+		t.Errorf("kept %d raided pools, want %d", got, maxPools)
+	}
+	if got := len(levels.Gaps.Gaps()); got != maxGaps {
+		t.Errorf("kept %d gaps, want %d", got, maxGaps)
+	}
+
+	raided := levels.Pools.GetPools(false)
+	last := raided[len(raided)-1]
+	if !last.RaidCandle.Timestamp.After(candles[len(candles)-10].Timestamp) {
+		t.Errorf("last raid at %v is not among the latest candles", last.RaidCandle.Timestamp)
+	}
+}
+
+func TestRaidedPoolsIsACopy(t *testing.T) {
+	b := replay(t, series(time.Date(2024, 10, 8, 0, 0, 0, 0, time.UTC), "1m", 10, flat), 5)
+	c := candle.Candle{Symbol: "NQZ4", High: 20010, Low: 20000, Timestamp: time.Date(2024, 10, 8, 0, 1, 0, 0, time.UTC)}
+	// Three raids leave the session manager's slice with spare capacity.
+	for _, price := range []float64{20005, 20006, 20007, 20008} {
+		b.Pools.track(LiquidityPool{Price: price, Direction: Buyside, Candle: &c, Name: "Session High", Kind: SessionPool})
+	}
+	b.Pools.UpdateLPs(candle.Candle{Symbol: "NQZ4", High: 20007, Timestamp: c.Timestamp})
+	b.generated("NQZ4").track(LiquidityPool{Price: 20001, Direction: Sellside, Candle: &c, Name: "Midnight Open", Kind: MidnightOpenPool})
+	b.generated("NQZ4").UpdateLPs(c)
+
+	raided := b.raidedPools("NQZ4")
+	b.Pools.UpdateLPs(c)
+	if last := raided[len(raided)-1]; last.Name != "Midnight Open" {
+		t.Errorf("raiding a session pool replaced %s in an earlier raidedPools result", last.Name)
+	}
+}
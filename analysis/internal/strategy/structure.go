@@ -0,0 +1,356 @@
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+type Trend string
+
+const (
+	TrendNone    Trend = ""
+	TrendBullish Trend = "bullish"
+	TrendBearish Trend = "bearish"
+)
+
+type BreakKind string
+
+const (
+	// BreakOfStructure continues the trend.
+	BreakOfStructure BreakKind = "bos"
+	// ChangeOfCharacter is the first break against the trend.
+	ChangeOfCharacter BreakKind = "choch"
+)
+
+// StructureParams tunes swing, break and displacement detection.
+type StructureParams struct {
+	// LeftBars and RightBars are how many bars before and after a swing
+	// must not reach it. A swing is confirmed RightBars bars after it forms.
+	LeftBars  int `json:"left_bars"`
+	RightBars int `json:"right_bars"`
+	// WickBreaks breaks a swing on any trade through it rather than a close.
+	WickBreaks bool `json:"wick_breaks"`
+	// DisplacementBody is the smallest body, as a fraction of the bar's
+	// range, of every bar in a displacement leg.
+	DisplacementBody float64 `json:"displacement_body"`
+	// DisplacementRange is how far a leg must move, in average bar ranges
+	// over AverageBars, to count as displacement.
+	DisplacementRange float64 `json:"displacement_range"`
+	AverageBars       int     `json:"average_bars"`
+}
+
+func DefaultStructureParams() StructureParams {
+	return StructureParams{
+		LeftBars:          2,
+		RightBars:         2,
+		DisplacementBody:  0.6,
+		DisplacementRange: 2,
+		AverageBars:       20,
+	}
+}
+
+func (p StructureParams) Validate() error {
+	var errs []error
+	if p.LeftBars <= 0 {
+		errs = append(errs, fmt.Errorf("structure.left_bars: must be positive, got %d", p.LeftBars))
+	}
+	if p.RightBars <= 0 {
+		errs = append(errs, fmt.Errorf("structure.right_bars: must be positive, got %d", p.RightBars))
+	}
+	if p.DisplacementBody < 0 || p.DisplacementBody > 1 {
+		errs = append(errs, fmt.Errorf("structure.displacement_body: must be between 0 and 1, got %g", p.DisplacementBody))
+	}
+	if p.DisplacementRange <= 0 {
+		errs = append(errs, fmt.Errorf("structure.displacement_range: must be positive, got %g", p.DisplacementRange))
+	}
+	if p.AverageBars <= 0 {
+		errs = append(errs, errors.New("structure.average_bars: must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// SwingPoint is a fractal swing: a bar whose high (Buyside) or low
+// (Sellside) no bar within LeftBars before or RightBars after reaches.
+type SwingPoint struct {
+	Direction Direction
+	Price     float64
+	Candle    *candle.Candle
+	// ConfirmCandle is the bar that completed the right side of the swing.
+	ConfirmCandle *candle.Candle
+	// BreakCandle is the bar that broke the swing, nil while it holds.
+	BreakCandle *candle.Candle
+}
+
+// StructureBreak is price breaking the latest swing high (Buyside) or low
+// (Sellside).
+type StructureBreak struct {
+	Kind      BreakKind
+	Direction Direction
+	Swing     SwingPoint
+	Candle    *candle.Candle
+	// Displacement is the leg the breaking bar was part of, if any.
+	Displacement *Displacement
+}
+
+// IsShift reports whether the break is a market structure shift: a change
+// of character made with displacement.
+func (b StructureBreak) IsShift() bool {
+	return b.Kind == ChangeOfCharacter && b.Displacement != nil
+}
+
+// Displacement is a run of strong-bodied bars in one direction that moved
+// at least DisplacementRange average bar ranges.
+type Displacement struct {
+	Direction   Direction
+	StartCandle *candle.Candle
+	EndCandle   *candle.Candle
+	Open        float64
+	Close       float64
+	Bars        int
+}
+
+// Size is the distance the leg moved from its first open to its last close.
+func (d Displacement) Size() float64 {
+	return math.Abs(d.Close - d.Open)
+}
+
+// swingDetector confirms fractal swings from a window of the most recent
+// left + right + 1 bars.
+type swingDetector struct {
+	left, right int
+	window      []candle.Candle
+}
+
+// add appends c and returns the swing high and low at the middle of the
+// window that c confirms, if any.
+func (d *swingDetector) add(c candle.Candle) (high *SwingPoint, low *SwingPoint) {
+	d.window = append(d.window, c)
+	if len(d.window) > d.left+d.right+1 {
+		d.window = d.window[1:]
+	}
+	if len(d.window) < d.left+d.right+1 {
+		return nil, nil
+	}
+
+	mid := d.window[d.left]
+	if d.beats(func(a, b candle.Candle) bool { return a.High > b.High }) {
+		high = &SwingPoint{Direction: Buyside, Price: mid.High, Candle: &mid, ConfirmCandle: &c}
+	}
+	if d.beats(func(a, b candle.Candle) bool { return a.Low < b.Low }) {
+		low = &SwingPoint{Direction: Sellside, Price: mid.Low, Candle: &mid, ConfirmCandle: &c}
+	}
+	return high, low
+}
+
+// beats reports whether the middle bar of the window beats every other bar.
+func (d *swingDetector) beats(better func(a, b candle.Candle) bool) bool {
+	for i, c := range d.window {
+		if i != d.left && !better(d.window[d.left], c) {
+			return false
+		}
+	}
+	return true
+}
+
+// StructureManager follows market structure on one series of candles:
+// swings as they are confirmed, breaks of the latest swing high and low, and
+// displacement legs.
+type StructureManager struct {
+	Params StructureParams
+
+	swings        swingDetector
+	trend         Trend
+	high, low     *SwingPoint
+	history       []SwingPoint
+	breaks        []StructureBreak
+	displacements []Displacement
+
+	ranges []float64
+	leg    *Displacement
+}
+
+// structureHistory is how many swings, breaks and displacement legs a
+// StructureManager keeps; older ones are dropped as new ones form.
+const structureHistory = 500
+
+func NewStructureManager(params StructureParams) StructureManager {
+	return StructureManager{
+		Params: params,
+		swings: swingDetector{left: params.LeftBars, right: params.RightBars},
+	}
+}
+
+func (sm *StructureManager) ProcessCandle(c candle.Candle) {
+	high, low := sm.swings.add(c)
+	if high != nil {
+		sm.high = high
+		sm.history = keepLast(append(sm.history, *high), structureHistory)
+	}
+	if low != nil {
+		sm.low = low
+		sm.history = keepLast(append(sm.history, *low), structureHistory)
+	}
+
+	leg := sm.extendLeg(c)
+
+	if sm.high != nil && sm.high.BreakCandle == nil && sm.breaksAbove(c, sm.high.Price) {
+		sm.addBreak(sm.high, Buyside, TrendBullish, c, leg)
+	}
+	if sm.low != nil && sm.low.BreakCandle == nil && sm.breaksBelow(c, sm.low.Price) {
+		sm.addBreak(sm.low, Sellside, TrendBearish, c, leg)
+	}
+}
+
+func (sm *StructureManager) breaksAbove(c candle.Candle, price float64) bool {
+	if sm.Params.WickBreaks {
+		return c.High > price
+	}
+	return c.Close > price
+}
+
+func (sm *StructureManager) breaksBelow(c candle.Candle, price float64) bool {
+	if sm.Params.WickBreaks {
+		return c.Low < price
+	}
+	return c.Close < price
+}
+
+func (sm *StructureManager) addBreak(swing *SwingPoint, direction Direction, trend Trend, c candle.Candle, leg *Displacement) {
+	swing.BreakCandle = &c
+	for i := len(sm.history) - 1; i >= 0; i-- {
+		if sm.history[i].Candle.Timestamp.Equal(swing.Candle.Timestamp) && sm.history[i].Direction == direction {
+			sm.history[i].BreakCandle = &c
+			break
+		}
+	}
+
+	kind := BreakOfStructure
+	if sm.trend != TrendNone && sm.trend != trend {
+		kind = ChangeOfCharacter
+	}
+	sm.trend = trend
+	sm.breaks = keepLast(append(sm.breaks, StructureBreak{Kind: kind, Direction: direction, Swing: *swing, Candle: &c, Displacement: leg}), structureHistory)
+}
+
+// extendLeg follows the run of strong-bodied bars that c belongs to and
+// returns the displacement it forms, if it has moved far enough.
+func (sm *StructureManager) extendLeg(c candle.Candle) *Displacement {
+	average := sm.averageRange()
+	sm.ranges = append(sm.ranges, c.High-c.Low)
+	if len(sm.ranges) > sm.Params.AverageBars {
+		sm.ranges = sm.ranges[1:]
+	}
+
+	direction, strong := sm.direction(c)
+	if !strong || sm.leg == nil || sm.leg.Direction != direction {
+		sm.leg = nil
+		if !strong {
+			return nil
+		}
+		sm.leg = &Displacement{Direction: direction, StartCandle: &c, Open: c.Open}
+	}
+	sm.leg.EndCandle = &c
+	sm.leg.Close = c.Close
+	sm.leg.Bars++
+
+	if average == 0 || sm.leg.Size() < sm.Params.DisplacementRange*average {
+		return nil
+	}
+	if n := len(sm.displacements); n > 0 && sm.displacements[n-1].StartCandle.Timestamp.Equal(sm.leg.StartCandle.Timestamp) {
+		sm.displacements[n-1] = *sm.leg
+	} else {
+		sm.displacements = keepLast(append(sm.displacements, *sm.leg), structureHistory)
+	}
+	leg := *sm.leg
+	return &leg
+}
+
+// direction returns the way c closed and whether its body is strong enough
+// to be part of a displacement leg.
+func (sm *StructureManager) direction(c candle.Candle) (Direction, bool) {
+	body, bar := math.Abs(c.Close-c.Open), c.High-c.Low
+	if bar == 0 || body < sm.Params.DisplacementBody*bar {
+		return "", false
+	}
+	if c.Close > c.Open {
+		return Buyside, true
+	}
+	return Sellside, true
+}
+
+func (sm *StructureManager) averageRange() float64 {
+	if len(sm.ranges) < sm.Params.AverageBars {
+		return 0
+	}
+	var total float64
+	for _, r := range sm.ranges {
+		total += r
+	}
+	return total / float64(len(sm.ranges))
+}
+
+// Trend is the direction of the last break, TrendNone before any.
+func (sm *StructureManager) Trend() Trend {
+	return sm.trend
+}
+
+// LastSwings returns the latest confirmed swing high and low, nil before
+// one is confirmed.
+func (sm *StructureManager) LastSwings() (high *SwingPoint, low *SwingPoint) {
+	return sm.high, sm.low
+}
+
+// Swings returns the confirmed swings kept, in the order they were
+// confirmed.
+func (sm *StructureManager) Swings() []SwingPoint {
+	return sm.history
+}
+
+// Breaks returns the breaks of structure and changes of character kept,
+// oldest first.
+func (sm *StructureManager) Breaks() []StructureBreak {
+	return sm.breaks
+}
+
+// Displacements returns the displacement legs kept, oldest first.
+func (sm *StructureManager) Displacements() []Displacement {
+	return sm.displacements
+}
+
+// GetShifts returns the market structure shifts made within maxAge bars of
+// c, any age when maxAge is negative.
+func (sm *StructureManager) GetShifts(c *candle.Candle, maxAge int) ([]StructureBreak, error) {
+	if maxAge < 0 {
+		maxAge = math.MaxInt
+	}
+
+	// Breaks are in time order, so the scan stops at the first one too old.
+	var shifts []StructureBreak
+	for i := len(sm.breaks) - 1; i >= 0; i-- {
+		b := sm.breaks[i]
+		age, err := b.Candle.Age(c)
+		if err != nil {
+			return shifts, err
+		}
+		if age > maxAge {
+			break
+		}
+		if b.IsShift() {
+			shifts = append(shifts, b)
+		}
+	}
+	slices.Reverse(shifts)
+	return shifts, nil
+}
+
+// keepLast drops all but the last n entries of s.
+func keepLast[T any](s []T, n int) []T {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
@@ -0,0 +1,115 @@
+package strategy
+
+import (
+	"math"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// Zone is a price range strategies trade from: fair value gaps, order blocks,
+// breakers, mitigation blocks and balanced price ranges.
+type Zone interface {
+	// Bounds returns the bottom and top of the zone.
+	Bounds() (low float64, high float64)
+	// Bias is Buyside for zones expected to hold as support and Sellside for
+	// resistance.
+	Bias() Direction
+	// Origin is the candle the zone was drawn from.
+	Origin() *candle.Candle
+	// Active reports whether price has yet to invalidate the zone.
+	Active() bool
+}
+
+type ZoneStatus string
+
+const (
+	ZoneActive    ZoneStatus = "active"
+	ZoneMitigated ZoneStatus = "mitigated"
+	ZoneBroken    ZoneStatus = "broken"
+)
+
+// PriceZone is the lifecycle shared by blocks and balanced price ranges. A
+// zone is mitigated when price first trades back into it and broken when a
+// candle closes through its far side.
+type PriceZone struct {
+	Direction Direction
+	Low       float64
+	High      float64
+	Candle    *candle.Candle
+	// FormCandle is the candle that confirmed the zone; ages count from it.
+	FormCandle       *candle.Candle
+	State            ZoneStatus
+	MitigationCandle *candle.Candle
+	BreakCandle      *candle.Candle
+}
+
+func (z PriceZone) Bounds() (float64, float64) {
+	return z.Low, z.High
+}
+
+func (z PriceZone) Bias() Direction {
+	return z.Direction
+}
+
+func (z PriceZone) Origin() *candle.Candle {
+	return z.Candle
+}
+
+func (z PriceZone) Active() bool {
+	return z.State != ZoneBroken
+}
+
+func (z PriceZone) Age(c *candle.Candle) (int, error) {
+	return z.FormCandle.Age(c)
+}
+
+// processCandle advances the zone with c and reports whether c broke it.
+func (z *PriceZone) processCandle(c *candle.Candle) bool {
+	if z.State == ZoneBroken || !c.Timestamp.After(z.FormCandle.Timestamp) {
+		return false
+	}
+
+	var touched, broken bool
+	switch z.Direction {
+	case Buyside:
+		touched, broken = c.Low <= z.High, c.Close < z.Low
+	case Sellside:
+		touched, broken = c.High >= z.Low, c.Close > z.High
+	}
+	if broken {
+		z.State = ZoneBroken
+		z.BreakCandle = c
+		return true
+	}
+	if touched && z.State == ZoneActive {
+		z.State = ZoneMitigated
+		z.MitigationCandle = c
+	}
+	return false
+}
+
+// activeWithin returns the zones that are not broken and formed within
+// maxAge bars of c, any age when maxAge is negative.
+func activeWithin[T interface {
+	Active() bool
+	Age(*candle.Candle) (int, error)
+}](zones []T, c *candle.Candle, maxAge int) ([]T, error) {
+	if maxAge < 0 {
+		maxAge = math.MaxInt
+	}
+
+	var active []T
+	for _, zone := range zones {
+		if !zone.Active() {
+			continue
+		}
+		age, err := zone.Age(c)
+		if err != nil {
+			return active, err
+		}
+		if age <= maxAge {
+			active = append(active, zone)
+		}
+	}
+	return active, nil
+}
@@ -14,7 +14,7 @@ type Candle struct {
 	ID        int       `db:"id"`
 	Market    string    `db:"market"`
 	Symbol    string    `db:"symbol"`
-	Timeframe string    `db:"timeframe"`
+	Timeframe Timeframe `db:"timeframe"`
 	Open      float64   `db:"open"`
 	High      float64   `db:"high"`
 	Low       float64   `db:"low"`
@@ -22,18 +22,22 @@ type Candle struct {
 	Volume    int       `db:"volume"`
 	Timestamp time.Time `db:"timestamp"`
 }
+// Age returns how many bars of c's timeframe separate c from other.
 func (c *Candle) Age(other *Candle) (int, error) {
 	if other.Timestamp.Before(c.Timestamp) {
-		return -1, fmt.Errorf("FairValueGap timestamp %s is after candle timestamp %s", c.Timestamp.Format(time.RFC3339), other.Timestamp.Format(time.RFC3339))
+		return -1, fmt.Errorf("candle timestamp %s is after candle timestamp %s", c.Timestamp.Format(time.RFC3339), other.Timestamp.Format(time.RFC3339))
+	}
+	if c.Timeframe.IsZero() {
+		return -1, fmt.Errorf("candle at %s has no timeframe", c.Timestamp.Format(time.RFC3339))
 	}
 
-	return int(other.Timestamp.Sub(c.Timestamp).Minutes()), nil
+	return c.Timeframe.Bars(other.Timestamp.Sub(c.Timestamp)), nil
 }
 
 
 type Repository interface {
-	GetCandles(ctx context.Context, market string, symbol string, timeframe string, startTime time.Time, endTime time.Time) []Candle
-	GetPastCandles(ctx context.Context, market string, symbol string, timeframe string, startTime time.Time, count int) []Candle
+	GetCandles(ctx context.Context, market string, symbol string, timeframe Timeframe, startTime time.Time, endTime time.Time) []Candle
+	GetPastCandles(ctx context.Context, market string, symbol string, timeframe Timeframe, startTime time.Time, count int) []Candle
 	AddCandle(ctx context.Context, candle Candle) int
 }
 
@@ -45,7 +49,7 @@ func NewRepository(db *pgxpool.Pool) *CandleRepository {
 	return &CandleRepository{db}
 }
 
-func (r *CandleRepository) GetPastCandles(ctx context.Context, market string, symbol string, timeframe string, startTime time.Time, count int) []Candle {
+func (r *CandleRepository) GetPastCandles(ctx context.Context, market string, symbol string, timeframe Timeframe, startTime time.Time, count int) []Candle {
 	sql := `SELECT id, market, symbol, timeframe, open, high, low, close, volume, timestamp
 			FROM candles
 			WHERE market = @market
@@ -98,7 +102,7 @@ func (r *CandleRepository) GetPastCandles(ctx context.Context, market string, sy
 	return candles
 }
 
-func (r *CandleRepository) GetCandles(ctx context.Context, market string, symbol string, timeframe string, startTime time.Time, endTime time.Time) []Candle {
+func (r *CandleRepository) GetCandles(ctx context.Context, market string, symbol string, timeframe Timeframe, startTime time.Time, endTime time.Time) []Candle {
 	sql := `SELECT id, market, symbol, timeframe, open, high, low, close, volume, timestamp
 			FROM candles
 			WHERE market = @market
@@ -0,0 +1,111 @@
+package candle
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVHeader is the column layout read and written for candle CSV files. It
+// matches the candles table.
+var CSVHeader = []string{"market", "symbol", "timeframe", "open", "high", "low", "close", "volume", "timestamp"}
+
+// ReadCSV decodes candles from a CSV stream with a CSVHeader header row.
+// Columns may appear in any order; timestamps are RFC 3339.
+func ReadCSV(r io.Reader) ([]Candle, error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range CSVHeader {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv missing column %q", name)
+		}
+	}
+
+	var candles []Candle
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return candles, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := parseCSVRecord(record, columns)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		candles = append(candles, c)
+	}
+}
+
+func parseCSVRecord(record []string, columns map[string]int) (Candle, error) {
+	c := Candle{
+		Market: record[columns["market"]],
+		Symbol: record[columns["symbol"]],
+	}
+
+	timeframe, err := ParseTimeframe(record[columns["timeframe"]])
+	if err != nil {
+		return c, err
+	}
+	c.Timeframe = timeframe
+
+	prices := []struct {
+		column string
+		dest   *float64
+	}{
+		{"open", &c.Open},
+		{"high", &c.High},
+		{"low", &c.Low},
+		{"close", &c.Close},
+	}
+	for _, p := range prices {
+		v, err := strconv.ParseFloat(record[columns[p.column]], 64)
+		if err != nil {
+			return c, fmt.Errorf("invalid %s: %w", p.column, err)
+		}
+		*p.dest = v
+	}
+
+	volume, err := strconv.Atoi(record[columns["volume"]])
+	if err != nil {
+		return c, fmt.Errorf("invalid volume: %w", err)
+	}
+	c.Volume = volume
+
+	ts, err := time.Parse(time.RFC3339Nano, record[columns["timestamp"]])
+	if err != nil {
+		return c, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	c.Timestamp = ts.UTC()
+
+	return c, nil
+}
+
+// CSVRecord formats a candle as a row matching CSVHeader.
+func CSVRecord(c Candle) []string {
+	return []string{
+		c.Market,
+		c.Symbol,
+		c.Timeframe.String(),
+		strconv.FormatFloat(c.Open, 'f', -1, 64),
+		strconv.FormatFloat(c.High, 'f', -1, 64),
+		strconv.FormatFloat(c.Low, 'f', -1, 64),
+		strconv.FormatFloat(c.Close, 'f', -1, 64),
+		strconv.Itoa(c.Volume),
+		c.Timestamp.UTC().Format(time.RFC3339Nano),
+	}
+}
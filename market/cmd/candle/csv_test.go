@@ -0,0 +1,78 @@
+package candle
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeCSV(t *testing.T, candles []Candle) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(CSVHeader)
+	for _, c := range candles {
+		writer.Write(CSVRecord(c))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	candles := sample(3)
+	// Sub-second timestamps and prices that do not fit in a float32.
+	candles[1].Timestamp = candles[1].Timestamp.Add(123456789)
+	candles[2].Open = 20123.123456789
+
+	got, err := ReadCSV(bytes.NewReader(writeCSV(t, candles)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, candles) {
+		t.Errorf("round trip = %+v, want %+v", got, candles)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Candle
+		wantErr string
+	}{
+		{
+			name:  "columns in any order",
+			input: "timestamp,close,low,high,open,volume,timeframe,symbol,market\n2024-10-08T09:30:00-04:00,4,1,5,2,10,5m,NQZ4,futures\n",
+			want: Candle{
+				Market: "futures", Symbol: "NQZ4", Timeframe: MustParseTimeframe("5m"),
+				Open: 2, High: 5, Low: 1, Close: 4, Volume: 10, Timestamp: sampleStart,
+			},
+		},
+		{name: "missing column", input: "market,symbol,timeframe,open,high,low,close,timestamp\n", wantErr: `missing column "volume"`},
+		{name: "bad price", input: strings.Join(CSVHeader, ",") + "\nfutures,NQZ4,1m,x,5,1,4,10,2024-10-08T13:30:00Z\n", wantErr: "line 2: invalid open"},
+		{name: "bad timeframe", input: strings.Join(CSVHeader, ",") + "\nfutures,NQZ4,7x,2,5,1,4,10,2024-10-08T13:30:00Z\n", wantErr: "line 2"},
+		{name: "bad timestamp", input: strings.Join(CSVHeader, ",") + "\nfutures,NQZ4,1m,2,5,1,4,10,yesterday\n", wantErr: "invalid timestamp"},
+	}
+	for _, tt := range tests {
+		got, err := ReadCSV(strings.NewReader(tt.input))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(got) != 1 || !reflect.DeepEqual(got[0], tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package candle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DBN (Databento Binary Encoding) constants needed to decode OHLCV files.
+// Only the metadata fields and record types we store are handled.
+const (
+	dbnPrefix             = "DBN"
+	dbnFixedMetaLength    = 100
+	dbnRecordHeaderLength = 16
+	dbnOHLCVLength        = 56
+	dbnV1SymbolLength     = 22
+	dbnPriceScale         = 1e9
+	dbnDefaultMarket      = "futures"
+
+	dbnOHLCV1s = 0x20
+	dbnOHLCV1m = 0x21
+	dbnOHLCV1h = 0x22
+	dbnOHLCV1d = 0x23
+)
+
+var dbnTimeframes = map[uint8]Timeframe{
+	dbnOHLCV1s: MustParseTimeframe("1s"),
+	dbnOHLCV1m: MustParseTimeframe("1m"),
+	dbnOHLCV1h: MustParseTimeframe("1h"),
+	dbnOHLCV1d: MustParseTimeframe("1d"),
+}
+
+// ReadDBN decodes an uncompressed DBN stream of OHLCV records into candles.
+// Instruments are named after the raw symbol they were requested with, with
+// any continuous-contract suffix stripped (NQ.v.0 -> NQ), matching
+// data/dbn_to_db.py.
+func ReadDBN(r io.Reader) ([]Candle, error) {
+	br := bufio.NewReader(r)
+
+	symbols, err := readDBNMetadata(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var candles []Candle
+	for {
+		size, err := br.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return candles, nil
+			}
+			return nil, err
+		}
+
+		length := int(size) * 4
+		if length < dbnRecordHeaderLength {
+			return nil, fmt.Errorf("invalid dbn record length %d", length)
+		}
+		record := make([]byte, length)
+		record[0] = size
+		if _, err := io.ReadFull(br, record[1:]); err != nil {
+			return nil, fmt.Errorf("truncated dbn record: %w", err)
+		}
+
+		timeframe, ok := dbnTimeframes[record[1]]
+		if !ok || length < dbnOHLCVLength {
+			continue
+		}
+
+		instrumentID := binary.LittleEndian.Uint32(record[4:8])
+		symbol, ok := symbols[instrumentID]
+		if !ok {
+			symbol = strconv.FormatUint(uint64(instrumentID), 10)
+		}
+
+		candles = append(candles, Candle{
+			Market:    dbnDefaultMarket,
+			Symbol:    symbol,
+			Timeframe: timeframe,
+			Open:      dbnPrice(record[16:24]),
+			High:      dbnPrice(record[24:32]),
+			Low:       dbnPrice(record[32:40]),
+			Close:     dbnPrice(record[40:48]),
+			Volume:    int(binary.LittleEndian.Uint64(record[48:56])),
+			Timestamp: time.Unix(0, int64(binary.LittleEndian.Uint64(record[8:16]))).UTC(),
+		})
+	}
+}
+
+// readDBNMetadata consumes the metadata header and returns the instrument id
+// to symbol mapping it carries.
+func readDBNMetadata(r io.Reader) (map[uint32]string, error) {
+	prelude := make([]byte, 8)
+	if _, err := io.ReadFull(r, prelude); err != nil {
+		return nil, fmt.Errorf("reading dbn prelude: %w", err)
+	}
+	if string(prelude[:3]) != dbnPrefix {
+		return nil, errors.New("not a dbn stream")
+	}
+	version := prelude[3]
+
+	meta := make([]byte, binary.LittleEndian.Uint32(prelude[4:8]))
+	if _, err := io.ReadFull(r, meta); err != nil {
+		return nil, fmt.Errorf("reading dbn metadata: %w", err)
+	}
+	if len(meta) < dbnFixedMetaLength+4 {
+		return nil, errors.New("dbn metadata too short")
+	}
+
+	symbolLength := dbnV1SymbolLength
+	if version >= 2 {
+		// dataset(16) schema(2) start(8) end(8) limit(8) stype_in stype_out ts_out
+		symbolLength = int(binary.LittleEndian.Uint16(meta[45:47]))
+	}
+
+	m := &dbnMetaReader{buf: meta, pos: dbnFixedMetaLength, symbolLength: symbolLength}
+	m.pos += int(m.uint32()) // schema definition, unused
+
+	// symbols, partial and not_found lists
+	for range 3 {
+		count := int(m.uint32())
+		m.pos += count * symbolLength
+	}
+
+	symbols := make(map[uint32]string)
+	mappings := int(m.uint32())
+	for range mappings {
+		raw := m.symbol()
+		root, _, _ := strings.Cut(raw, ".")
+		intervals := int(m.uint32())
+		for range intervals {
+			m.pos += 8 // start and end dates
+			id, err := strconv.ParseUint(m.symbol(), 10, 32)
+			if err == nil {
+				symbols[uint32(id)] = root
+			}
+		}
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return symbols, nil
+}
+
+type dbnMetaReader struct {
+	buf          []byte
+	pos          int
+	symbolLength int
+	err          error
+}
+
+func (m *dbnMetaReader) uint32() uint32 {
+	if m.err != nil || m.pos+4 > len(m.buf) {
+		m.err = errors.New("dbn metadata truncated")
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(m.buf[m.pos:])
+	m.pos += 4
+	return v
+}
+
+func (m *dbnMetaReader) symbol() string {
+	if m.err != nil || m.pos+m.symbolLength > len(m.buf) {
+		m.err = errors.New("dbn metadata truncated")
+		return ""
+	}
+	raw := m.buf[m.pos : m.pos+m.symbolLength]
+	m.pos += m.symbolLength
+	if i := bytes.IndexByte(raw, 0); i >= 0 {
+		raw = raw[:i]
+	}
+	return string(raw)
+}
+
+func dbnPrice(b []byte) float64 {
+	return float64(int64(binary.LittleEndian.Uint64(b))) / dbnPriceScale
+}
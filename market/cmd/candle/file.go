@@ -0,0 +1,105 @@
+package candle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// FileRepository is a read-only Repository over a directory of candle files.
+// Every .csv, .parquet, .dbn and .dbn.zst file below the directory is loaded
+// into memory when the repository is created.
+type FileRepository struct {
+	*MemoryRepository
+	dir string
+}
+
+func NewFileRepository(dir string) (*FileRepository, error) {
+	repo := &FileRepository{
+		MemoryRepository: NewMemoryRepository(),
+		dir:              dir,
+	}
+
+	files := 0
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		candles, ok, err := readCandleFile(path)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", path, err)
+		}
+		if ok {
+			repo.Load(candles)
+			files++
+			log.Printf("Loaded %d candles from %s", len(candles), path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if files == 0 {
+		return nil, fmt.Errorf("no candle files found in %s", dir)
+	}
+
+	return repo, nil
+}
+
+// AddCandle logs and drops c, since the files are read-only, and returns 0
+// as no candle was stored.
+func (r *FileRepository) AddCandle(ctx context.Context, c Candle) int {
+	log.Printf("Dropping %s %s candle at %s: file repository at %s is read-only", c.Symbol, c.Timeframe, c.Timestamp.Format(time.RFC3339), r.dir)
+	return 0
+}
+
+// candleFileReaders maps supported file suffixes to their decoders.
+var candleFileReaders = []struct {
+	suffix string
+	read   func(*os.File) ([]Candle, error)
+}{
+	{".csv", func(f *os.File) ([]Candle, error) { return ReadCSV(f) }},
+	{".parquet", ReadParquet},
+	{".dbn", func(f *os.File) ([]Candle, error) { return ReadDBN(f) }},
+	{".dbn.zst", func(f *os.File) ([]Candle, error) { return readCompressedDBN(f) }},
+}
+
+// readCandleFile decodes path based on its extension, reporting false for
+// files that are not candle data.
+func readCandleFile(path string) ([]Candle, bool, error) {
+	name := strings.ToLower(filepath.Base(path))
+	for _, format := range candleFileReaders {
+		if !strings.HasSuffix(name, format.suffix) {
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, false, err
+		}
+		defer f.Close()
+
+		candles, err := format.read(f)
+		return candles, true, err
+	}
+
+	return nil, false, nil
+}
+
+func readCompressedDBN(r io.Reader) ([]Candle, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+
+	return ReadDBN(decoder)
+}
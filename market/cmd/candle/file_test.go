@@ -0,0 +1,76 @@
+package candle
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// quiet silences the loading logs for the rest of the test.
+func quiet(t *testing.T) {
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(output) })
+}
+
+func TestFileRepositoryLoadsEveryFormat(t *testing.T) {
+	quiet(t)
+	ctx := context.Background()
+	candles := sample(6)
+
+	// The CSV and Parquet files overlap at minute 3; notes are not candles.
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "early.CSV"), writeCSV(t, candles[:4]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeParquet(t, filepath.Join(dir, "nested", "late.parquet"), candles[3:])
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not candles"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewFileRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := repo.GetCandles(ctx, "futures", "NQZ4", MustParseTimeframe("1m"), sampleStart, sampleStart.Add(time.Hour))
+	if offsets := minutes(got); !sameInts(offsets, []int{0, 1, 2, 3, 4, 5}) {
+		t.Errorf("loaded minutes %v, want 0 to 5", offsets)
+	}
+
+	// The files are read-only.
+	extra := sample(7)[6]
+	if id := repo.AddCandle(ctx, extra); id != 0 {
+		t.Errorf("AddCandle = %d, want 0", id)
+	}
+	if got := repo.GetCandles(ctx, "futures", "NQZ4", MustParseTimeframe("1m"), extra.Timestamp, extra.Timestamp); len(got) != 0 {
+		t.Errorf("added candle was stored: %+v", got)
+	}
+}
+
+func TestFileRepositoryErrors(t *testing.T) {
+	quiet(t)
+
+	empty := t.TempDir()
+	if err := os.WriteFile(filepath.Join(empty, "notes.txt"), []byte("not candles"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileRepository(empty); err == nil || !strings.Contains(err.Error(), "no candle files") {
+		t.Errorf("directory without candles: error = %v", err)
+	}
+
+	broken := t.TempDir()
+	if err := os.WriteFile(filepath.Join(broken, "bad.csv"), []byte("market,symbol\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileRepository(broken); err == nil || !strings.Contains(err.Error(), "bad.csv") {
+		t.Errorf("malformed file: error = %v, want one naming the file", err)
+	}
+}
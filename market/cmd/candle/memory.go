@@ -0,0 +1,136 @@
+package candle
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type seriesKey struct {
+	market    string
+	symbol    string
+	timeframe Timeframe
+}
+
+// MemoryRepository keeps candles in per-series slices sorted by timestamp so
+// range queries can binary search instead of scanning.
+type MemoryRepository struct {
+	mu     sync.RWMutex
+	series map[seriesKey][]Candle
+	nextID int
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		series: make(map[seriesKey][]Candle),
+	}
+}
+
+// Load bulk inserts candles, which is much cheaper than repeated AddCandle
+// calls when seeding the repository from files.
+func (r *MemoryRepository) Load(candles []Candle) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	touched := make(map[seriesKey]bool)
+	for _, c := range candles {
+		key := seriesKey{c.Market, c.Symbol, c.Timeframe}
+		if c.ID == 0 {
+			r.nextID++
+			c.ID = r.nextID
+		}
+		r.series[key] = append(r.series[key], c)
+		touched[key] = true
+	}
+
+	for key := range touched {
+		r.series[key] = sortAndDedupe(r.series[key])
+	}
+}
+
+func (r *MemoryRepository) GetCandles(ctx context.Context, market string, symbol string, timeframe Timeframe, startTime time.Time, endTime time.Time) []Candle {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	candles := r.series[seriesKey{market, symbol, timeframe}]
+	lo := sort.Search(len(candles), func(i int) bool {
+		return !candles[i].Timestamp.Before(startTime)
+	})
+	hi := sort.Search(len(candles), func(i int) bool {
+		return candles[i].Timestamp.After(endTime)
+	})
+	if lo >= hi {
+		return nil
+	}
+
+	result := make([]Candle, hi-lo)
+	copy(result, candles[lo:hi])
+	return result
+}
+
+// GetPastCandles mirrors the Postgres query: the count candles at or before
+// startTime, newest first.
+func (r *MemoryRepository) GetPastCandles(ctx context.Context, market string, symbol string, timeframe Timeframe, startTime time.Time, count int) []Candle {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	candles := r.series[seriesKey{market, symbol, timeframe}]
+	hi := sort.Search(len(candles), func(i int) bool {
+		return candles[i].Timestamp.After(startTime)
+	})
+	lo := max(hi-count, 0)
+	if lo >= hi {
+		return nil
+	}
+
+	result := make([]Candle, 0, hi-lo)
+	for i := hi - 1; i >= lo; i-- {
+		result = append(result, candles[i])
+	}
+	return result
+}
+
+// AddCandle inserts the candle in timestamp order. A candle with the same
+// market, symbol, timeframe and timestamp replaces the stored one and keeps
+// its id.
+func (r *MemoryRepository) AddCandle(ctx context.Context, c Candle) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := seriesKey{c.Market, c.Symbol, c.Timeframe}
+	candles := r.series[key]
+	i := sort.Search(len(candles), func(i int) bool {
+		return !candles[i].Timestamp.Before(c.Timestamp)
+	})
+	if i < len(candles) && candles[i].Timestamp.Equal(c.Timestamp) {
+		c.ID = candles[i].ID
+		candles[i] = c
+		return c.ID
+	}
+
+	r.nextID++
+	c.ID = r.nextID
+	candles = append(candles, Candle{})
+	copy(candles[i+1:], candles[i:])
+	candles[i] = c
+	r.series[key] = candles
+
+	return c.ID
+}
+
+func sortAndDedupe(candles []Candle) []Candle {
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].Timestamp.Before(candles[j].Timestamp)
+	})
+
+	deduped := candles[:0]
+	for _, c := range candles {
+		if n := len(deduped); n > 0 && deduped[n-1].Timestamp.Equal(c.Timestamp) {
+			deduped[n-1] = c
+			continue
+		}
+		deduped = append(deduped, c)
+	}
+	return deduped
+}
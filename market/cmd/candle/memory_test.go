@@ -0,0 +1,121 @@
+package candle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var sampleStart = time.Date(2024, 10, 8, 13, 30, 0, 0, time.UTC)
+
+// sample is n NQZ4 1m candles from sampleStart, closing up a point a bar.
+func sample(n int) []Candle {
+	candles := make([]Candle, n)
+	for i := range candles {
+		p := 20000.25 + float64(i)
+		candles[i] = Candle{
+			Market:    "futures",
+			Symbol:    "NQZ4",
+			Timeframe: MustParseTimeframe("1m"),
+			Open:      p,
+			High:      p + 1.5,
+			Low:       p - 0.75,
+			Close:     p + 1,
+			Volume:    100 + i,
+			Timestamp: sampleStart.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	return candles
+}
+
+func minutes(candles []Candle) []int {
+	var offsets []int
+	for _, c := range candles {
+		offsets = append(offsets, int(c.Timestamp.Sub(sampleStart)/time.Minute))
+	}
+	return offsets
+}
+
+func sameInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemoryRepositoryRanges(t *testing.T) {
+	ctx := context.Background()
+	oneMinute := MustParseTimeframe("1m")
+	candles := sample(10)
+	// Loaded out of order, with another series and a duplicate of minute 4
+	// that replaces the first.
+	other := sample(3)
+	for i := range other {
+		other[i].Symbol = "ESZ4"
+	}
+	duplicate := candles[4]
+	duplicate.Close = 1
+
+	repo := NewMemoryRepository()
+	repo.Load(append([]Candle{candles[9], duplicate}, other...))
+	repo.Load(candles[:9])
+	repo.Load([]Candle{duplicate})
+
+	at := func(i int) time.Time { return sampleStart.Add(time.Duration(i) * time.Minute) }
+	tests := []struct {
+		name string
+		got  []Candle
+		want []int
+	}{
+		{"range is inclusive", repo.GetCandles(ctx, "futures", "NQZ4", oneMinute, at(2), at(5)), []int{2, 3, 4, 5}},
+		{"bounds between bars", repo.GetCandles(ctx, "futures", "NQZ4", oneMinute, at(2).Add(time.Second), at(5).Add(-time.Second)), []int{3, 4}},
+		{"range past the end", repo.GetCandles(ctx, "futures", "NQZ4", oneMinute, at(8), at(20)), []int{8, 9}},
+		{"empty range", repo.GetCandles(ctx, "futures", "NQZ4", oneMinute, at(5), at(4)), nil},
+		{"other timeframe", repo.GetCandles(ctx, "futures", "NQZ4", MustParseTimeframe("5m"), at(0), at(9)), nil},
+		{"past candles are newest first", repo.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, at(5), 3), []int{5, 4, 3}},
+		{"past candles between bars", repo.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, at(5).Add(-time.Second), 3), []int{4, 3, 2}},
+		{"fewer past candles than asked", repo.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, at(1), 5), []int{1, 0}},
+		{"no past candles", repo.GetPastCandles(ctx, "futures", "NQZ4", oneMinute, at(0).Add(-time.Second), 5), nil},
+		{"series are separate", repo.GetCandles(ctx, "futures", "ESZ4", oneMinute, at(0), at(9)), []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		if got := minutes(tt.got); !sameInts(got, tt.want) {
+			t.Errorf("%s: got minutes %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if got := repo.GetCandles(ctx, "futures", "NQZ4", oneMinute, at(4), at(4)); len(got) != 1 || got[0].Close != 1 {
+		t.Errorf("minute 4 = %+v, want the later duplicate", got)
+	}
+}
+
+func TestMemoryRepositoryAddCandle(t *testing.T) {
+	ctx := context.Background()
+	candles := sample(5)
+	repo := NewMemoryRepository()
+	repo.Load([]Candle{candles[0], candles[4]})
+
+	id := repo.AddCandle(ctx, candles[2])
+	if id == 0 {
+		t.Fatal("AddCandle returned no id")
+	}
+	repo.AddCandle(ctx, candles[1])
+	replaced := candles[2]
+	replaced.Close = 1
+	if got := repo.AddCandle(ctx, replaced); got != id {
+		t.Errorf("replacing a candle changed its id from %d to %d", id, got)
+	}
+
+	got := repo.GetCandles(ctx, "futures", "NQZ4", MustParseTimeframe("1m"), sampleStart, sampleStart.Add(time.Hour))
+	if offsets := minutes(got); !sameInts(offsets, []int{0, 1, 2, 4}) {
+		t.Errorf("got minutes %v, want 0, 1, 2, 4", offsets)
+	}
+	if got[2].Close != 1 {
+		t.Errorf("minute 2 close = %v, want the replacement's 1", got[2].Close)
+	}
+}
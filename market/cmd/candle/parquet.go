@@ -0,0 +1,107 @@
+package candle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// ParquetPriceScale is the number of decimal places kept for prices in
+// Parquet files, the same fixed precision DBN uses.
+const ParquetPriceScale = 9
+
+// ParquetRow is the on-disk Parquet layout for a candle. Prices are stored as
+// DECIMAL(18, 9) and timestamps as UTC nanosecond TIMESTAMPs so pandas and
+// DuckDB read them without float or epoch conversions.
+type ParquetRow struct {
+	Market    string    `parquet:"market,dict"`
+	Symbol    string    `parquet:"symbol,dict"`
+	Timeframe string    `parquet:"timeframe,dict"`
+	Open      int64     `parquet:"open,decimal(9:18)"`
+	High      int64     `parquet:"high,decimal(9:18)"`
+	Low       int64     `parquet:"low,decimal(9:18)"`
+	Close     int64     `parquet:"close,decimal(9:18)"`
+	Volume    int64     `parquet:"volume"`
+	Timestamp time.Time `parquet:"timestamp,timestamp(nanosecond:utc)"`
+}
+
+func NewParquetRow(c Candle) ParquetRow {
+	return ParquetRow{
+		Market:    c.Market,
+		Symbol:    c.Symbol,
+		Timeframe: c.Timeframe.String(),
+		Open:      toDecimal(c.Open),
+		High:      toDecimal(c.High),
+		Low:       toDecimal(c.Low),
+		Close:     toDecimal(c.Close),
+		Volume:    int64(c.Volume),
+		Timestamp: c.Timestamp.UTC(),
+	}
+}
+
+func (row ParquetRow) Candle() (Candle, error) {
+	timeframe, err := ParseTimeframe(row.Timeframe)
+	if err != nil {
+		return Candle{}, err
+	}
+
+	return Candle{
+		Market:    row.Market,
+		Symbol:    row.Symbol,
+		Timeframe: timeframe,
+		Open:      fromDecimal(row.Open),
+		High:      fromDecimal(row.High),
+		Low:       fromDecimal(row.Low),
+		Close:     fromDecimal(row.Close),
+		Volume:    int(row.Volume),
+		Timestamp: row.Timestamp.UTC(),
+	}, nil
+}
+
+// ReadParquet decodes every row of a Parquet file written with ParquetRow.
+func ReadParquet(f *os.File) ([]Candle, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	reader := parquet.NewGenericReader[ParquetRow](file)
+	defer reader.Close()
+
+	candles := make([]Candle, 0, reader.NumRows())
+	rows := make([]ParquetRow, 1024)
+	for {
+		n, err := reader.Read(rows)
+		for _, row := range rows[:n] {
+			c, err := row.Candle()
+			if err != nil {
+				return nil, err
+			}
+			candles = append(candles, c)
+		}
+		if errors.Is(err, io.EOF) {
+			return candles, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading parquet rows: %w", err)
+		}
+	}
+}
+
+func toDecimal(price float64) int64 {
+	return int64(math.Round(price * math.Pow10(ParquetPriceScale)))
+}
+
+func fromDecimal(value int64) float64 {
+	return float64(value) / math.Pow10(ParquetPriceScale)
+}
@@ -0,0 +1,90 @@
+package candle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+func writeParquet(t *testing.T, path string, candles []Candle) {
+	t.Helper()
+
+	rows := make([]ParquetRow, len(candles))
+	for i, c := range candles {
+		rows[i] = NewParquetRow(c)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	writer := parquet.NewGenericWriter[ParquetRow](f)
+	if _, err := writer.Write(rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readParquet(t *testing.T, path string) []Candle {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	candles, err := ReadParquet(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return candles
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	candles := sample(3)
+	// Nine decimal places survive exactly, the most DBN prices carry.
+	candles[1].Open = 20123.123456789
+	candles[1].Low = 0.000000001
+	candles[2].Timestamp = candles[2].Timestamp.Add(123456789)
+
+	path := filepath.Join(t.TempDir(), "candles.parquet")
+	writeParquet(t, path, candles)
+	if got := readParquet(t, path); !reflect.DeepEqual(got, candles) {
+		t.Errorf("round trip = %+v, want %+v", got, candles)
+	}
+}
+
+func TestParquetRoundsToNineDecimals(t *testing.T) {
+	candles := sample(1)
+	candles[0].Close = 1.0000000004
+	candles[0].High = 1.0000000006
+
+	path := filepath.Join(t.TempDir(), "candles.parquet")
+	writeParquet(t, path, candles)
+	got := readParquet(t, path)
+	if got[0].Close != 1 || got[0].High != 1.000000001 {
+		t.Errorf("close, high = %v, %v, want 1, 1.000000001", got[0].Close, got[0].High)
+	}
+}
+
+func TestParquetPricesAreDecimals(t *testing.T) {
+	schema := parquet.SchemaOf(ParquetRow{})
+	for _, column := range []string{"open", "high", "low", "close"} {
+		field, ok := schema.Lookup(column)
+		if !ok {
+			t.Fatalf("no %s column", column)
+		}
+		decimal, ok := field.Node.Type().LogicalType().Value.(*format.DecimalType)
+		if !ok || decimal.Precision != 18 || decimal.Scale != ParquetPriceScale {
+			t.Errorf("%s column is %v, want DECIMAL(18, 9)", column, field.Node.Type())
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package candle
+
+import (
+	"log"
+
+	"github.com/mgordon34/gostonks/internal/config"
+	"github.com/mgordon34/gostonks/internal/storage"
+)
+
+// Candle sources selectable with CANDLE_SOURCE.
+const (
+	PostgresSource = "postgres"
+	MemorySource   = "memory"
+	FileSource     = "file"
+)
+
+// Source returns the configured CANDLE_SOURCE, defaulting to Postgres.
+func Source() string {
+	return config.Get("CANDLE_SOURCE", PostgresSource)
+}
+
+// OpenRepository builds the Repository selected by CANDLE_SOURCE. The file
+// source reads the directory named by CANDLE_DIR so a backtest can run
+// without Postgres.
+func OpenRepository() Repository {
+	switch source := Source(); source {
+	case PostgresSource:
+		return NewRepository(storage.GetDB(config.Get("DB_URL", "")))
+	case MemorySource:
+		return NewMemoryRepository()
+	case FileSource:
+		dir := config.Get("CANDLE_DIR", "data")
+		repo, err := NewFileRepository(dir)
+		if err != nil {
+			log.Fatalf("Failed to load candle files from %s: %v", dir, err)
+		}
+		return repo
+	default:
+		log.Fatalf("Unknown CANDLE_SOURCE %q", source)
+		return nil
+	}
+}
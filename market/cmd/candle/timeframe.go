@@ -0,0 +1,118 @@
+package candle
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type TimeUnit string
+
+const (
+	Second TimeUnit = "s"
+	Minute TimeUnit = "m"
+	Hour   TimeUnit = "h"
+	Day    TimeUnit = "d"
+	Week   TimeUnit = "w"
+)
+
+var unitDurations = map[TimeUnit]time.Duration{
+	Second: time.Second,
+	Minute: time.Minute,
+	Hour:   time.Hour,
+	Day:    24 * time.Hour,
+	Week:   7 * 24 * time.Hour,
+}
+
+// Timeframe is a bar length such as 1s, 5m or 1h. It is stored and
+// serialized in that short string form.
+type Timeframe struct {
+	Count int
+	Unit  TimeUnit
+}
+
+func ParseTimeframe(value string) (Timeframe, error) {
+	if len(value) < 2 {
+		return Timeframe{}, fmt.Errorf("invalid timeframe %q", value)
+	}
+
+	unit := TimeUnit(value[len(value)-1:])
+	if _, ok := unitDurations[unit]; !ok {
+		return Timeframe{}, fmt.Errorf("invalid timeframe unit in %q", value)
+	}
+	count, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || count <= 0 {
+		return Timeframe{}, fmt.Errorf("invalid timeframe count in %q", value)
+	}
+
+	return Timeframe{Count: count, Unit: unit}, nil
+}
+
+// MustParseTimeframe is ParseTimeframe for constant timeframes, panicking on
+// invalid input.
+func MustParseTimeframe(value string) Timeframe {
+	tf, err := ParseTimeframe(value)
+	if err != nil {
+		panic(err)
+	}
+	return tf
+}
+
+func (tf Timeframe) IsZero() bool {
+	return tf.Count == 0
+}
+
+// Duration is the length of one bar.
+func (tf Timeframe) Duration() time.Duration {
+	return time.Duration(tf.Count) * unitDurations[tf.Unit]
+}
+
+// Truncate rounds t down to the open of the bar containing it.
+func (tf Timeframe) Truncate(t time.Time) time.Time {
+	return t.UTC().Truncate(tf.Duration())
+}
+
+// Bars returns how many whole bars of this timeframe fit in d.
+func (tf Timeframe) Bars(d time.Duration) int {
+	if tf.IsZero() {
+		return 0
+	}
+	return int(d / tf.Duration())
+}
+
+func (tf Timeframe) String() string {
+	if tf.IsZero() {
+		return ""
+	}
+	return strconv.Itoa(tf.Count) + string(tf.Unit)
+}
+
+func (tf Timeframe) MarshalText() ([]byte, error) {
+	return []byte(tf.String()), nil
+}
+
+func (tf *Timeframe) UnmarshalText(text []byte) error {
+	parsed, err := ParseTimeframe(string(text))
+	if err != nil {
+		return err
+	}
+	*tf = parsed
+	return nil
+}
+
+// Scan lets pgx read the timeframe column directly into a Timeframe.
+func (tf *Timeframe) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return tf.UnmarshalText([]byte(v))
+	case []byte:
+		return tf.UnmarshalText(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Timeframe", src)
+	}
+}
+
+func (tf Timeframe) Value() (driver.Value, error) {
+	return tf.String(), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mgordon34/gostonks/internal/config"
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+	"github.com/mgordon34/gostonks/market/internal/export"
+)
+
+func main() {
+	var request export.ExportRequest
+	var timeframe, start, end string
+	flag.StringVar(&request.Market, "market", "futures", "market of the candles to export")
+	flag.StringVar(&request.Symbol, "symbol", "", "symbol of the candles to export")
+	flag.StringVar(&timeframe, "timeframe", "1m", "timeframe of the candles to export")
+	flag.StringVar(&start, "start", "", "first timestamp to export (RFC 3339 or YYYY-MM-DD)")
+	flag.StringVar(&end, "end", "", "last timestamp to export (RFC 3339 or YYYY-MM-DD, inclusive)")
+	flag.StringVar(&request.Format, "format", export.ParquetFormat, "output format: parquet or csv")
+	flag.StringVar(&request.Partition, "partition", export.DayPartition, "file partitioning: day or month")
+	flag.StringVar(&request.OutputDir, "out", "", "output directory, relative to EXPORT_DIR")
+	flag.Parse()
+
+	var err error
+	if request.Timeframe, err = candle.ParseTimeframe(timeframe); err != nil {
+		log.Fatalf("Invalid -timeframe: %v", err)
+	}
+	if request.StartTime, err = parseTime(start, false); err != nil {
+		log.Fatalf("Invalid -start: %v", err)
+	}
+	if request.EndTime, err = parseTime(end, true); err != nil {
+		log.Fatalf("Invalid -end: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	service := export.NewService(candle.OpenRepository(), config.Get("EXPORT_DIR", "exports"))
+	manifest, err := service.Export(ctx, request)
+	if err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+
+	log.Printf("Exported %d candles to %d %s files", manifest.Rows, len(manifest.Files), manifest.Format)
+}
+
+// parseTime accepts RFC 3339 timestamps or bare dates. A bare end date
+// covers the whole day.
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
@@ -14,12 +14,15 @@ import (
 	"github.com/mgordon34/gostonks/market/cmd/candle"
 	"github.com/mgordon34/gostonks/internal/config"
 	"github.com/mgordon34/gostonks/internal/storage"
+	"github.com/mgordon34/gostonks/market/internal/export"
 	"github.com/mgordon34/gostonks/market/internal/historical"
 	"github.com/mgordon34/gostonks/market/internal/ingest"
 )
 
 func main() {
-	storage.InitTables(config.Get("DB_URL", ""), GetCommands())
+	if candle.Source() == candle.PostgresSource {
+		storage.InitTables(config.Get("DB_URL", ""), GetCommands())
+	}
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
@@ -38,9 +41,9 @@ func main() {
 	ch := pubsub.Channel()
 	log.Printf("Listening for market events on %s channel 'market'", addr)
 
-	db := storage.GetDB(config.Get("DB_URL", ""))
-	candleRepository := candle.NewRepository(db)
+	candleRepository := candle.OpenRepository()
 	historicalService := historical.NewService(client, candleRepository)
+	exportService := export.NewService(candleRepository, config.Get("EXPORT_DIR", "exports"))
 
 	for {
 		select {
@@ -66,6 +69,8 @@ func main() {
 					decodeAndHandle(ctx, controlMessage.Data, historicalService.HandleDataRequest)
 				case "ingest_request":
 					decodeAndHandle(ctx, controlMessage.Data, ingest.HandleIngest)
+				case "export_request":
+					decodeAndHandle(ctx, controlMessage.Data, exportService.HandleExportRequest)
 				default:
 					log.Printf("Unknown control message type: %s", controlMessage.Type)
 				}
@@ -0,0 +1,283 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+// Supported export formats and partition granularities.
+const (
+	ParquetFormat = "parquet"
+	CSVFormat     = "csv"
+
+	DayPartition   = "day"
+	MonthPartition = "month"
+
+	manifestFile = "manifest.json"
+)
+
+type ExportRequest struct {
+	Market    string           `json:"market"`
+	Symbol    string           `json:"symbol"`
+	Timeframe candle.Timeframe `json:"timeframe"`
+	StartTime time.Time        `json:"start_time"`
+	EndTime   time.Time        `json:"end_time"`
+	Format    string           `json:"format"`
+	Partition string           `json:"partition"`
+	OutputDir string           `json:"output_dir"`
+}
+
+// Manifest describes a finished export and is written next to the data files.
+type Manifest struct {
+	Market    string           `json:"market"`
+	Symbol    string           `json:"symbol"`
+	Timeframe candle.Timeframe `json:"timeframe"`
+	StartTime time.Time        `json:"start_time"`
+	EndTime   time.Time        `json:"end_time"`
+	Format    string           `json:"format"`
+	Partition string           `json:"partition"`
+	Columns   []string         `json:"columns"`
+	Rows      int              `json:"rows"`
+	Files     []ManifestFile   `json:"files"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+type ManifestFile struct {
+	Path           string    `json:"path"`
+	Partition      string    `json:"partition"`
+	Rows           int       `json:"rows"`
+	FirstTimestamp time.Time `json:"first_timestamp"`
+	LastTimestamp  time.Time `json:"last_timestamp"`
+}
+
+type Service struct {
+	repo    candle.Repository
+	baseDir string
+}
+
+func NewService(repo candle.Repository, baseDir string) *Service {
+	return &Service{
+		repo:    repo,
+		baseDir: baseDir,
+	}
+}
+
+// HandleExportRequest is the control message entrypoint for export_request.
+func (s *Service) HandleExportRequest(ctx context.Context, request ExportRequest) {
+	manifest, err := s.Export(ctx, request)
+	if err != nil {
+		log.Printf("Export of %s %s failed: %v", request.Symbol, request.Timeframe, err)
+		return
+	}
+
+	log.Printf("Exported %d candles to %d %s files", manifest.Rows, len(manifest.Files), manifest.Format)
+}
+
+// Export writes the requested candle range one partition at a time and
+// returns the manifest it wrote alongside the files. Empty partitions are
+// skipped.
+func (s *Service) Export(ctx context.Context, request ExportRequest) (Manifest, error) {
+	request, err := s.normalize(request)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := os.MkdirAll(request.OutputDir, 0o755); err != nil {
+		return Manifest{}, err
+	}
+
+	manifest := Manifest{
+		Market:    request.Market,
+		Symbol:    request.Symbol,
+		Timeframe: request.Timeframe,
+		StartTime: request.StartTime,
+		EndTime:   request.EndTime,
+		Format:    request.Format,
+		Partition: request.Partition,
+		Columns:   candle.CSVHeader,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	for start := partitionStart(request.StartTime, request.Partition); !start.After(request.EndTime); start = nextPartition(start, request.Partition) {
+		end := nextPartition(start, request.Partition).Add(-time.Nanosecond)
+		candles := s.repo.GetCandles(
+			ctx,
+			request.Market,
+			request.Symbol,
+			request.Timeframe,
+			laterOf(start, request.StartTime),
+			earlierOf(end, request.EndTime),
+		)
+		if len(candles) == 0 {
+			continue
+		}
+
+		name := partitionName(start, request.Partition)
+		path := filepath.Join(name, "candles."+request.Format)
+		if err := writePartition(filepath.Join(request.OutputDir, path), request.Format, candles); err != nil {
+			return manifest, fmt.Errorf("writing partition %s: %w", name, err)
+		}
+
+		manifest.Rows += len(candles)
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Path:           path,
+			Partition:      name,
+			Rows:           len(candles),
+			FirstTimestamp: candles[0].Timestamp.UTC(),
+			LastTimestamp:  candles[len(candles)-1].Timestamp.UTC(),
+		})
+	}
+
+	return manifest, writeManifest(filepath.Join(request.OutputDir, manifestFile), manifest)
+}
+
+func (s *Service) normalize(request ExportRequest) (ExportRequest, error) {
+	if request.Market == "" || request.Symbol == "" || request.Timeframe.IsZero() {
+		return request, fmt.Errorf("market, symbol and timeframe are required")
+	}
+	if request.EndTime.Before(request.StartTime) {
+		return request, fmt.Errorf("end_time %s is before start_time %s", request.EndTime.Format(time.RFC3339), request.StartTime.Format(time.RFC3339))
+	}
+
+	if request.Format == "" {
+		request.Format = ParquetFormat
+	}
+	if request.Format != ParquetFormat && request.Format != CSVFormat {
+		return request, fmt.Errorf("unsupported export format %q", request.Format)
+	}
+
+	if request.Partition == "" {
+		request.Partition = DayPartition
+	}
+	if request.Partition != DayPartition && request.Partition != MonthPartition {
+		return request, fmt.Errorf("unsupported partition %q", request.Partition)
+	}
+
+	if request.OutputDir == "" {
+		request.OutputDir = fmt.Sprintf(
+			"%s_%s_%s_%s_%s",
+			request.Market,
+			request.Symbol,
+			request.Timeframe,
+			request.StartTime.UTC().Format("20060102"),
+			request.EndTime.UTC().Format("20060102"),
+		)
+	}
+	// Requests arrive over the control channel, so the output directory must
+	// stay inside baseDir.
+	dir := filepath.Clean(request.OutputDir)
+	if !filepath.IsLocal(dir) {
+		return request, fmt.Errorf("output directory %q must be relative to the export directory", request.OutputDir)
+	}
+	request.OutputDir = filepath.Join(s.baseDir, dir)
+
+	request.StartTime = request.StartTime.UTC()
+	request.EndTime = request.EndTime.UTC()
+	return request, nil
+}
+
+func writePartition(path string, format string, candles []candle.Candle) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch format {
+	case ParquetFormat:
+		err = writeParquet(f, candles)
+	case CSVFormat:
+		err = writeCSV(f, candles)
+	}
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeParquet(f *os.File, candles []candle.Candle) error {
+	rows := make([]candle.ParquetRow, len(candles))
+	for i, c := range candles {
+		rows[i] = candle.NewParquetRow(c)
+	}
+
+	writer := parquet.NewGenericWriter[candle.ParquetRow](f, parquet.Compression(&parquet.Zstd))
+	if _, err := writer.Write(rows); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func writeCSV(f *os.File, candles []candle.Candle) error {
+	writer := csv.NewWriter(f)
+	if err := writer.Write(candle.CSVHeader); err != nil {
+		return err
+	}
+	for _, c := range candles {
+		if err := writer.Write(candle.CSVRecord(c)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeManifest(path string, manifest Manifest) error {
+	payload, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, payload, 0o644)
+}
+
+func partitionStart(t time.Time, partition string) time.Time {
+	if partition == MonthPartition {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func nextPartition(t time.Time, partition string) time.Time {
+	if partition == MonthPartition {
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// partitionName uses hive-style directory names so DuckDB and pandas can
+// recover the partition column.
+func partitionName(t time.Time, partition string) string {
+	if partition == MonthPartition {
+		return "month=" + t.Format("2006-01")
+	}
+	return "date=" + t.Format("2006-01-02")
+}
+
+func laterOf(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earlierOf(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
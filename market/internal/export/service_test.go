@@ -0,0 +1,205 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mgordon34/gostonks/market/cmd/candle"
+)
+
+var oneHour = candle.MustParseTimeframe("1h")
+
+// hourly is a repository of NQZ4 1h candles from October 30th to November
+// 2nd 2024, with none on October 31st.
+func hourly() candle.Repository {
+	var candles []candle.Candle
+	for ts := time.Date(2024, 10, 30, 0, 0, 0, 0, time.UTC); ts.Before(time.Date(2024, 11, 3, 0, 0, 0, 0, time.UTC)); ts = ts.Add(time.Hour) {
+		if ts.Day() == 31 {
+			continue
+		}
+		p := 20000 + float64(ts.Hour()) + 0.25
+		candles = append(candles, candle.Candle{
+			Market:    "futures",
+			Symbol:    "NQZ4",
+			Timeframe: oneHour,
+			Open:      p,
+			High:      p + 2,
+			Low:       p - 1.5,
+			Close:     p + 1,
+			Volume:    ts.Hour() + 1,
+			Timestamp: ts,
+		})
+	}
+
+	repo := candle.NewMemoryRepository()
+	repo.Load(candles)
+	return repo
+}
+
+func request(format string, partition string) ExportRequest {
+	return ExportRequest{
+		Market:    "futures",
+		Symbol:    "NQZ4",
+		Timeframe: oneHour,
+		StartTime: time.Date(2024, 10, 30, 12, 0, 0, 0, time.UTC),
+		// A non-UTC end time is exported as UTC.
+		EndTime:   time.Date(2024, 11, 2, 1, 0, 0, 0, time.FixedZone("EDT", -4*60*60)),
+		Format:    format,
+		Partition: partition,
+	}
+}
+
+func TestExportPartitions(t *testing.T) {
+	ctx := context.Background()
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2024, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		format    string
+		partition string
+		files     []ManifestFile
+	}{
+		{
+			name:   "days skip the empty one",
+			format: CSVFormat, partition: DayPartition,
+			files: []ManifestFile{
+				{Path: "date=2024-10-30/candles.csv", Partition: "date=2024-10-30", Rows: 12, FirstTimestamp: at(time.October, 30, 12), LastTimestamp: at(time.October, 30, 23)},
+				{Path: "date=2024-11-01/candles.csv", Partition: "date=2024-11-01", Rows: 24, FirstTimestamp: at(time.November, 1, 0), LastTimestamp: at(time.November, 1, 23)},
+				{Path: "date=2024-11-02/candles.csv", Partition: "date=2024-11-02", Rows: 6, FirstTimestamp: at(time.November, 2, 0), LastTimestamp: at(time.November, 2, 5)},
+			},
+		},
+		{
+			name:   "months",
+			format: "", partition: MonthPartition,
+			files: []ManifestFile{
+				{Path: "month=2024-10/candles.parquet", Partition: "month=2024-10", Rows: 12, FirstTimestamp: at(time.October, 30, 12), LastTimestamp: at(time.October, 30, 23)},
+				{Path: "month=2024-11/candles.parquet", Partition: "month=2024-11", Rows: 30, FirstTimestamp: at(time.November, 1, 0), LastTimestamp: at(time.November, 2, 5)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			repo := hourly()
+			service := NewService(repo, base)
+			req := request(tt.format, tt.partition)
+
+			manifest, err := service.Export(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(manifest.Files, tt.files) {
+				t.Errorf("files = %+v, want %+v", manifest.Files, tt.files)
+			}
+			if manifest.Rows != 42 || manifest.Format == "" || manifest.Partition != tt.partition {
+				t.Errorf("manifest rows, format, partition = %d, %q, %q, want 42 rows of %q", manifest.Rows, manifest.Format, manifest.Partition, tt.partition)
+			}
+			if !manifest.EndTime.Equal(req.EndTime) || manifest.EndTime.Location() != time.UTC {
+				t.Errorf("manifest end = %v, want %v in UTC", manifest.EndTime, req.EndTime)
+			}
+
+			// The default directory is named for the series and dates.
+			dir := filepath.Join(base, "futures_NQZ4_1h_20241030_20241102")
+			var written Manifest
+			payload, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(payload, &written); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(written, manifest) {
+				t.Errorf("manifest.json = %+v, want %+v", written, manifest)
+			}
+
+			for _, file := range manifest.Files {
+				got := readPartition(t, filepath.Join(dir, file.Path), manifest.Format)
+				want := repo.GetCandles(ctx, "futures", "NQZ4", oneHour, file.FirstTimestamp, file.LastTimestamp)
+				for i := range want {
+					want[i].ID = 0
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s holds %d candles that differ from the repository's %d", file.Path, len(got), len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestExportKeepsOutputInsideBaseDir(t *testing.T) {
+	ctx := context.Background()
+	parent := t.TempDir()
+	base := filepath.Join(parent, "exports")
+	service := NewService(hourly(), base)
+
+	for _, dir := range []string{"../escape", "nested/../../escape", filepath.Join(parent, "escape")} {
+		req := request(CSVFormat, DayPartition)
+		req.OutputDir = dir
+		if _, err := service.Export(ctx, req); err == nil {
+			t.Errorf("output dir %q was accepted", dir)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escape")); !os.IsNotExist(err) {
+		t.Errorf("an export was written outside the base directory: %v", err)
+	}
+
+	req := request(CSVFormat, DayPartition)
+	req.OutputDir = "nested/../inside"
+	if _, err := service.Export(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "inside", "manifest.json")); err != nil {
+		t.Errorf("export to a local directory: %v", err)
+	}
+}
+
+func TestExportRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*ExportRequest)
+	}{
+		{"no symbol", func(r *ExportRequest) { r.Symbol = "" }},
+		{"no timeframe", func(r *ExportRequest) { r.Timeframe = candle.Timeframe{} }},
+		{"end before start", func(r *ExportRequest) { r.EndTime = r.StartTime.Add(-time.Hour) }},
+		{"unknown format", func(r *ExportRequest) { r.Format = "xlsx" }},
+		{"unknown partition", func(r *ExportRequest) { r.Partition = "week" }},
+	}
+	for _, tt := range tests {
+		req := request(CSVFormat, DayPartition)
+		tt.change(&req)
+		base := t.TempDir()
+		if _, err := NewService(hourly(), base).Export(context.Background(), req); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func readPartition(t *testing.T, path string, format string) []candle.Candle {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var candles []candle.Candle
+	switch format {
+	case ParquetFormat:
+		candles, err = candle.ReadParquet(f)
+	case CSVFormat:
+		candles, err = candle.ReadCSV(f)
+	}
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return candles
+}
@@ -12,11 +12,11 @@ import (
 )
 
 type DataRequest struct {
-	Market    string    `json:"market"`
-	Symbol    string    `json:"symbol"`
-	StartTime time.Time `json:"start_time"`
-	EndTime   time.Time `json:"end_time"`
-	Timeframe string    `json:"timeframe"`
+	Market    string           `json:"market"`
+	Symbol    string           `json:"symbol"`
+	StartTime time.Time        `json:"start_time"`
+	EndTime   time.Time        `json:"end_time"`
+	Timeframe candle.Timeframe `json:"timeframe"`
 }
 
 type Broker interface {
@@ -32,7 +32,7 @@ type Service struct {
 func NewService(broker Broker, repo candle.Repository) *Service {
 	return &Service{
 		broker: broker,
-		repo: repo,
+		repo:   repo,
 		queue:  "market",
 	}
 }